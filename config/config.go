@@ -7,6 +7,7 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 )
 
 //Set is mostly used for hard coding value required in testing
@@ -143,3 +144,27 @@ func (cv ConfigValue) MustGetStruct(structByName map[string]interface{}) interfa
 type IValidator interface {
 	Validate() error
 }
+
+//Duration is a config value specified as a string, e.g. "500ms", "5s" or "1m"
+type Duration struct {
+	Name   string         //name in the config, used in errors
+	Value  string         //not specified leaves the parsed value unchanged
+	Parsed *time.Duration //set to the parsed value
+}
+
+//ParseDurations is called by Validate() to parse the durations of a config, which may not be negative
+func ParseDurations(durations ...Duration) error {
+	for _, d := range durations {
+		if d.Value == "" {
+			continue
+		}
+		var err error
+		if *d.Parsed, err = time.ParseDuration(d.Value); err != nil {
+			return fmt.Errorf("invalid %s=\"%s\": %v", d.Name, d.Value, err)
+		}
+		if *d.Parsed < 0 {
+			return fmt.Errorf("invalid %s=\"%s\" may not be negative", d.Name, d.Value)
+		}
+	}
+	return nil
+}
@@ -1,79 +1,413 @@
 package crud
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"net/http"
+	"reflect"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/go-msvc/msf/db"
+	"github.com/go-msvc/msf/logger"
 	"github.com/go-msvc/msf/model"
 	"github.com/go-msvc/msf/mux"
 	"github.com/go-msvc/msf/service"
 )
 
-func New(model model.IItem) mux.IMux {
-	mux := mux.New(listHandler(model))
-	mux.Add("{id}", itemHandler(model))
+var log = logger.New("msf").New("crud")
+
+//New creates a mux with CRUD operations on the table:
+//	GET    /          list items, with optional ?<field>=<value> filters and paging with
+//	                  ?sort=-<field>,<field>&limit=<n>&cursor=<page.next|page.prev>&offset=<n>&total=true
+//	POST   /          create item from JSON body
+//	GET    /{id}      get item
+//	GET and list also load referenced items with ?include=<ref>,<ref>.<ref>, e.g. ?include=location
+//	GET and list also return soft deleted items with ?deleted=true, see model.SoftDelete
+//	PUT    /{id}      replace item with JSON body
+//	PATCH  /{id}      update item with fields in JSON body
+//	DELETE /{id}      delete item
+//POST, PUT and PATCH validate the item with the validate tags of its fields, see model.Validation,
+//and respond with status 400, code "INVALID" and the errors of each invalid field in header.details
+//items with model.Version are returned with the version in header ETag, e.g. `"3"`, and PUT, PATCH and
+//DELETE with header If-Match only change the item when it still has that version, else respond with
+//status 412, while PUT and PATCH without If-Match check the Version in the body, if specified, and
+//respond with status 409 when the item was changed since it was read
+//add it to a service with HandleMux(), e.g. svc.HandleMux("stock", crud.New(stockTable))
+func New(table db.ITable) mux.IMux {
+	mux := mux.New(nil)
+	mux.MustAddMethod(http.MethodGet, "", listHandler(table))
+	mux.MustAddMethod(http.MethodPost, "", createHandler(table))
+	mux.MustAddMethod(http.MethodGet, "{id:int}", getHandler(table))
+	mux.MustAddMethod(http.MethodPut, "{id:int}", replaceHandler(table))
+	mux.MustAddMethod(http.MethodPatch, "{id:int}", patchHandler(table))
+	mux.MustAddMethod(http.MethodDelete, "{id:int}", deleteHandler(table))
 	return mux
 }
 
-func listHandler(model model.IItem) interface{} {
+type handlerFunc = func(ctx service.IContext, muxData map[string]interface{}) (interface{}, error)
+
+func listHandler(table db.ITable) handlerFunc {
 	return func(ctx service.IContext, muxData map[string]interface{}) (interface{}, error) {
-		fmt.Printf("CRUD(%s).LIST %+v\n", model.Name(), muxData)
+		log.Debugf("CRUD(%s).LIST %+v", table.Name(), muxData)
 
-		//get list of items
-		limit := int(paramIntWithDefault(muxData, "limit", 10, 1, 10000))
+		//get page of items
+		options := db.QueryOptions{Limit: 10}
 		key := map[string]interface{}{}
-		for n, v := range muxData {
-			if n == "limit" {
-				continue
+		dbCtx := ctx.Context()
+		if httpReq := ctx.Request(); httpReq != nil {
+			for n, v := range httpReq.URL.Query() {
+				switch n {
+				case "limit":
+					options.Limit = paramIntWithDefault(v[0], 10, 1, 10000)
+					continue
+				case "offset":
+					options.Offset = paramIntWithDefault(v[0], 0, 0, math.MaxInt64)
+					continue
+				case "sort":
+					options.OrderBy = db.ParseOrder(v[0])
+					continue
+				case "cursor":
+					options.Cursor = v[0]
+					continue
+				case "total":
+					options.WithTotal, _ = strconv.ParseBool(v[0])
+					continue
+				case "include":
+					options.Include = strings.Split(v[0], ",")
+					continue
+				case "deleted":
+					if withDeleted, _ := strconv.ParseBool(v[0]); withDeleted {
+						dbCtx = db.WithDeleted(dbCtx)
+					}
+					continue
+				}
+				f, ok := table.Model().FieldByName(n)
+				if !ok {
+					return nil, service.Errorf(http.StatusBadRequest, db.ErrorName[db.ERR_KEY_FIELD_UNKNOWN], "unknown %s field \"%s\"", table.Name(), n)
+				}
+				keyValue, err := fieldValue(f, v[0])
+				if err != nil {
+					return nil, service.Errorf(http.StatusBadRequest, db.ErrorName[db.ERR_KEY_FIELD_TYPE], "invalid %s=\"%s\": %v", n, v[0], err)
+				}
+				key[n] = keyValue
 			}
-			key[n] = v
 		}
-		itemList, err := model.GetList(key, limit)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get %s: %v", model.Name(), err)
+		page, dbErr := table.QueryContext(dbCtx, db.KeyFilter(key), options)
+		if dbErr != nil {
+			return nil, serviceError(table, dbErr)
+		}
+		res := service.Page{
+			Items: page.Items,
+			ResponsePage: service.ResponsePage{
+				Next: page.Next,
+				Prev: page.Prev,
+			},
+		}
+		if options.WithTotal {
+			res.Total = &page.Total
+		}
+		return res, nil
+	}
+}
+
+func createHandler(table db.ITable) handlerFunc {
+	return func(ctx service.IContext, muxData map[string]interface{}) (interface{}, error) {
+		log.Debugf("CRUD(%s).CREATE", table.Name())
+		itemPtrValue := reflect.New(table.Model().StructType())
+		if err := decodeBody(ctx, itemPtrValue.Interface()); err != nil {
+			return nil, err
+		}
+		setId(itemPtrValue, 0) //id is allocated by the db
+		id, dbErr := table.AddContext(ctx.Context(), itemPtrValue.Elem().Interface())
+		if dbErr != nil {
+			return nil, serviceError(table, dbErr)
+		}
+		if httpReq := ctx.Request(); httpReq != nil {
+			ctx.Header().Set("Location", fmt.Sprintf("%s/%d", httpReq.URL.Path, id))
 		}
-		// if len(itemList) == 0 {
-		// 	return nil, fmt.Errorf("not found key:%+v", key)
-		// }
-		return itemList, nil
+		ctx.SetStatus(http.StatusCreated)
+		return stored(ctx, table, id)
 	}
 }
 
-func itemHandler(model model.IItem) interface{} {
+func getHandler(table db.ITable) handlerFunc {
 	return func(ctx service.IContext, muxData map[string]interface{}) (interface{}, error) {
-		fmt.Printf("CRUD(%s).ITEM %+v\n", model.Name(), muxData)
-		itemIdStr, ok := muxData["id"].(string)
-		if !ok {
-			return nil, fmt.Errorf("missing id")
+		log.Debugf("CRUD(%s).GET %+v", table.Name(), muxData)
+		dbCtx := ctx.Context()
+		if httpReq := ctx.Request(); httpReq != nil {
+			if withDeleted, _ := strconv.ParseBool(httpReq.URL.Query().Get("deleted")); withDeleted {
+				dbCtx = db.WithDeleted(dbCtx)
+			}
+		}
+		item, dbErr := table.GetByIdContext(dbCtx, muxData["id"].(int64))
+		if dbErr != nil {
+			return nil, serviceError(table, dbErr)
+		}
+		if httpReq := ctx.Request(); httpReq != nil && httpReq.URL.Query().Get("include") != "" {
+			items := []interface{}{item}
+			if dbErr := table.IncludeContext(dbCtx, items, strings.Split(httpReq.URL.Query().Get("include"), ",")...); dbErr != nil {
+				return nil, serviceError(table, dbErr)
+			}
+			item = items[0]
+		}
+		setETag(ctx, table, item)
+		return item, nil
+	}
+}
+
+//PUT replaces all fields of the item
+func replaceHandler(table db.ITable) handlerFunc {
+	return func(ctx service.IContext, muxData map[string]interface{}) (interface{}, error) {
+		log.Debugf("CRUD(%s).REPLACE %+v", table.Name(), muxData)
+		id := muxData["id"].(int64)
+		itemPtrValue := reflect.New(table.Model().StructType())
+		if err := decodeBody(ctx, itemPtrValue.Interface()); err != nil {
+			return nil, err
+		}
+		setId(itemPtrValue, id)
+		if err := setVersion(ctx, table, itemPtrValue); err != nil {
+			return nil, err
 		}
+		if dbErr := table.UpdContext(ctx.Context(), itemPtrValue.Elem().Interface()); dbErr != nil {
+			return nil, conflictError(ctx, table, dbErr)
+		}
+		return stored(ctx, table, id)
+	}
+}
 
-		itemId64, err := strconv.ParseInt(itemIdStr, 10, 64)
-		if err != nil {
-			return nil, fmt.Errorf("non-integer id \"%v\"", itemIdStr)
+//PATCH only changes the fields present in the JSON body
+func patchHandler(table db.ITable) handlerFunc {
+	return func(ctx service.IContext, muxData map[string]interface{}) (interface{}, error) {
+		log.Debugf("CRUD(%s).PATCH %+v", table.Name(), muxData)
+		id := muxData["id"].(int64)
+		existingItem, dbErr := table.GetByIdContext(ctx.Context(), id)
+		if dbErr != nil {
+			return nil, serviceError(table, dbErr)
+		}
+		body := map[string]json.RawMessage{}
+		if err := decodeBody(ctx, &body); err != nil {
+			return nil, err
+		}
+		fieldNames := patchedFieldNames(table.Model(), body)
+		if len(fieldNames) == 0 {
+			//nothing to update, but If-Match must still match
+			if version, ok, err := ifMatch(ctx, table); err != nil {
+				return nil, err
+			} else if existingVersion, _ := db.ItemVersion(table.Model(), existingItem); ok && version != existingVersion {
+				return nil, service.Errorf(http.StatusPreconditionFailed, db.ErrorName[db.ERR_CONFLICT], "%s(%d) version %d is not %d", table.Name(), id, existingVersion, version)
+			}
+			setETag(ctx, table, existingItem)
+			return existingItem, nil
 		}
-		itemId := int(itemId64)
-		fmt.Printf("CRUD itemName=%v\n", itemId)
 
-		//todo: http crud method must also be in muxData: GET|DEL|UPD
+		//apply body to the existing item and only update the fields in the body
+		itemPtrValue := reflect.New(table.Model().StructType())
+		itemPtrValue.Elem().Set(reflect.ValueOf(existingItem))
+		jsonBody, _ := json.Marshal(body)
+		if err := json.Unmarshal(jsonBody, itemPtrValue.Interface()); err != nil {
+			return nil, service.Errorf(http.StatusBadRequest, "INVALID_REQUEST", "cannot decode JSON body into %v: %v", table.Model().StructType(), err)
+		}
+		setId(itemPtrValue, id)
+		if err := setVersion(ctx, table, itemPtrValue); err != nil {
+			return nil, err
+		}
+		if dbErr := table.UpdContext(ctx.Context(), itemPtrValue.Elem().Interface(), fieldNames...); dbErr != nil {
+			return nil, conflictError(ctx, table, dbErr)
+		}
+		return stored(ctx, table, id)
+	}
+}
 
-		//get one item
-		itemData, err := model.GetById(itemId)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get %s: %v", model.Name(), err)
+func deleteHandler(table db.ITable) handlerFunc {
+	return func(ctx service.IContext, muxData map[string]interface{}) (interface{}, error) {
+		log.Debugf("CRUD(%s).DELETE %+v", table.Name(), muxData)
+		dbCtx := ctx.Context()
+		if version, ok, err := ifMatch(ctx, table); err != nil {
+			return nil, err
+		} else if ok {
+			dbCtx = db.IfVersion(dbCtx, version)
+		}
+		if dbErr := table.DelByIdContext(dbCtx, muxData["id"].(int64)); dbErr != nil {
+			return nil, conflictError(ctx, table, dbErr)
 		}
-		return itemData, nil
+		return nil, nil
 	}
 }
 
-func paramIntWithDefault(data map[string]interface{}, name string, defaultValue int64, min int64, max int64) int64 {
-	value, defined := data[name]
-	if !defined {
-		return defaultValue
+//stored reads the item after it was written, to respond with the values set by the db,
+//like defaults, timestamps and the version
+func stored(ctx service.IContext, table db.ITable, id int64) (interface{}, error) {
+	item, dbErr := table.GetByIdContext(ctx.Context(), id)
+	if dbErr != nil {
+		return nil, serviceError(table, dbErr)
 	}
-	valueStr, isString := value.(string)
-	if !isString {
-		return defaultValue
+	setETag(ctx, table, item)
+	return item, nil
+}
+
+//setETag sets response header ETag to the quoted version of an item with model.Version
+func setETag(ctx service.IContext, table db.ITable, item interface{}) {
+	if version, ok := db.ItemVersion(table.Model(), item); ok {
+		ctx.Header().Set("ETag", strconv.Quote(strconv.FormatInt(version, 10)))
+	}
+}
+
+//ifMatch returns the version in request header If-Match, with ok=false when not specified or "*"
+//an If-Match that cannot match, because it is not a version or the item has no version, fails with 412
+func ifMatch(ctx service.IContext, table db.ITable) (version int64, ok bool, err error) {
+	httpReq := ctx.Request()
+	if httpReq == nil {
+		return 0, false, nil
 	}
+	etag := strings.TrimSpace(httpReq.Header.Get("If-Match"))
+	if etag == "" || etag == "*" {
+		return 0, false, nil
+	}
+	if _, versioned := model.AutoField(table.Model(), model.FieldVersion); versioned {
+		if unquoted, err := strconv.Unquote(etag); err == nil {
+			if version, err := strconv.ParseInt(unquoted, 10, 64); err == nil {
+				return version, true, nil
+			}
+		}
+	}
+	return 0, false, service.Errorf(http.StatusPreconditionFailed, db.ErrorName[db.ERR_CONFLICT], "%s If-Match:%s does not match", table.Name(), etag)
+}
+
+//setVersion sets the version in the item to the one in If-Match, or when not specified for PUT
+//and not in the body, to the stored version, so the item is replaced regardless of its version
+func setVersion(ctx service.IContext, table db.ITable, itemPtrValue reflect.Value) error {
+	f, versioned := model.AutoField(table.Model(), model.FieldVersion)
+	version, ok, err := ifMatch(ctx, table)
+	if err != nil || !versioned {
+		return err
+	}
+	versionValue := itemPtrValue.Elem().FieldByIndex(f.StructField.Index)
+	if !ok {
+		if versionValue.Int() != 0 {
+			return nil
+		}
+		existingItem, dbErr := table.GetByIdContext(ctx.Context(), table.Model().Fields()[0].Value(itemPtrValue.Elem().Interface()).(int64))
+		if dbErr != nil {
+			return serviceError(table, dbErr)
+		}
+		version, _ = db.ItemVersion(table.Model(), existingItem)
+	}
+	versionValue.SetInt(version)
+	return nil
+}
+
+//conflictError responds to ERR_CONFLICT with status 412 rather than 409 when the request has header If-Match
+func conflictError(ctx service.IContext, table db.ITable, dbErr db.IError) error {
+	if httpReq := ctx.Request(); dbErr.Code() == db.ERR_CONFLICT && httpReq != nil && httpReq.Header.Get("If-Match") != "" {
+		return service.NewError(http.StatusPreconditionFailed, db.ErrorName[dbErr.Code()], fmt.Errorf("%s: %v", table.Name(), dbErr))
+	}
+	return serviceError(table, dbErr)
+}
+
+func decodeBody(ctx service.IContext, itemPtr interface{}) error {
+	httpReq := ctx.Request()
+	if httpReq == nil || httpReq.Body == nil {
+		return service.Errorf(http.StatusBadRequest, "INVALID_REQUEST", "missing request body")
+	}
+	if err := json.NewDecoder(httpReq.Body).Decode(itemPtr); err != nil {
+		return service.Errorf(http.StatusBadRequest, "INVALID_REQUEST", "cannot decode JSON body into %T: %v", itemPtr, err)
+	}
+	return nil
+}
+
+//names of item fields and relations that are set in the JSON body
+//(matched case-insensitive on the JSON name, like encoding/json does)
+func patchedFieldNames(itemModel model.IItem, body map[string]json.RawMessage) []string {
+	fields := append([]model.ItemField{}, itemModel.Fields()[1:]...)
+	for _, r := range itemModel.Relations() {
+		fields = append(fields, model.ItemField{Name: r.Name, StructField: r.StructField})
+	}
+	fieldNames := []string{}
+	for _, f := range fields {
+		sf := itemModel.StructType().Field(f.StructField.Index[0])
+		jsonName := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if jsonName == "-" || (jsonName == "" && sf.Anonymous) {
+			continue //not in JSON, or embedded fields are promoted in JSON
+		}
+		if jsonName == "" {
+			jsonName = sf.Name
+		}
+		for bodyName := range body {
+			if strings.EqualFold(bodyName, jsonName) {
+				fieldNames = append(fieldNames, f.Name)
+				break
+			}
+		}
+	}
+	return fieldNames
+}
+
+//set model.Item.ID which is always the first field in the item struct
+func setId(itemPtrValue reflect.Value, id int64) {
+	itemPtrValue.Elem().Field(0).FieldByName("ID").SetInt(id)
+}
+
+//map db error codes to HTTP status
+var errorStatus = map[db.ErrorCode]int{
+	db.ERR_NOT_FOUND:          http.StatusNotFound,
+	db.ERR_DUPLICATE_KEY:      http.StatusConflict,
+	db.ERR_CONFLICT:           http.StatusConflict,            //or 412 with If-Match
+	db.ERR_QUERY_ONE_HAS_MORE: http.StatusInternalServerError, //ambiguous query, not a conflict with the request
+	db.ERR_INSERT_WRONG_TYPE:  http.StatusBadRequest,
+	db.ERR_KEY_FIELD_UNKNOWN:  http.StatusBadRequest,
+	db.ERR_KEY_FIELD_TYPE:     http.StatusBadRequest,
+	db.ERR_INVALID_CURSOR:     http.StatusBadRequest,
+	db.ERR_INVALID:            http.StatusBadRequest,
+	db.ERR_DEADLOCK:           http.StatusServiceUnavailable, //client may retry
+	db.ERR_CONNECTION:         http.StatusServiceUnavailable,
+	db.ERR_CANCELED:           http.StatusServiceUnavailable, //client disconnected or request timed out
+	db.ERR_NYI:                http.StatusNotImplemented,
+}
+
+func serviceError(table db.ITable, dbErr db.IError) error {
+	status, ok := errorStatus[dbErr.Code()]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	var fieldErrs model.ValidationErrors
+	if errors.As(dbErr, &fieldErrs) {
+		return service.ErrorWithDetails(status, db.ErrorName[dbErr.Code()], fmt.Errorf("%s: %v", table.Name(), dbErr), fieldErrs)
+	}
+	return service.NewError(status, db.ErrorName[dbErr.Code()], fmt.Errorf("%s: %v", table.Name(), dbErr))
+}
+
+//parse text value from URL into the type of the item field
+func fieldValue(f model.ItemField, text string) (interface{}, error) {
+	t := f.StructField.Type
+	if f.RefItem != nil || t == reflect.TypeOf(model.Item{}) {
+		t = reflect.TypeOf(int64(0)) //own id or reference by id
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return time.Parse(time.RFC3339Nano, text)
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return text, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(text, 10, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseUint(text, 10, 64)
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(text, 64)
+	case reflect.Bool:
+		return strconv.ParseBool(text)
+	}
+	return nil, fmt.Errorf("cannot filter on %v", t)
+}
+
+func paramIntWithDefault(valueStr string, defaultValue int64, min int64, max int64) int64 {
 	valueInt64, err := strconv.ParseInt(valueStr, 10, 64)
 	if err != nil {
 		return defaultValue
@@ -0,0 +1,205 @@
+package crud_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-msvc/msf/crud"
+	"github.com/go-msvc/msf/db"
+	"github.com/go-msvc/msf/db/dbtest"
+	"github.com/go-msvc/msf/db/memory"
+	"github.com/go-msvc/msf/model"
+	"github.com/go-msvc/msf/service"
+)
+
+//response with the data still encoded
+type response struct {
+	Header service.ResponseHeader `json:"header"`
+	Page   *service.ResponsePage  `json:"page"`
+	Data   json.RawMessage        `json:"data"`
+}
+
+//newService serves crud on a new memory table of the item under /<item name>
+func newService(t *testing.T, tmpl interface{}) (http.Handler, db.ITable) {
+	t.Helper()
+	table, err := memory.Config{}.MustCreate().AddTable(model.New().MustAdd(tmpl))
+	if err != nil {
+		t.Fatalf("failed to add table: %v", err)
+	}
+	return service.NewService("test").HandleMux(table.Name(), crud.New(table)).(http.Handler), table
+}
+
+//do sends the request with optional headers as name, value pairs
+func do(t *testing.T, svc http.Handler, method, path, body string, headers ...string) (*httptest.ResponseRecorder, response) {
+	t.Helper()
+	var reqBody io.Reader
+	if body != "" {
+		reqBody = strings.NewReader(body)
+	}
+	httpReq := httptest.NewRequest(method, path, reqBody)
+	for i := 0; i+1 < len(headers); i += 2 {
+		httpReq.Header.Set(headers[i], headers[i+1])
+	}
+	httpRes := httptest.NewRecorder()
+	svc.ServeHTTP(httpRes, httpReq)
+	res := response{}
+	if httpRes.Body.Len() > 0 {
+		if err := json.Unmarshal(httpRes.Body.Bytes(), &res); err != nil {
+			t.Fatalf("%s %s: cannot decode response %s: %v", method, path, httpRes.Body.String(), err)
+		}
+	}
+	return httpRes, res
+}
+
+func expectStatus(t *testing.T, what string, httpRes *httptest.ResponseRecorder, res response, status int, code string) {
+	t.Helper()
+	if httpRes.Code != status || res.Header.Code != code {
+		t.Fatalf("%s -> %d %s instead of %d %s: %s", what, httpRes.Code, res.Header.Code, status, code, httpRes.Body.String())
+	}
+}
+
+func TestCrud(t *testing.T) {
+	svc, _ := newService(t, dbtest.Location{})
+
+	//create
+	httpRes, res := do(t, svc, http.MethodPost, "/location", `{"Name":"one","Code":"1"}`)
+	expectStatus(t, "create", httpRes, res, http.StatusCreated, "")
+	var location dbtest.Location
+	if err := json.Unmarshal(res.Data, &location); err != nil || location.ID == 0 || location.Name != "one" {
+		t.Fatalf("created %s: %v", res.Data, err)
+	}
+	if l := httpRes.Header().Get("Location"); l != "/location/1" {
+		t.Fatalf("created at Location:%s", l)
+	}
+	do(t, svc, http.MethodPost, "/location", `{"Name":"two","Code":"2"}`)
+
+	//get
+	httpRes, res = do(t, svc, http.MethodGet, "/location/1", "")
+	expectStatus(t, "get", httpRes, res, http.StatusOK, "")
+	if err := json.Unmarshal(res.Data, &location); err != nil || location.ID != 1 || location.Code != "1" {
+		t.Fatalf("got %s: %v", res.Data, err)
+	}
+	httpRes, res = do(t, svc, http.MethodGet, "/location/99", "")
+	expectStatus(t, "get unknown", httpRes, res, http.StatusNotFound, "NOT_FOUND")
+
+	//list with filter and paging
+	httpRes, res = do(t, svc, http.MethodGet, "/location?sort=-name&limit=1&total=true", "")
+	expectStatus(t, "list", httpRes, res, http.StatusOK, "")
+	locations := []dbtest.Location{}
+	if err := json.Unmarshal(res.Data, &locations); err != nil || len(locations) != 1 || locations[0].Name != "two" {
+		t.Fatalf("listed %s: %v", res.Data, err)
+	}
+	if res.Page == nil || res.Page.Next == "" || res.Page.Total == nil || *res.Page.Total != 2 {
+		t.Fatalf("list page %+v", res.Page)
+	}
+	_, res = do(t, svc, http.MethodGet, "/location?code=1", "")
+	if err := json.Unmarshal(res.Data, &locations); err != nil || len(locations) != 1 || locations[0].Name != "one" {
+		t.Fatalf("listed code=1: %s: %v", res.Data, err)
+	}
+	httpRes, res = do(t, svc, http.MethodGet, "/location?unknown=1", "")
+	expectStatus(t, "list unknown field", httpRes, res, http.StatusBadRequest, "KEY_FIELD_UNKNOWN")
+
+	//duplicate
+	httpRes, res = do(t, svc, http.MethodPost, "/location", `{"Name":"one"}`)
+	expectStatus(t, "create duplicate", httpRes, res, http.StatusConflict, "DUPLICATE_KEY")
+	httpRes, res = do(t, svc, http.MethodPatch, "/location/2", `{"Name":"one"}`)
+	expectStatus(t, "patch duplicate", httpRes, res, http.StatusConflict, "DUPLICATE_KEY")
+
+	//replace, patch and delete
+	httpRes, res = do(t, svc, http.MethodPut, "/location/2", `{"Name":"three"}`)
+	expectStatus(t, "replace", httpRes, res, http.StatusOK, "")
+	_, res = do(t, svc, http.MethodPatch, "/location/2", `{"Code":"3"}`)
+	if err := json.Unmarshal(res.Data, &location); err != nil || location.Name != "three" || location.Code != "3" {
+		t.Fatalf("patched %s: %v", res.Data, err)
+	}
+	httpRes, res = do(t, svc, http.MethodDelete, "/location/2", "")
+	expectStatus(t, "delete", httpRes, res, http.StatusOK, "")
+	httpRes, res = do(t, svc, http.MethodDelete, "/location/2", "")
+	expectStatus(t, "delete deleted", httpRes, res, http.StatusNotFound, "NOT_FOUND")
+
+	//methods
+	httpRes, res = do(t, svc, http.MethodDelete, "/location", "")
+	if httpRes.Code != http.StatusMethodNotAllowed || httpRes.Header().Get("Allow") != "GET, HEAD, OPTIONS, POST" {
+		t.Fatalf("DELETE list -> %d Allow:%s", httpRes.Code, httpRes.Header().Get("Allow"))
+	}
+	httpRes, _ = do(t, svc, http.MethodOptions, "/location/1", "")
+	if httpRes.Code != http.StatusNoContent || httpRes.Header().Get("Allow") != "DELETE, GET, HEAD, OPTIONS, PATCH, PUT" {
+		t.Fatalf("OPTIONS item -> %d Allow:%s", httpRes.Code, httpRes.Header().Get("Allow"))
+	}
+	httpRes, res = do(t, svc, http.MethodGet, "/location/x", "")
+	expectStatus(t, "get invalid id", httpRes, res, http.StatusNotFound, "")
+}
+
+type Account struct {
+	model.Item
+	model.Version
+	Name string `uniq:"name"`
+}
+
+func TestVersion(t *testing.T) {
+	svc, _ := newService(t, Account{})
+	do(t, svc, http.MethodPost, "/account", `{"Name":"one"}`)
+
+	//get returns the version in ETag
+	httpRes, res := do(t, svc, http.MethodGet, "/account/1", "")
+	expectStatus(t, "get", httpRes, res, http.StatusOK, "")
+	var account Account
+	if err := json.Unmarshal(res.Data, &account); err != nil {
+		t.Fatalf("got %s: %v", res.Data, err)
+	}
+	etag := httpRes.Header().Get("ETag")
+	if etag != `"1"` || account.Version.Version != 1 {
+		t.Fatalf("got version %d with ETag:%s", account.Version.Version, etag)
+	}
+
+	//stale If-Match fails and changes nothing
+	stale := `"0"`
+	httpRes, res = do(t, svc, http.MethodPut, "/account/1", `{"Name":"two"}`, "If-Match", stale)
+	expectStatus(t, "replace stale", httpRes, res, http.StatusPreconditionFailed, "CONFLICT")
+	httpRes, res = do(t, svc, http.MethodPatch, "/account/1", `{"Name":"two"}`, "If-Match", stale)
+	expectStatus(t, "patch stale", httpRes, res, http.StatusPreconditionFailed, "CONFLICT")
+	httpRes, res = do(t, svc, http.MethodPatch, "/account/1", `{}`, "If-Match", stale)
+	expectStatus(t, "patch nothing stale", httpRes, res, http.StatusPreconditionFailed, "CONFLICT")
+	httpRes, res = do(t, svc, http.MethodDelete, "/account/1", "", "If-Match", stale)
+	expectStatus(t, "delete stale", httpRes, res, http.StatusPreconditionFailed, "CONFLICT")
+	httpRes, res = do(t, svc, http.MethodPut, "/account/1", `{"Name":"two"}`, "If-Match", "1")
+	expectStatus(t, "replace unquoted", httpRes, res, http.StatusPreconditionFailed, "CONFLICT")
+	if httpRes, _ = do(t, svc, http.MethodGet, "/account/1", ""); httpRes.Header().Get("ETag") != etag {
+		t.Fatalf("ETag:%s after failed changes", httpRes.Header().Get("ETag"))
+	}
+
+	//matching If-Match changes the item and returns the new version
+	httpRes, res = do(t, svc, http.MethodPatch, "/account/1", `{}`, "If-Match", etag)
+	expectStatus(t, "patch nothing", httpRes, res, http.StatusOK, "")
+	httpRes, res = do(t, svc, http.MethodPut, "/account/1", `{"Name":"two"}`, "If-Match", etag)
+	expectStatus(t, "replace", httpRes, res, http.StatusOK, "")
+	if httpRes.Header().Get("ETag") != `"2"` {
+		t.Fatalf("replaced with ETag:%s", httpRes.Header().Get("ETag"))
+	}
+
+	//without If-Match, a stale version in the body conflicts
+	httpRes, res = do(t, svc, http.MethodPut, "/account/1", `{"Name":"three","Version":1}`)
+	expectStatus(t, "replace stale body", httpRes, res, http.StatusConflict, "CONFLICT")
+	httpRes, res = do(t, svc, http.MethodPut, "/account/1", `{"Name":"three"}`)
+	expectStatus(t, "replace without version", httpRes, res, http.StatusOK, "")
+
+	httpRes, res = do(t, svc, http.MethodDelete, "/account/1", "", "If-Match", `"3"`)
+	expectStatus(t, "delete", httpRes, res, http.StatusOK, "")
+
+	//items without a version never match
+	svc, _ = newService(t, dbtest.Location{})
+	do(t, svc, http.MethodPost, "/location", `{"Name":"one"}`)
+	if httpRes, _ = do(t, svc, http.MethodGet, "/location/1", ""); httpRes.Header().Get("ETag") != "" {
+		t.Fatalf("unversioned item with ETag:%s", httpRes.Header().Get("ETag"))
+	}
+	httpRes, res = do(t, svc, http.MethodPut, "/location/1", `{"Name":"two"}`, "If-Match", `"1"`)
+	expectStatus(t, "replace unversioned", httpRes, res, http.StatusPreconditionFailed, "CONFLICT")
+	httpRes, res = do(t, svc, http.MethodDelete, "/location/1", "", "If-Match", `"1"`)
+	expectStatus(t, "delete unversioned", httpRes, res, http.StatusPreconditionFailed, "CONFLICT")
+	httpRes, res = do(t, svc, http.MethodDelete, "/location/1", "", "If-Match", "*")
+	expectStatus(t, "delete any version", httpRes, res, http.StatusOK, "")
+}
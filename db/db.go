@@ -1,13 +1,18 @@
 package db
 
 import (
+	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/go-msvc/msf/config"
+	"github.com/go-msvc/msf/logger"
 	"github.com/go-msvc/msf/model"
 )
 
+var log = logger.New("msf").New("db")
+
 type IDatabaseConstructor interface {
 	Create() (IDatabase, error)
 }
@@ -18,18 +23,103 @@ type IDatabase interface {
 	//adding the item model to the db, will create a table if necessary or verify the existing
 	//table is suitable for use
 	AddTable(mi model.IItem) (ITable, error)
+
+	//start a transaction on the tables added to the db, see also WithTx()
+	Begin(ctx context.Context) (ITx, IError)
+
+	//check the db can be reached, e.g. in a health endpoint, else ERR_CONNECTION
+	Ping(ctx context.Context) IError
+
+	//connection pool statistics
+	Stats() Stats
+}
+
+//Stats of the connection pool, as in sql.DBStats
+//backends without connections return zero values
+type Stats struct {
+	MaxOpenConnections int           `json:"max_open_connections"`
+	OpenConnections    int           `json:"open_connections"` //in use + idle
+	InUse              int           `json:"in_use"`
+	Idle               int           `json:"idle"`
+	WaitCount          int64         `json:"wait_count"`    //nr of times a connection was not immediately available
+	WaitDuration       time.Duration `json:"wait_duration"` //total time waited for connections
+	MaxIdleClosed      int64         `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64         `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64         `json:"max_lifetime_closed"`
 }
 
 //table storing one type of item
 type ITable interface {
 	Model() model.IItem
 	Name() string
-	Add(item interface{}) (id int64, err IError)
+	Add(item interface{}) (id int64, err IError) //if the item fails model validation: ERR_INVALID, see Validate()
 	GetById(id int64) (item interface{}, err IError)
 	GetOneByKey(key map[string]interface{}) (item interface{}, err IError)             //if >1: nil, ERR_FOUND_MANY; if 0: nil, ERR_NOT_FOUND
 	GetByKey(key map[string]interface{}, limit int64) (item []interface{}, err IError) //if not found: nil, ERR_NOT_FOUND
-	Upd(item interface{}) IError
-	DelById(id int64) IError
+	GetOneByFilter(filter Filter) (item interface{}, err IError)                       //same as GetOneByKey with nil filter matching all items
+	GetByFilter(filter Filter, limit int64) (item []interface{}, err IError)           //same as GetByKey with nil filter matching all items
+	Query(filter Filter, options QueryOptions) (Page, IError)                          //ordered page of items, not found is an empty page
+	Upd(item interface{}, fieldNames ...string) IError                                 //update fields (default all, see UpdFields()) of item with item.ID, if not found: ERR_NOT_FOUND, if the updated fields are invalid: ERR_INVALID, if item.Version is not stored: ERR_CONFLICT
+	DelById(id int64) IError                                                           //if not found: ERR_NOT_FOUND, if referenced by other items: ERR_FOREIGN_KEY, see also Purge()
+
+	//AddMany adds all items, or none when one fails, with multi-row inserts where supported
+	//returns the ids in the order of the items
+	AddMany(items []interface{}) (ids []int64, err IError)
+
+	//Upsert adds the item, or when another item has the same values in the named uniq set,
+	//updates that item with the other fields and returns its id
+	//fields that are NULL and have a default keep the existing value on update
+	//a conflict with another uniq set fails with ERR_DUPLICATE_KEY without changing any item
+	Upsert(item interface{}, conflictUniqSet string) (id int64, err IError)
+
+	//Include replaces the items with copies that have the named references loaded, e.g. "location" loads
+	//all of Stock.Location rather than only its ID, and "location.region" also loads the location's region
+	//names are reference field names with or without "_id", or names of many-to-many relations, e.g. "categories"
+	//loads the linked items into the slice, if unknown: ERR_KEY_FIELD_UNKNOWN
+	Include(items []interface{}, include ...string) IError
+
+	//QueryByRef is the reverse of a reference: a page of the items that refer to the item with refId,
+	//e.g. stockTable.QueryByRef("location", locationId, options) for all stock in a location
+	QueryByRef(refName string, refId int64, options QueryOptions) (Page, IError)
+
+	//Link adds links in a many-to-many relation, i.e. a slice of items stored in a join table,
+	//e.g. stockTable.Link(stockId, "categories", categoryId), links that exist are kept
+	//the linked items are read with Include(), e.g. Include(items, "categories")
+	//if the relation is unknown: ERR_KEY_FIELD_UNKNOWN, if an item does not exist: ERR_FOREIGN_KEY
+	Link(id int64, relation string, refIds ...int64) IError
+
+	//Unlink removes links in a many-to-many relation, or all links of the item when no refIds are specified
+	Unlink(id int64, relation string, refIds ...int64) IError
+
+	//Restore undoes DelById() of an item with model.SoftDelete, if not deleted: ERR_NOT_FOUND,
+	//if the item has no soft delete: ERR_KEY_FIELD_UNKNOWN
+	Restore(id int64) IError
+
+	//Purge removes the item from the db, also when it was soft deleted, and DelById() only sets deleted_at
+	//if not found: ERR_NOT_FOUND, if referenced by other items: ERR_FOREIGN_KEY
+	Purge(id int64) IError
+
+	//same as the above with a context that cancels the operation when done, then ERR_CANCELED
+	//the above use context.Background()
+	//soft deleted items are hidden unless the context is made with WithDeleted()
+	//DelById, Restore and Purge check the item version when the context is made with IfVersion()
+	AddContext(ctx context.Context, item interface{}) (id int64, err IError)
+	GetByIdContext(ctx context.Context, id int64) (item interface{}, err IError)
+	GetOneByKeyContext(ctx context.Context, key map[string]interface{}) (item interface{}, err IError)
+	GetByKeyContext(ctx context.Context, key map[string]interface{}, limit int64) (item []interface{}, err IError)
+	GetOneByFilterContext(ctx context.Context, filter Filter) (item interface{}, err IError)
+	GetByFilterContext(ctx context.Context, filter Filter, limit int64) (item []interface{}, err IError)
+	QueryContext(ctx context.Context, filter Filter, options QueryOptions) (Page, IError)
+	UpdContext(ctx context.Context, item interface{}, fieldNames ...string) IError
+	DelByIdContext(ctx context.Context, id int64) IError
+	AddManyContext(ctx context.Context, items []interface{}) (ids []int64, err IError)
+	UpsertContext(ctx context.Context, item interface{}, conflictUniqSet string) (id int64, err IError)
+	IncludeContext(ctx context.Context, items []interface{}, include ...string) IError
+	QueryByRefContext(ctx context.Context, refName string, refId int64, options QueryOptions) (Page, IError)
+	LinkContext(ctx context.Context, id int64, relation string, refIds ...int64) IError
+	UnlinkContext(ctx context.Context, id int64, relation string, refIds ...int64) IError
+	RestoreContext(ctx context.Context, id int64) IError
+	PurgeContext(ctx context.Context, id int64) IError
 }
 
 type Key map[string]interface{}
@@ -54,6 +144,17 @@ func Open(name string) (IDatabase, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to open db(%s): %v", name, err)
 	}
+
+	//apply migrations registered for this db
+	migratorsMutex.Lock()
+	m, ok := migrators[name]
+	migratorsMutex.Unlock()
+	if ok {
+		if err := m.Up(db); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to migrate db(%s): %v", name, err)
+		}
+	}
 	return db, nil
 }
 
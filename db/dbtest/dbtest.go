@@ -0,0 +1,376 @@
+//Package dbtest has tests that any db.IDatabase implementation must pass
+//to behave the same as the other backends, e.g. in the backend's tests:
+//	func TestConformance(t *testing.T) {
+//		dbtest.RunConformance(t, func() db.IDatabase { return Config{...}.MustCreate() })
+//	}
+package dbtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-msvc/msf/db"
+	"github.com/go-msvc/msf/model"
+)
+
+//sample items stored in tables "location" and "stock"
+type Location struct {
+	model.Item
+	Name string `uniq:"name"`
+	Code string `db:"size=8"`
+}
+
+type Stock struct {
+	model.Item
+	Name string `uniq:"name"`
+	Location
+	Qty  int
+	Note *string `db:"size=64"`
+}
+
+//sample items with relations stored in tables "category" and "product",
+//with join table "product_categories" and child table "product_tags"
+type Category struct {
+	model.Item
+	Name string `uniq:"name"`
+}
+
+type Product struct {
+	model.Item
+	Name       string `uniq:"name" validate:"required,max=32"`
+	Categories []Category
+	Tags       []string `db:"table,size=32" validate:"max=5"`
+}
+
+//sample item with timestamps, soft delete and version stored in table "note"
+type Note struct {
+	model.Item
+	model.Timestamps
+	model.SoftDelete
+	model.Version
+	Text string `uniq:"text"`
+	Location
+}
+
+//sample item with two uniq sets stored in table "account"
+type Account struct {
+	model.Item
+	Name    string `uniq:"name"`
+	Email   string `uniq:"email"`
+	Balance int
+}
+
+//TableNames are the tables created by the tests, referenced tables first
+var TableNames = []string{"location", "stock", "category", "product", "product_categories", "product_tags", "note", "account"}
+
+//RunConformance runs each test on a new db from newDb, which must not have the TableNames yet
+//it covers all ITable methods, their error codes, transactions and concurrent use
+func RunConformance(t *testing.T, newDb func() db.IDatabase) {
+	for _, test := range []struct {
+		name string
+		fnc  func(t *testing.T, tables conformanceTables)
+	}{
+		{"Table", testTable},
+		{"Add", testAdd},
+		{"Uniq", testUniq},
+		{"Ref", testRef},
+		{"GetOne", testGetOne},
+		{"GetMany", testGetMany},
+		{"Filter", testFilter},
+		{"Query", testQuery},
+		{"QueryCursor", testQueryCursor},
+		{"QueryCursorTime", testQueryCursorTime},
+		{"Upd", testUpd},
+		{"Del", testDel},
+		{"AddMany", testAddMany},
+		{"Upsert", testUpsert},
+		{"Include", testInclude},
+		{"Relations", testRelations},
+		{"Link", testLink},
+		{"Validate", testValidate},
+		{"Timestamps", testTimestamps},
+		{"SoftDelete", testSoftDelete},
+		{"Version", testVersion},
+		{"Context", testContext},
+		{"Tx", testTx},
+		{"ConcurrentAdd", testConcurrentAdd},
+		{"ConcurrentUniq", testConcurrentUniq},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			d := newDb()
+			defer d.Close()
+			test.fnc(t, newTables(t, d))
+		})
+	}
+}
+
+type conformanceTables struct {
+	db       db.IDatabase
+	location db.ITable
+	stock    db.ITable
+	category db.ITable
+	product  db.ITable
+	note     db.ITable
+	account  db.ITable
+}
+
+func newTables(t *testing.T, d db.IDatabase) conformanceTables {
+	m := model.New()
+	locationModel := m.MustAdd(Location{})
+	stockModel := m.MustAdd(Stock{})
+	tables := conformanceTables{db: d}
+	var err error
+	if tables.location, err = d.AddTable(locationModel); err != nil {
+		t.Fatalf("failed to add table(location): %v", err)
+	}
+	if tables.stock, err = d.AddTable(stockModel); err != nil {
+		t.Fatalf("failed to add table(stock): %v", err)
+	}
+	if tables.category, err = d.AddTable(m.MustAdd(Category{})); err != nil {
+		t.Fatalf("failed to add table(category): %v", err)
+	}
+	if tables.product, err = d.AddTable(m.MustAdd(Product{})); err != nil {
+		t.Fatalf("failed to add table(product): %v", err)
+	}
+	if tables.note, err = d.AddTable(m.MustAdd(Note{})); err != nil {
+		t.Fatalf("failed to add table(note): %v", err)
+	}
+	if tables.account, err = d.AddTable(m.MustAdd(Account{})); err != nil {
+		t.Fatalf("failed to add table(account): %v", err)
+	}
+	return tables
+}
+
+//expect fails the test if err does not have the code
+func expect(t *testing.T, what string, err db.IError, code db.ErrorCode) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("%s did not fail with %s", what, db.ErrorName[code])
+	}
+	if err.Code() != code {
+		t.Fatalf("%s failed with %s instead of %s: %v", what, db.ErrorName[err.Code()], db.ErrorName[code], err)
+	}
+}
+
+func mustAdd(t *testing.T, table db.ITable, item interface{}) int64 {
+	t.Helper()
+	id, err := table.Add(item)
+	if err != nil {
+		t.Fatalf("failed to add %s %+v: %v", table.Name(), item, err)
+	}
+	return id
+}
+
+func testTable(t *testing.T, tables conformanceTables) {
+	if tables.location.Name() != "location" || tables.location.Model().Name() != "location" {
+		t.Fatalf("table name %s, model name %s instead of location", tables.location.Name(), tables.location.Model().Name())
+	}
+	if _, err := tables.db.AddTable(tables.location.Model()); err == nil {
+		t.Fatalf("added table(location) twice")
+	}
+	if err := tables.db.Ping(context.Background()); err != nil {
+		t.Fatalf("ping failed: %v", err)
+	}
+	if stats := tables.db.Stats(); stats.InUse < 0 || stats.OpenConnections < stats.InUse {
+		t.Fatalf("stats %+v", stats)
+	}
+}
+
+func testAdd(t *testing.T, tables conformanceTables) {
+	id1 := mustAdd(t, tables.location, Location{Name: "one", Code: "1"})
+	id2 := mustAdd(t, tables.location, Location{Name: "two", Code: "2"})
+	if id1 < 1 || id2 <= id1 {
+		t.Fatalf("ids %d,%d are not increasing from 1", id1, id2)
+	}
+	item, err := tables.location.GetById(id2)
+	if err != nil {
+		t.Fatalf("failed to get location(%d): %v", id2, err)
+	}
+	location, ok := item.(Location)
+	if !ok || location.ID != id2 || location.Name != "two" || location.Code != "2" {
+		t.Fatalf("got (%T)%+v instead of location two", item, item)
+	}
+	_, err = tables.location.GetById(id2 + 1)
+	expect(t, "get unknown id", err, db.ERR_NOT_FOUND)
+	_, err = tables.location.Add(Stock{Name: "wrong"})
+	expect(t, "add wrong type", err, db.ERR_INSERT_WRONG_TYPE)
+	_, err = tables.location.Add(&Location{Name: "pointer"})
+	expect(t, "add pointer", err, db.ERR_INSERT_WRONG_TYPE)
+
+	//own id of the added item is ignored
+	id3 := mustAdd(t, tables.location, Location{Item: model.Item{ID: id1}, Name: "three"})
+	if id3 == id1 || id3 == id2 {
+		t.Fatalf("add with id=%d got existing id=%d", id1, id3)
+	}
+
+	//nullable field
+	note := "fragile"
+	locationId := mustAdd(t, tables.location, Location{Name: "four"})
+	stockId := mustAdd(t, tables.stock, Stock{Name: "box", Location: Location{Item: model.Item{ID: locationId}}, Note: &note})
+	item, err = tables.stock.GetById(stockId)
+	if err != nil || item.(Stock).Note == nil || *item.(Stock).Note != note {
+		t.Fatalf("get stock with note: %+v, %v", item, err)
+	}
+	stockId = mustAdd(t, tables.stock, Stock{Name: "bag", Location: Location{Item: model.Item{ID: locationId}}})
+	item, err = tables.stock.GetById(stockId)
+	if err != nil || item.(Stock).Note != nil {
+		t.Fatalf("get stock without note: %+v, %v", item, err)
+	}
+}
+
+func testUniq(t *testing.T, tables conformanceTables) {
+	mustAdd(t, tables.location, Location{Name: "one", Code: "1"})
+	_, err := tables.location.Add(Location{Name: "one", Code: "2"})
+	expect(t, "add duplicate name", err, db.ERR_DUPLICATE_KEY)
+	mustAdd(t, tables.location, Location{Name: "two", Code: "1"})
+}
+
+func testRef(t *testing.T, tables conformanceTables) {
+	locationId := mustAdd(t, tables.location, Location{Name: "one"})
+	_, err := tables.stock.Add(Stock{Name: "nowhere", Location: Location{Item: model.Item{ID: locationId + 1}}})
+	expect(t, "add stock in unknown location", err, db.ERR_FOREIGN_KEY)
+	stockId := mustAdd(t, tables.stock, Stock{Name: "box", Location: Location{Item: model.Item{ID: locationId}}, Qty: 3})
+	item, err := tables.stock.GetById(stockId)
+	if err != nil {
+		t.Fatalf("failed to get stock(%d): %v", stockId, err)
+	}
+	if stock := item.(Stock); stock.Location.ID != locationId || stock.Qty != 3 {
+		t.Fatalf("got %+v instead of 3 in location(%d)", stock, locationId)
+	}
+	expect(t, "delete referenced location", tables.location.DelById(locationId), db.ERR_FOREIGN_KEY)
+}
+
+func testGetOne(t *testing.T, tables conformanceTables) {
+	mustAdd(t, tables.location, Location{Name: "one", Code: "x"})
+	mustAdd(t, tables.location, Location{Name: "two", Code: "x"})
+	item, err := tables.location.GetOneByKey(db.Key{"name": "two"})
+	if err != nil || item.(Location).Name != "two" {
+		t.Fatalf("get one by name: %+v, %v", item, err)
+	}
+	_, err = tables.location.GetOneByKey(db.Key{"code": "x"})
+	expect(t, "get one of two", err, db.ERR_QUERY_ONE_HAS_MORE)
+	_, err = tables.location.GetOneByKey(db.Key{"name": "three"})
+	expect(t, "get one unknown", err, db.ERR_NOT_FOUND)
+	_, err = tables.location.GetOneByKey(db.Key{"unknown": "x"})
+	expect(t, "get one by unknown field", err, db.ERR_KEY_FIELD_UNKNOWN)
+
+	item, err = tables.location.GetOneByFilter(db.And{db.Eq("code", "x"), db.Ne("name", "two")})
+	if err != nil || item.(Location).Name != "one" {
+		t.Fatalf("get one by filter: %+v, %v", item, err)
+	}
+	_, err = tables.location.GetOneByFilter(nil)
+	expect(t, "get one of all", err, db.ERR_QUERY_ONE_HAS_MORE)
+	_, err = tables.location.GetOneByFilter(db.Eq("code", "y"))
+	expect(t, "get one by filter unknown", err, db.ERR_NOT_FOUND)
+}
+
+func testGetMany(t *testing.T, tables conformanceTables) {
+	for _, name := range []string{"a", "b", "c"} {
+		mustAdd(t, tables.location, Location{Name: name, Code: "x"})
+	}
+	items, err := tables.location.GetByKey(db.Key{"code": "x"}, 10)
+	if err != nil || len(items) != 3 {
+		t.Fatalf("get by key: %d items, %v", len(items), err)
+	}
+	items, err = tables.location.GetByKey(db.Key{"code": "x"}, 2)
+	if err != nil || len(items) != 2 {
+		t.Fatalf("get by key limit 2: %d items, %v", len(items), err)
+	}
+	_, err = tables.location.GetByKey(db.Key{"code": "x"}, 0)
+	expect(t, "get by key limit 0", err, db.ERR_NOT_FOUND)
+	_, err = tables.location.GetByKey(db.Key{"code": "y"}, 10)
+	expect(t, "get by unknown key", err, db.ERR_NOT_FOUND)
+	_, err = tables.location.GetByKey(db.Key{"unknown": "x"}, 10)
+	expect(t, "get by unknown field", err, db.ERR_KEY_FIELD_UNKNOWN)
+
+	items, err = tables.location.GetByFilter(nil, 10)
+	if err != nil || len(items) != 3 {
+		t.Fatalf("get all: %d items, %v", len(items), err)
+	}
+	if _, ok := items[0].(Location); !ok {
+		t.Fatalf("got %T instead of Location", items[0])
+	}
+	_, err = tables.location.GetByFilter(db.Eq("name", "d"), 10)
+	expect(t, "get by filter unknown", err, db.ERR_NOT_FOUND)
+}
+
+func testUpd(t *testing.T, tables conformanceTables) {
+	id := mustAdd(t, tables.location, Location{Name: "one", Code: "1"})
+	mustAdd(t, tables.location, Location{Name: "two", Code: "2"})
+	if err := tables.location.Upd(Location{Item: model.Item{ID: id}, Name: "uno", Code: "u"}, "code"); err != nil {
+		t.Fatalf("failed to update code: %v", err)
+	}
+	item, err := tables.location.GetById(id)
+	if err != nil || item.(Location).Name != "one" || item.(Location).Code != "u" {
+		t.Fatalf("updated only code: %+v, %v", item, err)
+	}
+	expect(t, "update to duplicate name", tables.location.Upd(Location{Item: model.Item{ID: id}, Name: "two"}), db.ERR_DUPLICATE_KEY)
+	expect(t, "update unknown id", tables.location.Upd(Location{Item: model.Item{ID: id + 10}, Name: "ten"}), db.ERR_NOT_FOUND)
+	expect(t, "update unknown field", tables.location.Upd(Location{Item: model.Item{ID: id}}, "unknown"), db.ERR_KEY_FIELD_UNKNOWN)
+	expect(t, "update own id", tables.location.Upd(Location{Item: model.Item{ID: id}}, "location_id"), db.ERR_KEY_FIELD_UNKNOWN)
+	expect(t, "update wrong type", tables.location.Upd(Stock{Item: model.Item{ID: id}}), db.ERR_INSERT_WRONG_TYPE)
+
+	//update all fields, including a reference
+	location2 := mustAdd(t, tables.location, Location{Name: "three"})
+	stockId := mustAdd(t, tables.stock, Stock{Name: "box", Location: Location{Item: model.Item{ID: id}}, Qty: 1})
+	if err := tables.stock.Upd(Stock{Item: model.Item{ID: stockId}, Name: "crate", Location: Location{Item: model.Item{ID: location2}}, Qty: 2}); err != nil {
+		t.Fatalf("failed to update stock: %v", err)
+	}
+	item, err = tables.stock.GetById(stockId)
+	if err != nil || item.(Stock).Name != "crate" || item.(Stock).Location.ID != location2 || item.(Stock).Qty != 2 {
+		t.Fatalf("updated stock: %+v, %v", item, err)
+	}
+	expect(t, "update to unknown reference",
+		tables.stock.Upd(Stock{Item: model.Item{ID: stockId}, Location: Location{Item: model.Item{ID: location2 + 10}}}, "location_id"),
+		db.ERR_FOREIGN_KEY)
+
+	//location is no longer referenced after the update
+	if err := tables.location.DelById(id); err != nil {
+		t.Fatalf("failed to delete location that is no longer referenced: %v", err)
+	}
+}
+
+func testDel(t *testing.T, tables conformanceTables) {
+	id := mustAdd(t, tables.location, Location{Name: "one"})
+	if err := tables.location.DelById(id); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	_, err := tables.location.GetById(id)
+	expect(t, "get deleted", err, db.ERR_NOT_FOUND)
+	expect(t, "delete deleted", tables.location.DelById(id), db.ERR_NOT_FOUND)
+}
+
+//operations with a canceled context fail with ERR_CANCELED and change nothing
+func testContext(t *testing.T, tables conformanceTables) {
+	ctx, cancel := context.WithCancel(context.Background())
+	id, err := tables.location.AddContext(ctx, Location{Name: "one"})
+	if err != nil {
+		t.Fatalf("failed to add with context: %v", err)
+	}
+	if item, err := tables.location.GetByIdContext(ctx, id); err != nil || item.(Location).Name != "one" {
+		t.Fatalf("get with context: %+v, %v", item, err)
+	}
+	cancel()
+
+	_, err = tables.location.AddContext(ctx, Location{Name: "two"})
+	expect(t, "add canceled", err, db.ERR_CANCELED)
+	_, err = tables.location.GetByIdContext(ctx, id)
+	expect(t, "get canceled", err, db.ERR_CANCELED)
+	_, err = tables.location.GetOneByKeyContext(ctx, db.Key{"name": "one"})
+	expect(t, "get one by key canceled", err, db.ERR_CANCELED)
+	_, err = tables.location.GetByKeyContext(ctx, db.Key{"name": "one"}, 10)
+	expect(t, "get by key canceled", err, db.ERR_CANCELED)
+	_, err = tables.location.GetOneByFilterContext(ctx, nil)
+	expect(t, "get one by filter canceled", err, db.ERR_CANCELED)
+	_, err = tables.location.GetByFilterContext(ctx, nil, 10)
+	expect(t, "get by filter canceled", err, db.ERR_CANCELED)
+	_, err = tables.location.QueryContext(ctx, nil, db.QueryOptions{Limit: 10, WithTotal: true})
+	expect(t, "query canceled", err, db.ERR_CANCELED)
+	expect(t, "update canceled", tables.location.UpdContext(ctx, Location{Item: model.Item{ID: id}, Name: "changed"}), db.ERR_CANCELED)
+	expect(t, "delete canceled", tables.location.DelByIdContext(ctx, id), db.ERR_CANCELED)
+
+	if names := filteredNames(t, tables.location, nil); names != "one" {
+		t.Fatalf("canceled operations changed the table to %s", names)
+	}
+}
@@ -0,0 +1,96 @@
+package dbtest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/go-msvc/msf/db"
+	"github.com/go-msvc/msf/model"
+)
+
+//location names of stock items, "-" when not loaded
+func locationNames(items []interface{}) string {
+	s := ""
+	for i, item := range items {
+		if i > 0 {
+			s += ","
+		}
+		if name := item.(Stock).Location.Name; name != "" {
+			s += name
+		} else {
+			s += "-"
+		}
+	}
+	return s
+}
+
+func testInclude(t *testing.T, tables conformanceTables) {
+	l1 := mustAdd(t, tables.location, Location{Name: "one", Code: "1"})
+	l2 := mustAdd(t, tables.location, Location{Name: "two", Code: "2"})
+	mustAdd(t, tables.location, Location{Name: "empty"})
+	for i, l := range []int64{l1, l1, l2} {
+		mustAdd(t, tables.stock, Stock{Name: fmt.Sprintf("s%d", i), Location: Location{Item: model.Item{ID: l}}})
+	}
+
+	options := db.QueryOptions{Limit: 10, OrderBy: db.ParseOrder("name")}
+	page, err := tables.stock.Query(nil, options)
+	if err != nil || locationNames(page.Items) != "-,-,-" {
+		t.Fatalf("query without include: %v, %v", locationNames(page.Items), err)
+	}
+	options.Include = []string{"location"}
+	page, err = tables.stock.Query(nil, options)
+	if err != nil || locationNames(page.Items) != "one,one,two" {
+		t.Fatalf("query with include: %v, %v", locationNames(page.Items), err)
+	}
+	if s := page.Items[2].(Stock); s.Location.ID != l2 || s.Location.Code != "2" || s.Name != "s2" {
+		t.Fatalf("included %+v", s)
+	}
+	options.Include = []string{"unknown"}
+	_, err = tables.stock.Query(nil, options)
+	expect(t, "query with unknown include", err, db.ERR_KEY_FIELD_UNKNOWN)
+
+	//include in items from other methods
+	items, err := tables.stock.GetByKey(db.Key{"location_id": l2}, 10)
+	if err != nil {
+		t.Fatalf("get by key: %v", err)
+	}
+	if err := tables.stock.Include(items, "location_id"); err != nil || locationNames(items) != "two" {
+		t.Fatalf("include: %v, %v", locationNames(items), err)
+	}
+	expect(t, "include value field", tables.stock.Include(items, "qty"), db.ERR_KEY_FIELD_UNKNOWN)
+	expect(t, "include nested unknown", tables.stock.Include(items, "location.unknown"), db.ERR_KEY_FIELD_UNKNOWN)
+	if err := tables.stock.Include([]interface{}{}, "location"); err != nil {
+		t.Fatalf("include in no items: %v", err)
+	}
+
+	//reverse lookup
+	page, err = tables.stock.QueryByRef("location", l1, db.QueryOptions{Limit: 10, OrderBy: db.ParseOrder("name"), Include: []string{"location"}})
+	if err != nil || names(page.Items) != "s0,s1" || locationNames(page.Items) != "one,one" {
+		t.Fatalf("query by ref: %s %s, %v", names(page.Items), locationNames(page.Items), err)
+	}
+	page, err = tables.stock.QueryByRef("location_id", l2+1, db.QueryOptions{Limit: 10})
+	if err != nil || len(page.Items) != 0 {
+		t.Fatalf("query by ref without items: %s, %v", names(page.Items), err)
+	}
+	_, err = tables.stock.QueryByRef("name", l1, db.QueryOptions{Limit: 10})
+	expect(t, "query by value field", err, db.ERR_KEY_FIELD_UNKNOWN)
+
+	//in a transaction, referenced items are read in the same transaction
+	txErr := db.WithTx(context.Background(), tables.db, func(tx db.ITx) error {
+		if err := tx.MustTable("location").Upd(Location{Item: model.Item{ID: l2}, Name: "changed"}); err != nil {
+			return err
+		}
+		page, err := tx.MustTable("stock").QueryByRef("location", l2, db.QueryOptions{Limit: 10, Include: []string{"location"}})
+		if err != nil {
+			return err
+		}
+		if locationNames(page.Items) != "changed" {
+			return fmt.Errorf("included %s in transaction", locationNames(page.Items))
+		}
+		return nil
+	})
+	if txErr != nil {
+		t.Fatalf("include in transaction: %v", txErr)
+	}
+} //testInclude()
@@ -0,0 +1,145 @@
+package dbtest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/go-msvc/msf/db"
+	"github.com/go-msvc/msf/model"
+)
+
+//nr of items added with AddMany, more than the default batch size
+const manyItems = 250
+
+func testAddMany(t *testing.T, tables conformanceTables) {
+	ids, err := tables.location.AddMany(nil)
+	if err != nil || len(ids) != 0 {
+		t.Fatalf("add none: %v, %v", ids, err)
+	}
+
+	items := []interface{}{}
+	for i := 0; i < manyItems; i++ {
+		items = append(items, Location{Name: fmt.Sprintf("n%03d", i), Code: fmt.Sprintf("%d", i)})
+	}
+	ids, err = tables.location.AddMany(items)
+	if err != nil {
+		t.Fatalf("failed to add many: %v", err)
+	}
+	if len(ids) != manyItems {
+		t.Fatalf("got %d ids for %d items", len(ids), manyItems)
+	}
+	for i, id := range ids {
+		if i > 0 && id <= ids[i-1] {
+			t.Fatalf("ids not increasing: %v", ids)
+		}
+		item, err := tables.location.GetById(id)
+		if err != nil || item.(Location).Name != fmt.Sprintf("n%03d", i) {
+			t.Fatalf("item[%d] id=%d: %+v, %v", i, id, item, err)
+		}
+	}
+
+	//all or none are added
+	_, err = tables.location.AddMany([]interface{}{Location{Name: "new"}, Stock{Name: "wrong"}})
+	expect(t, "add many with wrong type", err, db.ERR_INSERT_WRONG_TYPE)
+	_, err = tables.location.AddMany([]interface{}{Location{Name: "new"}, Location{Name: "n001"}})
+	expect(t, "add many with existing", err, db.ERR_DUPLICATE_KEY)
+	_, err = tables.location.AddMany([]interface{}{Location{Name: "new"}, Location{Name: "again"}, Location{Name: "again"}})
+	expect(t, "add many with duplicate", err, db.ERR_DUPLICATE_KEY)
+	_, err = tables.stock.AddMany([]interface{}{
+		Stock{Name: "box", Location: Location{Item: model.Item{ID: ids[0]}}},
+		Stock{Name: "nowhere", Location: Location{Item: model.Item{ID: ids[manyItems-1] + 1}}},
+	})
+	expect(t, "add many with unknown reference", err, db.ERR_FOREIGN_KEY)
+	if names := filteredNames(t, tables.location, db.KeyFilter(db.Key{"name": "new"})); names != "" {
+		t.Fatalf("failed add many added %s", names)
+	}
+	if names := filteredNames(t, tables.stock, nil); names != "" {
+		t.Fatalf("failed add many added %s", names)
+	}
+
+	//next ids are after the added items
+	if id := mustAdd(t, tables.location, Location{Name: "after"}); id <= ids[manyItems-1] {
+		t.Fatalf("id %d after add many <= %d", id, ids[manyItems-1])
+	}
+
+	//in a transaction
+	txErr := db.WithTx(context.Background(), tables.db, func(tx db.ITx) error {
+		ids, err := tx.MustTable("stock").AddMany([]interface{}{
+			Stock{Name: "box", Location: Location{Item: model.Item{ID: ids[0]}}, Qty: 1},
+			Stock{Name: "crate", Location: Location{Item: model.Item{ID: ids[1]}}, Qty: 2},
+		})
+		if err != nil {
+			return err
+		}
+		if len(ids) != 2 {
+			return fmt.Errorf("got %d ids for 2 items", len(ids))
+		}
+		return nil
+	})
+	if txErr != nil {
+		t.Fatalf("failed to add many in transaction: %v", txErr)
+	}
+	if names := filteredNames(t, tables.stock, nil); names != "box,crate" {
+		t.Fatalf("stock %s after add many in transaction", names)
+	}
+} //testAddMany()
+
+func testUpsert(t *testing.T, tables conformanceTables) {
+	_, err := tables.location.Upsert(Location{Name: "one"}, "unknown")
+	expect(t, "upsert on unknown uniq set", err, db.ERR_KEY_FIELD_UNKNOWN)
+	_, err = tables.location.Upsert(Stock{Name: "one"}, "name")
+	expect(t, "upsert wrong type", err, db.ERR_INSERT_WRONG_TYPE)
+
+	id1, err := tables.location.Upsert(Location{Name: "one", Code: "1"}, "name")
+	if err != nil {
+		t.Fatalf("failed to upsert new: %v", err)
+	}
+	id2 := mustAdd(t, tables.location, Location{Name: "two", Code: "2"})
+	if id, err := tables.location.Upsert(Location{Name: "one", Code: "11"}, "name"); err != nil || id != id1 {
+		t.Fatalf("upsert existing returned %d, %v instead of %d", id, err, id1)
+	}
+	if item, err := tables.location.GetById(id1); err != nil || item.(Location).Code != "11" {
+		t.Fatalf("upserted item: %+v, %v", item, err)
+	}
+	if id, err := tables.location.Upsert(Location{Name: "two", Code: "2"}, "name"); err != nil || id != id2 {
+		t.Fatalf("upsert unchanged returned %d, %v instead of %d", id, err, id2)
+	}
+	if names := filteredNames(t, tables.location, nil); names != "one,two" {
+		t.Fatalf("locations %s after upsert", names)
+	}
+
+	//references are checked on insert and update
+	stockId, err := tables.stock.Upsert(Stock{Name: "box", Location: Location{Item: model.Item{ID: id1}}, Qty: 1}, "name")
+	if err != nil {
+		t.Fatalf("failed to upsert stock: %v", err)
+	}
+	_, err = tables.stock.Upsert(Stock{Name: "box", Location: Location{Item: model.Item{ID: id2 + 1}}, Qty: 2}, "name")
+	expect(t, "upsert existing with unknown reference", err, db.ERR_FOREIGN_KEY)
+	_, err = tables.stock.Upsert(Stock{Name: "crate", Location: Location{Item: model.Item{ID: id2 + 1}}, Qty: 2}, "name")
+	expect(t, "upsert new with unknown reference", err, db.ERR_FOREIGN_KEY)
+	if id, err := tables.stock.Upsert(Stock{Name: "box", Location: Location{Item: model.Item{ID: id2}}, Qty: 3}, "name"); err != nil || id != stockId {
+		t.Fatalf("upsert existing stock returned %d, %v instead of %d", id, err, stockId)
+	}
+	item, err := tables.stock.GetById(stockId)
+	if err != nil || item.(Stock).Qty != 3 || item.(Stock).Location.ID != id2 {
+		t.Fatalf("upserted stock: %+v, %v", item, err)
+	}
+
+	//a conflict on another uniq set than the specified one fails without changing the other item
+	accountId1 := mustAdd(t, tables.account, Account{Name: "one", Email: "one@test", Balance: 1})
+	accountId2 := mustAdd(t, tables.account, Account{Name: "two", Email: "two@test", Balance: 2})
+	_, err = tables.account.Upsert(Account{Name: "three", Email: "one@test", Balance: 3}, "name")
+	expect(t, "upsert new with duplicate in other uniq set", err, db.ERR_DUPLICATE_KEY)
+	_, err = tables.account.Upsert(Account{Name: "two", Email: "one@test", Balance: 3}, "name")
+	expect(t, "upsert existing with duplicate in other uniq set", err, db.ERR_DUPLICATE_KEY)
+	for id, expected := range map[int64]Account{accountId1: {Name: "one", Email: "one@test", Balance: 1}, accountId2: {Name: "two", Email: "two@test", Balance: 2}} {
+		item, err := tables.account.GetById(id)
+		if err != nil || item.(Account).Name != expected.Name || item.(Account).Email != expected.Email || item.(Account).Balance != expected.Balance {
+			t.Fatalf("account %+v, %v after failed upserts instead of %+v", item, err, expected)
+		}
+	}
+	if id, err := tables.account.Upsert(Account{Name: "two", Email: "three@test", Balance: 3}, "name"); err != nil || id != accountId2 {
+		t.Fatalf("upsert existing account returned %d, %v instead of %d", id, err, accountId2)
+	}
+} //testUpsert()
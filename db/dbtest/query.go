@@ -0,0 +1,230 @@
+package dbtest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-msvc/msf/db"
+	"github.com/go-msvc/msf/model"
+)
+
+//sorted names of items matching the filter, as dbs may return them in any order
+func filteredNames(t *testing.T, table db.ITable, filter db.Filter) string {
+	t.Helper()
+	items, err := table.GetByFilter(filter, 100)
+	if err != nil {
+		if err.Code() == db.ERR_NOT_FOUND {
+			return ""
+		}
+		t.Fatalf("get by filter(%v): %v", filter, err)
+	}
+	list := strings.Split(names(items), ",")
+	sort.Strings(list)
+	return strings.Join(list, ",")
+}
+
+//comma separated names of sample items
+func names(items []interface{}) string {
+	s := ""
+	for i, item := range items {
+		if i > 0 {
+			s += ","
+		}
+		switch v := item.(type) {
+		case Location:
+			s += v.Name
+		case Stock:
+			s += v.Name
+		case Category:
+			s += v.Name
+		case Product:
+			s += v.Name
+		case Note:
+			s += v.Text
+		default:
+			s += fmt.Sprintf("%T", item)
+		}
+	}
+	return s
+}
+
+func testFilter(t *testing.T, tables conformanceTables) {
+	for i, name := range []string{"a1", "a2", "b_1", "b%2", "c"} {
+		mustAdd(t, tables.location, Location{Name: name, Code: fmt.Sprintf("%d", i%2)})
+	}
+	for _, test := range []struct {
+		filter db.Filter
+		names  string
+	}{
+		{db.Eq("code", "1"), "a2,b%2"},
+		{db.Ne("code", "1"), "a1,b_1,c"},
+		{db.Lt("name", "b"), "a1,a2"},
+		{db.Le("name", "a2"), "a1,a2"},
+		{db.Gt("name", "a2"), "b%2,b_1,c"},
+		{db.Ge("name", "c"), "c"},
+		{db.In("name", "a1", "c", "d"), "a1,c"},
+		{db.In("name"), ""},
+		{db.Like("name", "a%"), "a1,a2"},
+		{db.Like("name", "b_2"), "b%2"},
+		{db.Prefix("name", "b_"), "b_1"},
+		{db.Prefix("name", "b%"), "b%2"},
+		{db.And{db.Prefix("name", "a"), db.Eq("code", "0")}, "a1"},
+		{db.Or{db.Eq("name", "c"), db.Eq("code", "1")}, "a2,b%2,c"},
+		{db.And{}, "a1,a2,b%2,b_1,c"},
+		{db.Or{}, ""},
+	} {
+		if got := filteredNames(t, tables.location, test.filter); got != test.names {
+			t.Fatalf("filter %v got \"%s\" instead of \"%s\"", test.filter, got, test.names)
+		}
+	}
+
+	//NULL
+	locationId := mustAdd(t, tables.location, Location{Name: "x"})
+	note := "n"
+	mustAdd(t, tables.stock, Stock{Name: "with", Location: Location{Item: model.Item{ID: locationId}}, Note: &note})
+	mustAdd(t, tables.stock, Stock{Name: "without", Location: Location{Item: model.Item{ID: locationId}}})
+	for _, test := range []struct {
+		filter db.Filter
+		names  string
+	}{
+		{db.IsNull("note"), "without"},
+		{db.NotNull("note"), "with"},
+		{db.Eq("note", nil), "without"},
+		{db.Ne("note", nil), "with"},
+		{db.Ne("note", "x"), "with"}, //comparison with NULL never matches
+		{db.Eq("location_id", locationId), "with,without"},
+	} {
+		if got := filteredNames(t, tables.stock, test.filter); got != test.names {
+			t.Fatalf("filter %v got \"%s\" instead of \"%s\"", test.filter, got, test.names)
+		}
+	}
+
+	_, err := tables.location.GetByFilter(db.Eq("unknown", 1), 10)
+	expect(t, "filter on unknown field", err, db.ERR_KEY_FIELD_UNKNOWN)
+	_, err = tables.location.GetByFilter(db.Eq("name", []int{1}), 10)
+	expect(t, "filter with slice value", err, db.ERR_KEY_FIELD_TYPE)
+	_, err = tables.location.GetByFilter(db.Cond{Field: "name", Op: db.OP_LIKE, Value: 1}, 10)
+	expect(t, "like with int", err, db.ERR_KEY_FIELD_TYPE)
+} //testFilter()
+
+func testQuery(t *testing.T, tables conformanceTables) {
+	for i := 1; i <= 7; i++ {
+		mustAdd(t, tables.location, Location{Name: fmt.Sprintf("n%d", i), Code: fmt.Sprintf("%d", i%3)})
+	}
+	query := func(filter db.Filter, options db.QueryOptions) db.Page {
+		t.Helper()
+		page, err := tables.location.Query(filter, options)
+		if err != nil {
+			t.Fatalf("query(%v, %+v): %v", filter, options, err)
+		}
+		return page
+	}
+
+	//order by code desc then id
+	page := query(nil, db.QueryOptions{OrderBy: db.ParseOrder("-code"), Limit: 3, WithTotal: true})
+	if got := names(page.Items); got != "n2,n5,n1" || page.Total != 7 || page.Next == "" || page.Prev != "" {
+		t.Fatalf("first page: %s total=%d next=%v prev=%v", got, page.Total, page.Next != "", page.Prev != "")
+	}
+	page = query(nil, db.QueryOptions{OrderBy: db.ParseOrder("-code"), Limit: 3, Offset: 3})
+	if got := names(page.Items); got != "n4,n7,n3" || page.Total != -1 || page.Next == "" || page.Prev == "" {
+		t.Fatalf("offset page: %s total=%d next=%v prev=%v", got, page.Total, page.Next != "", page.Prev != "")
+	}
+	page = query(nil, db.QueryOptions{OrderBy: db.ParseOrder("-code"), Limit: 3, Offset: 6})
+	if got := names(page.Items); got != "n6" || page.Next != "" {
+		t.Fatalf("last page: %s next=%v", got, page.Next != "")
+	}
+	page = query(db.Eq("code", "1"), db.QueryOptions{OrderBy: db.ParseOrder("-name"), Limit: 10, WithTotal: true})
+	if got := names(page.Items); got != "n7,n4,n1" || page.Total != 3 || page.Next != "" {
+		t.Fatalf("filtered page: %s total=%d next=%v", got, page.Total, page.Next != "")
+	}
+	page = query(db.Eq("code", "9"), db.QueryOptions{Limit: 10, WithTotal: true})
+	if len(page.Items) != 0 || page.Total != 0 || page.Next != "" || page.Prev != "" {
+		t.Fatalf("empty page: %s total=%d", names(page.Items), page.Total)
+	}
+
+	_, err := tables.location.Query(nil, db.QueryOptions{Limit: 0})
+	expect(t, "query limit 0", err, db.ERR_KEY_FIELD_TYPE)
+	_, err = tables.location.Query(nil, db.QueryOptions{OrderBy: db.ParseOrder("unknown"), Limit: 1})
+	expect(t, "query order by unknown field", err, db.ERR_KEY_FIELD_UNKNOWN)
+	_, err = tables.location.Query(db.Eq("unknown", 1), db.QueryOptions{Limit: 1})
+	expect(t, "query filter on unknown field", err, db.ERR_KEY_FIELD_UNKNOWN)
+} //testQuery()
+
+func testQueryCursor(t *testing.T, tables conformanceTables) {
+	for i := 1; i <= 7; i++ {
+		mustAdd(t, tables.location, Location{Name: fmt.Sprintf("n%d", i), Code: fmt.Sprintf("%d", i%3)})
+	}
+	options := db.QueryOptions{OrderBy: db.ParseOrder("-code"), Limit: 3}
+	pages := []string{"n2,n5,n1", "n4,n7,n3", "n6"}
+
+	//forward with next
+	for i, expected := range pages {
+		page, err := tables.location.Query(nil, options)
+		if err != nil {
+			t.Fatalf("page %d: %v", i, err)
+		}
+		if got := names(page.Items); got != expected || (page.Next == "") != (i == len(pages)-1) || (page.Prev == "") != (i == 0) {
+			t.Fatalf("page %d: %s instead of %s next=%v prev=%v", i, got, expected, page.Next != "", page.Prev != "")
+		}
+		options.Cursor = page.Next
+		if i == 1 {
+			//items added before the cursor do not shift the next page
+			mustAdd(t, tables.location, Location{Name: "n0", Code: "2"})
+		}
+		if i < len(pages)-1 {
+			continue
+		}
+
+		//back with prev
+		for j := i - 1; j >= 0; j-- {
+			options.Cursor = page.Prev
+			if page, err = tables.location.Query(nil, options); err != nil {
+				t.Fatalf("back to page %d: %v", j, err)
+			}
+			expected := pages[j]
+			if j == 0 {
+				expected = "n5,n0,n1" //new item is before n1, so the page ends at n1
+			}
+			if got := names(page.Items); got != expected || page.Next == "" {
+				t.Fatalf("back to page %d: %s instead of %s next=%v", j, got, expected, page.Next != "")
+			}
+		}
+	}
+
+	_, err := tables.location.Query(nil, db.QueryOptions{Limit: 3, Cursor: "not a cursor"})
+	expect(t, "query with invalid cursor", err, db.ERR_INVALID_CURSOR)
+} //testQueryCursor()
+
+//cursor values of time fields must compare as times, not as text in the cursor
+func testQueryCursorTime(t *testing.T, tables conformanceTables) {
+	locationId := mustAdd(t, tables.location, Location{Name: "here"})
+	for i := 1; i <= 5; i++ {
+		time.Sleep(time.Millisecond) //distinct created_at
+		mustAdd(t, tables.note, Note{Text: fmt.Sprintf("n%d", i), Location: Location{Item: model.Item{ID: locationId}}})
+	}
+	options := db.QueryOptions{OrderBy: db.ParseOrder("-" + model.FieldCreatedAt), Limit: 2}
+	pages := []string{"n5,n4", "n3,n2", "n1"}
+	var page db.Page
+	var err error
+	for i, expected := range pages {
+		if page, err = tables.note.Query(nil, options); err != nil {
+			t.Fatalf("page %d: %v", i, err)
+		}
+		if got := names(page.Items); got != expected || (page.Next == "") != (i == len(pages)-1) {
+			t.Fatalf("page %d: %s instead of %s next=%v", i, got, expected, page.Next != "")
+		}
+		options.Cursor = page.Next
+	}
+	for j := len(pages) - 2; j >= 0; j-- {
+		options.Cursor = page.Prev
+		if page, err = tables.note.Query(nil, options); err != nil {
+			t.Fatalf("back to page %d: %v", j, err)
+		}
+		if got := names(page.Items); got != pages[j] {
+			t.Fatalf("back to page %d: %s instead of %s", j, got, pages[j])
+		}
+	}
+} //testQueryCursorTime()
@@ -0,0 +1,214 @@
+package dbtest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-msvc/msf/db"
+	"github.com/go-msvc/msf/model"
+)
+
+//categories of the product, "-" when not loaded
+func categoryNames(item interface{}) string {
+	p := item.(Product)
+	if p.Categories == nil {
+		return "-"
+	}
+	categories := []interface{}{}
+	for _, c := range p.Categories {
+		categories = append(categories, c)
+	}
+	return names(categories)
+}
+
+func mustGetProduct(t *testing.T, table db.ITable, id int64, include ...string) Product {
+	t.Helper()
+	item, err := table.GetById(id)
+	if err != nil {
+		t.Fatalf("get product(%d): %v", id, err)
+	}
+	items := []interface{}{item}
+	if err := table.Include(items, include...); err != nil {
+		t.Fatalf("include %v in product(%d): %v", include, id, err)
+	}
+	return items[0].(Product)
+}
+
+func categoryRef(id int64) Category {
+	return Category{Item: model.Item{ID: id}}
+}
+
+func testRelations(t *testing.T, tables conformanceTables) {
+	if r, ok := tables.product.Model().RelationByName("categories"); !ok || r.Table != "product_categories" || r.RefItem.Name() != "category" {
+		t.Fatalf("relation categories: %+v", r)
+	}
+	c1 := mustAdd(t, tables.category, Category{Name: "c1"})
+	c2 := mustAdd(t, tables.category, Category{Name: "c2"})
+	c3 := mustAdd(t, tables.category, Category{Name: "c3"})
+
+	//values are read with the item, linked items only with include
+	id := mustAdd(t, tables.product, Product{Name: "p1", Categories: []Category{categoryRef(c2), categoryRef(c1), categoryRef(c2)}, Tags: []string{"b", "a", "b"}})
+	p := mustGetProduct(t, tables.product, id)
+	if strings.Join(p.Tags, ",") != "b,a,b" || categoryNames(p) != "-" {
+		t.Fatalf("product: tags %v, categories %s", p.Tags, categoryNames(p))
+	}
+	if p = mustGetProduct(t, tables.product, id, "categories"); categoryNames(p) != "c1,c2" || p.Categories[0].ID != c1 {
+		t.Fatalf("included categories %s", categoryNames(p))
+	}
+	id2 := mustAdd(t, tables.product, Product{Name: "p2"})
+	page, err := tables.product.Query(nil, db.QueryOptions{Limit: 10, OrderBy: db.ParseOrder("name"), Include: []string{"categories"}})
+	if err != nil || names(page.Items) != "p1,p2" || categoryNames(page.Items[0]) != "c1,c2" || categoryNames(page.Items[1]) != "" {
+		t.Fatalf("query with categories: %s, %v", names(page.Items), err)
+	}
+	if tags := page.Items[0].(Product).Tags; strings.Join(tags, ",") != "b,a,b" || page.Items[1].(Product).Tags != nil {
+		t.Fatalf("query tags: %v, %v", tags, page.Items[1].(Product).Tags)
+	}
+	items, err := tables.product.GetByKey(db.Key{"name": "p1"}, 10)
+	if err != nil || strings.Join(items[0].(Product).Tags, ",") != "b,a,b" {
+		t.Fatalf("get by key: %+v, %v", items, err)
+	}
+	expect(t, "include categories.unknown", tables.product.Include(items, "categories.unknown"), db.ERR_KEY_FIELD_UNKNOWN)
+	expect(t, "include values", tables.product.Include(items, "tags"), db.ERR_KEY_FIELD_UNKNOWN)
+
+	//all or nothing is added
+	_, err = tables.product.Add(Product{Name: "p3", Categories: []Category{categoryRef(c1), categoryRef(c3 + 1)}, Tags: []string{"x"}})
+	expect(t, "add with unknown category", err, db.ERR_FOREIGN_KEY)
+	_, err = tables.product.AddMany([]interface{}{Product{Name: "p3", Tags: []string{"x"}}, Product{Name: "p4", Categories: []Category{categoryRef(c3 + 1)}}})
+	expect(t, "add many with unknown category", err, db.ERR_FOREIGN_KEY)
+	if names := filteredNames(t, tables.product, nil); names != "p1,p2" {
+		t.Fatalf("products %s after failed add", names)
+	}
+	ids, err := tables.product.AddMany([]interface{}{Product{Name: "p3", Tags: []string{"x"}}, Product{Name: "p4", Categories: []Category{categoryRef(c3)}, Tags: []string{"y", "z"}}})
+	if err != nil {
+		t.Fatalf("add many: %v", err)
+	}
+	if p = mustGetProduct(t, tables.product, ids[1], "categories"); categoryNames(p) != "c3" || strings.Join(p.Tags, ",") != "y,z" {
+		t.Fatalf("added many: %s, %v", categoryNames(p), p.Tags)
+	}
+
+	//update values by default, and links only when named
+	if err := tables.product.Upd(Product{Item: model.Item{ID: id}, Name: "p1", Categories: []Category{categoryRef(c3)}, Tags: []string{"c"}}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if p = mustGetProduct(t, tables.product, id, "categories"); categoryNames(p) != "c1,c2" || strings.Join(p.Tags, ",") != "c" {
+		t.Fatalf("updated: %s, %v", categoryNames(p), p.Tags)
+	}
+	if err := tables.product.Upd(Product{Item: model.Item{ID: id}, Categories: []Category{categoryRef(c3)}}, "categories", "tags"); err != nil {
+		t.Fatalf("update relations: %v", err)
+	}
+	if p = mustGetProduct(t, tables.product, id, "categories"); p.Name != "p1" || categoryNames(p) != "c3" || p.Tags != nil {
+		t.Fatalf("updated relations: %s %s, %v", p.Name, categoryNames(p), p.Tags)
+	}
+	expect(t, "update unknown relation", tables.product.Upd(Product{Item: model.Item{ID: id}}, "unknown"), db.ERR_KEY_FIELD_UNKNOWN)
+	expect(t, "update relation not found", tables.product.Upd(Product{Item: model.Item{ID: ids[1] + 1}}, "tags"), db.ERR_NOT_FOUND)
+	expect(t, "update with unknown category",
+		tables.product.Upd(Product{Item: model.Item{ID: id}, Name: "changed", Categories: []Category{categoryRef(c3 + 1)}}, "name", "categories"),
+		db.ERR_FOREIGN_KEY)
+	if p = mustGetProduct(t, tables.product, id, "categories"); p.Name != "p1" || categoryNames(p) != "c3" {
+		t.Fatalf("failed update changed %s %s", p.Name, categoryNames(p))
+	}
+
+	//upsert replaces values but not links
+	if upsertId, err := tables.product.Upsert(Product{Name: "p2", Categories: []Category{categoryRef(c1)}, Tags: []string{"u"}}, "name"); err != nil || upsertId != id2 {
+		t.Fatalf("upsert: %d, %v", upsertId, err)
+	}
+	if p = mustGetProduct(t, tables.product, id2, "categories"); categoryNames(p) != "" || strings.Join(p.Tags, ",") != "u" {
+		t.Fatalf("upserted: %s, %v", categoryNames(p), p.Tags)
+	}
+
+	//linked items cannot be deleted, links and values are deleted with the item
+	expect(t, "delete linked category", tables.category.DelById(c3), db.ERR_FOREIGN_KEY)
+	for _, productId := range []int64{id, ids[1]} {
+		if err := tables.product.DelById(productId); err != nil {
+			t.Fatalf("delete product: %v", err)
+		}
+	}
+	if err := tables.category.DelById(c3); err != nil {
+		t.Fatalf("delete unlinked category: %v", err)
+	}
+	id = mustAdd(t, tables.product, Product{Name: "p1"})
+	if p = mustGetProduct(t, tables.product, id, "categories"); categoryNames(p) != "" || p.Tags != nil {
+		t.Fatalf("new product has %s, %v", categoryNames(p), p.Tags)
+	}
+} //testRelations()
+
+func testLink(t *testing.T, tables conformanceTables) {
+	c1 := mustAdd(t, tables.category, Category{Name: "c1"})
+	c2 := mustAdd(t, tables.category, Category{Name: "c2"})
+	c3 := mustAdd(t, tables.category, Category{Name: "c3"})
+	id := mustAdd(t, tables.product, Product{Name: "p1", Categories: []Category{categoryRef(c2)}})
+	id2 := mustAdd(t, tables.product, Product{Name: "p2"})
+
+	if err := tables.product.Link(id, "categories", c3, c1, c2); err != nil {
+		t.Fatalf("link: %v", err)
+	}
+	if p := mustGetProduct(t, tables.product, id, "categories"); categoryNames(p) != "c1,c2,c3" {
+		t.Fatalf("linked %s", categoryNames(p))
+	}
+	if err := tables.product.Link(id, "categories"); err != nil {
+		t.Fatalf("link nothing: %v", err)
+	}
+	expect(t, "link unknown relation", tables.product.Link(id, "tags", c1), db.ERR_KEY_FIELD_UNKNOWN)
+	expect(t, "link unknown category", tables.product.Link(id2, "categories", c1, c3+1), db.ERR_FOREIGN_KEY)
+	expect(t, "link unknown product", tables.product.Link(id2+1, "categories", c1), db.ERR_FOREIGN_KEY)
+	if p := mustGetProduct(t, tables.product, id2, "categories"); categoryNames(p) != "" {
+		t.Fatalf("failed link added %s", categoryNames(p))
+	}
+
+	if err := tables.product.Unlink(id, "categories", c2, c3+1); err != nil {
+		t.Fatalf("unlink: %v", err)
+	}
+	if p := mustGetProduct(t, tables.product, id, "categories"); categoryNames(p) != "c1,c3" {
+		t.Fatalf("unlinked %s", categoryNames(p))
+	}
+	expect(t, "unlink unknown relation", tables.product.Unlink(id, "unknown"), db.ERR_KEY_FIELD_UNKNOWN)
+	if err := tables.product.Unlink(id, "categories"); err != nil {
+		t.Fatalf("unlink all: %v", err)
+	}
+	if p := mustGetProduct(t, tables.product, id, "categories"); categoryNames(p) != "" {
+		t.Fatalf("unlinked all %s", categoryNames(p))
+	}
+
+	//more links than fit in one statement
+	categoryIds := []int64{}
+	for i := 0; i < manyItems; i++ {
+		categoryIds = append(categoryIds, mustAdd(t, tables.category, Category{Name: fmt.Sprintf("n%03d", i)}))
+	}
+	if err := tables.product.Link(id, "categories", categoryIds...); err != nil {
+		t.Fatalf("link many: %v", err)
+	}
+	if p := mustGetProduct(t, tables.product, id, "categories"); len(p.Categories) != manyItems {
+		t.Fatalf("linked %d instead of %d", len(p.Categories), manyItems)
+	}
+	if err := tables.product.Unlink(id, "categories", categoryIds[1:]...); err != nil {
+		t.Fatalf("unlink many: %v", err)
+	}
+	if p := mustGetProduct(t, tables.product, id, "categories"); categoryNames(p) != "n000" {
+		t.Fatalf("unlinked many: %s", categoryNames(p))
+	}
+
+	//in a transaction
+	txErr := db.WithTx(context.Background(), tables.db, func(tx db.ITx) error {
+		if err := tx.MustTable("product").Link(id2, "categories", c1, c2); err != nil {
+			return err
+		}
+		items := []interface{}{}
+		page, err := tx.MustTable("product").Query(nil, db.QueryOptions{Limit: 10, OrderBy: db.ParseOrder("name"), Include: []string{"categories"}})
+		if err != nil {
+			return err
+		}
+		items = append(items, page.Items...)
+		if s := categoryNames(items[0]) + "/" + categoryNames(items[1]); s != "n000/c1,c2" {
+			return fmt.Errorf("linked %s in transaction", s)
+		}
+		return fmt.Errorf("rollback")
+	})
+	if txErr == nil || txErr.Error() != "rollback" {
+		t.Fatalf("link in transaction: %v", txErr)
+	}
+	if p := mustGetProduct(t, tables.product, id2, "categories"); categoryNames(p) != "" {
+		t.Fatalf("rolled back link added %s", categoryNames(p))
+	}
+} //testLink()
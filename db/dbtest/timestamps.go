@@ -0,0 +1,192 @@
+package dbtest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-msvc/msf/db"
+	"github.com/go-msvc/msf/model"
+)
+
+func mustGetNote(t *testing.T, ctx context.Context, table db.ITable, id int64) Note {
+	t.Helper()
+	item, err := table.GetByIdContext(ctx, id)
+	if err != nil {
+		t.Fatalf("get note(%d): %v", id, err)
+	}
+	return item.(Note)
+}
+
+//between is true when t is in [from,to]
+func between(t, from, to time.Time) bool {
+	return !t.Before(from) && !t.After(to)
+}
+
+func testTimestamps(t *testing.T, tables conformanceTables) {
+	ctx := context.Background()
+	locationId := mustAdd(t, tables.location, Location{Name: "here"})
+	longAgo := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	//values in the item are ignored
+	before := db.Now()
+	id := mustAdd(t, tables.note, Note{Timestamps: model.Timestamps{CreatedAt: longAgo, ModifiedAt: longAgo}, SoftDelete: model.SoftDelete{DeletedAt: &longAgo}, Text: "a", Location: Location{Item: model.Item{ID: locationId}}})
+	after := db.Now()
+	n := mustGetNote(t, ctx, tables.note, id)
+	if !between(n.CreatedAt, before, after) || !n.ModifiedAt.Equal(n.CreatedAt) || n.DeletedAt != nil {
+		t.Fatalf("added at %v..%v: created %v modified %v deleted %v", before, after, n.CreatedAt, n.ModifiedAt, n.DeletedAt)
+	}
+	created := n.CreatedAt
+
+	//update sets modified_at, also when only some fields are updated
+	for _, fieldNames := range [][]string{nil, {"text"}} {
+		time.Sleep(time.Millisecond)
+		before = db.Now()
+		n.CreatedAt = longAgo
+		n.Text += "b"
+		if err := tables.note.Upd(n, fieldNames...); err != nil {
+			t.Fatalf("update %v: %v", fieldNames, err)
+		}
+		after = db.Now()
+		n = mustGetNote(t, ctx, tables.note, id)
+		if !n.CreatedAt.Equal(created) || !between(n.ModifiedAt, before, after) {
+			t.Fatalf("updated %v at %v..%v: created %v modified %v", fieldNames, before, after, n.CreatedAt, n.ModifiedAt)
+		}
+	}
+	for _, fieldName := range []string{model.FieldCreatedAt, model.FieldModifiedAt, model.FieldDeletedAt, model.FieldVersion} {
+		expect(t, "update "+fieldName, tables.note.Upd(n, fieldName), db.ERR_KEY_FIELD_UNKNOWN)
+	}
+
+	//upsert keeps created_at of an existing item
+	time.Sleep(time.Millisecond)
+	before = db.Now()
+	if upsertId, err := tables.note.Upsert(Note{Text: n.Text, Location: Location{Item: model.Item{ID: locationId}}}, "text"); err != nil || upsertId != id {
+		t.Fatalf("upsert: %d, %v", upsertId, err)
+	}
+	after = db.Now()
+	if n = mustGetNote(t, ctx, tables.note, id); !n.CreatedAt.Equal(created) || !between(n.ModifiedAt, before, after) {
+		t.Fatalf("upserted at %v..%v: created %v modified %v", before, after, n.CreatedAt, n.ModifiedAt)
+	}
+
+	before = db.Now()
+	ids, err := tables.note.AddMany([]interface{}{
+		Note{Text: "x", Location: Location{Item: model.Item{ID: locationId}}},
+		Note{Timestamps: model.Timestamps{CreatedAt: longAgo}, Text: "y", Location: Location{Item: model.Item{ID: locationId}}},
+	})
+	if err != nil {
+		t.Fatalf("add many: %v", err)
+	}
+	after = db.Now()
+	for _, id := range ids {
+		if n = mustGetNote(t, ctx, tables.note, id); !between(n.CreatedAt, before, after) || !n.ModifiedAt.Equal(n.CreatedAt) {
+			t.Fatalf("added many at %v..%v: created %v modified %v", before, after, n.CreatedAt, n.ModifiedAt)
+		}
+	}
+
+	//timestamps are normal fields in filters and order
+	page, err := tables.note.Query(db.Ge(model.FieldCreatedAt, before), db.QueryOptions{Limit: 10, OrderBy: db.ParseOrder("-created_at,-note_id")})
+	if err != nil || names(page.Items) != "y,x" {
+		t.Fatalf("query created after add many: %s, %v", names(page.Items), err)
+	}
+} //testTimestamps()
+
+func testSoftDelete(t *testing.T, tables conformanceTables) {
+	ctx := context.Background()
+	locationId := mustAdd(t, tables.location, Location{Name: "here"})
+	ids := []int64{}
+	for i := 1; i <= 3; i++ {
+		ids = append(ids, mustAdd(t, tables.note, Note{Text: fmt.Sprintf("n%d", i), Location: Location{Item: model.Item{ID: locationId}}}))
+	}
+
+	//deleted items are hidden
+	before := db.Now()
+	if err := tables.note.DelById(ids[0]); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	after := db.Now()
+	_, err := tables.note.GetById(ids[0])
+	expect(t, "get deleted", err, db.ERR_NOT_FOUND)
+	_, err = tables.note.GetOneByKey(db.Key{"text": "n1"})
+	expect(t, "get deleted by key", err, db.ERR_NOT_FOUND)
+	if names := filteredNames(t, tables.note, nil); names != "n2,n3" {
+		t.Fatalf("notes %s after delete", names)
+	}
+	if page, err := tables.note.Query(nil, db.QueryOptions{Limit: 10, WithTotal: true}); err != nil || page.Total != 2 {
+		t.Fatalf("total %d after delete: %v", page.Total, err)
+	}
+	expect(t, "delete deleted", tables.note.DelById(ids[0]), db.ERR_NOT_FOUND)
+	expect(t, "update deleted", tables.note.Upd(Note{Item: model.Item{ID: ids[0]}, Text: "changed", Location: Location{Item: model.Item{ID: locationId}}}), db.ERR_NOT_FOUND)
+
+	//unless asked for
+	n := mustGetNote(t, db.WithDeleted(ctx), tables.note, ids[0])
+	if n.DeletedAt == nil || !between(*n.DeletedAt, before, after) || n.Text != "n1" {
+		t.Fatalf("deleted at %v..%v: %+v", before, after, n)
+	}
+	page, err := tables.note.QueryContext(db.WithDeleted(ctx), db.NotNull(model.FieldDeletedAt), db.QueryOptions{Limit: 10})
+	if err != nil || names(page.Items) != "n1" {
+		t.Fatalf("query deleted: %s, %v", names(page.Items), err)
+	}
+	if items, err := tables.note.GetByKeyContext(db.WithDeleted(ctx), db.Key{"location_id": locationId}, 10); err != nil || names(items) != "n1,n2,n3" {
+		t.Fatalf("get with deleted: %s, %v", names(items), err)
+	}
+
+	//deleted items keep uniq values and references
+	_, err = tables.note.Add(Note{Text: "n1", Location: Location{Item: model.Item{ID: locationId}}})
+	expect(t, "add uniq value of deleted", err, db.ERR_DUPLICATE_KEY)
+	expect(t, "delete location of deleted", tables.location.DelById(locationId), db.ERR_FOREIGN_KEY)
+
+	if err := tables.note.Restore(ids[0]); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if n = mustGetNote(t, ctx, tables.note, ids[0]); n.DeletedAt != nil || n.Text != "n1" {
+		t.Fatalf("restored %+v", n)
+	}
+	expect(t, "restore not deleted", tables.note.Restore(ids[0]), db.ERR_NOT_FOUND)
+	expect(t, "restore unknown", tables.note.Restore(ids[2]+1), db.ERR_NOT_FOUND)
+	expect(t, "restore without soft delete", tables.location.Restore(locationId), db.ERR_KEY_FIELD_UNKNOWN)
+
+	//upsert restores a deleted item
+	if err := tables.note.DelById(ids[2]); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if id, err := tables.note.Upsert(Note{Text: "n3", Location: Location{Item: model.Item{ID: locationId}}}, "text"); err != nil || id != ids[2] {
+		t.Fatalf("upsert deleted: %d, %v", id, err)
+	}
+	if n = mustGetNote(t, ctx, tables.note, ids[2]); n.DeletedAt != nil {
+		t.Fatalf("upserted %+v", n)
+	}
+
+	//purge removes deleted and other items
+	if err := tables.note.DelById(ids[0]); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	for _, id := range ids {
+		if err := tables.note.Purge(id); err != nil {
+			t.Fatalf("purge: %v", err)
+		}
+	}
+	_, err = tables.note.GetByIdContext(db.WithDeleted(ctx), ids[0])
+	expect(t, "get purged", err, db.ERR_NOT_FOUND)
+	expect(t, "purge purged", tables.note.Purge(ids[0]), db.ERR_NOT_FOUND)
+	if err := tables.location.Purge(locationId); err != nil {
+		t.Fatalf("purge location: %v", err)
+	}
+
+	//in a transaction
+	locationId = mustAdd(t, tables.location, Location{Name: "there"})
+	id := mustAdd(t, tables.note, Note{Text: "tx", Location: Location{Item: model.Item{ID: locationId}}})
+	txErr := db.WithTx(ctx, tables.db, func(tx db.ITx) error {
+		if err := tx.MustTable("note").DelById(id); err != nil {
+			return err
+		}
+		if _, err := tx.MustTable("note").GetById(id); err == nil {
+			return fmt.Errorf("deleted item found in transaction")
+		}
+		return fmt.Errorf("rollback")
+	})
+	if txErr == nil || txErr.Error() != "rollback" {
+		t.Fatalf("delete in transaction: %v", txErr)
+	}
+	mustGetNote(t, ctx, tables.note, id)
+} //testSoftDelete()
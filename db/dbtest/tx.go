@@ -0,0 +1,149 @@
+package dbtest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/go-msvc/msf/db"
+)
+
+func testTx(t *testing.T, tables conformanceTables) {
+	ctx := context.Background()
+
+	//rolled back when the function fails
+	err := db.WithTx(ctx, tables.db, func(tx db.ITx) error {
+		if _, err := tx.MustTable("location").Add(Location{Name: "rolled back"}); err != nil {
+			return err
+		}
+		return fmt.Errorf("fail")
+	})
+	if err == nil || err.Error() != "fail" {
+		t.Fatalf("WithTx returned %v instead of the function error", err)
+	}
+	_, dberr := tables.location.GetOneByKey(db.Key{"name": "rolled back"})
+	expect(t, "get rolled back item", dberr, db.ERR_NOT_FOUND)
+
+	//committed when the function succeeds, with db errors inside the transaction
+	var id int64
+	err = db.WithTx(ctx, tables.db, func(tx db.ITx) error {
+		location := tx.MustTable("location")
+		var dberr db.IError
+		if id, dberr = location.Add(Location{Name: "committed"}); dberr != nil {
+			return dberr
+		}
+		_, dberr = location.GetById(id + 1)
+		expect(t, "get unknown id in transaction", dberr, db.ERR_NOT_FOUND)
+		if _, err := tx.Table("unknown"); err == nil {
+			t.Fatalf("got unknown table in transaction")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithTx failed: %v", err)
+	}
+	if _, dberr := tables.location.GetById(id); dberr != nil {
+		t.Fatalf("committed item not found: %v", dberr)
+	}
+
+	//retried on deadlock, in a new transaction
+	attempts := 0
+	err = db.WithTx(ctx, tables.db, func(tx db.ITx) error {
+		attempts++
+		if _, dberr := tx.MustTable("location").Add(Location{Name: "retried"}); dberr != nil {
+			return dberr
+		}
+		switch attempts {
+		case 1:
+			return db.Errorf(db.ERR_DEADLOCK, "deadlock")
+		case 2:
+			return fmt.Errorf("wrapped: %w", db.Errorf(db.ERR_DEADLOCK, "deadlock"))
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Fatalf("WithTx after %d attempts: %v", attempts, err)
+	}
+	if items, dberr := tables.location.GetByKey(db.Key{"name": "retried"}, 10); dberr != nil || len(items) != 1 {
+		t.Fatalf("retried transaction added %d items: %v", len(items), dberr)
+	}
+
+	//until it gives up
+	attempts = 0
+	err = db.WithTx(ctx, tables.db, func(tx db.ITx) error {
+		attempts++
+		return db.Errorf(db.ERR_DEADLOCK, "deadlock")
+	})
+	if dberr, ok := err.(db.IError); !ok || dberr.Code() != db.ERR_DEADLOCK || attempts != 3 {
+		t.Fatalf("WithTx gave up after %d attempts: %v", attempts, err)
+	}
+
+	//rollback after commit does nothing
+	tx, dberr := tables.db.Begin(ctx)
+	if dberr != nil {
+		t.Fatalf("failed to begin: %v", dberr)
+	}
+	if dberr := tx.Commit(); dberr != nil {
+		t.Fatalf("failed to commit empty transaction: %v", dberr)
+	}
+	if dberr := tx.Rollback(); dberr != nil {
+		t.Fatalf("rollback after commit failed: %v", dberr)
+	}
+} //testTx()
+
+//nr of goroutines in concurrency tests
+const concurrency = 8
+
+func testConcurrentAdd(t *testing.T, tables conformanceTables) {
+	wg := sync.WaitGroup{}
+	ids := make([]int64, concurrency)
+	errs := make([]db.IError, concurrency)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ids[i], errs[i] = tables.location.Add(Location{Name: fmt.Sprintf("n%d", i)})
+		}(i)
+	}
+	wg.Wait()
+	seen := map[int64]bool{}
+	for i := 0; i < concurrency; i++ {
+		if errs[i] != nil {
+			t.Fatalf("concurrent add %d failed: %v", i, errs[i])
+		}
+		if seen[ids[i]] {
+			t.Fatalf("concurrent adds got same id=%d", ids[i])
+		}
+		seen[ids[i]] = true
+	}
+	items, dberr := tables.location.GetByFilter(nil, 100)
+	if dberr != nil || len(items) != concurrency {
+		t.Fatalf("got %d items instead of %d: %v", len(items), concurrency, dberr)
+	}
+}
+
+func testConcurrentUniq(t *testing.T, tables conformanceTables) {
+	wg := sync.WaitGroup{}
+	errs := make([]db.IError, concurrency)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = tables.location.Add(Location{Name: "same", Code: fmt.Sprintf("%d", i)})
+		}(i)
+	}
+	wg.Wait()
+	added := 0
+	for i := 0; i < concurrency; i++ {
+		switch {
+		case errs[i] == nil:
+			added++
+		case errs[i].Code() != db.ERR_DUPLICATE_KEY:
+			t.Fatalf("concurrent add %d failed with %s instead of %s: %v", i, db.ErrorName[errs[i].Code()], db.ErrorName[db.ERR_DUPLICATE_KEY], errs[i])
+		}
+	}
+	if added != 1 {
+		t.Fatalf("added %d items with the same uniq name", added)
+	}
+}
@@ -0,0 +1,52 @@
+package dbtest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-msvc/msf/db"
+	"github.com/go-msvc/msf/model"
+)
+
+//expectInvalid checks that err is ERR_INVALID with the field errors "<field>:<rule>,..."
+func expectInvalid(t *testing.T, what string, err db.IError, fieldRules string) {
+	t.Helper()
+	expect(t, what, err, db.ERR_INVALID)
+	var fieldErrs model.ValidationErrors
+	if !errors.As(err, &fieldErrs) {
+		t.Fatalf("%s error does not wrap model.ValidationErrors: %v", what, err)
+	}
+	s := []string{}
+	for _, e := range fieldErrs {
+		s = append(s, e.Field+":"+e.Rule)
+	}
+	if strings.Join(s, ",") != fieldRules {
+		t.Fatalf("%s failed on %s instead of %s: %v", what, strings.Join(s, ","), fieldRules, err)
+	}
+}
+
+func testValidate(t *testing.T, tables conformanceTables) {
+	_, err := tables.product.Add(Product{Tags: []string{"a", "b", "c", "d", "e", "f"}})
+	expectInvalid(t, "add invalid", err, "name:required,tags:max")
+	_, err = tables.product.Add(Product{Name: strings.Repeat("x", 33)})
+	expectInvalid(t, "add too long", err, "name:max")
+	_, err = tables.product.AddMany([]interface{}{Product{Name: "p1"}, Product{}})
+	expectInvalid(t, "add many with invalid", err, "name:required")
+	_, err = tables.product.Upsert(Product{}, "name")
+	expectInvalid(t, "upsert invalid", err, "name:required")
+	if names := filteredNames(t, tables.product, nil); names != "" {
+		t.Fatalf("added invalid products %s", names)
+	}
+
+	//only the updated fields are validated
+	id := mustAdd(t, tables.product, Product{Name: "p1", Tags: []string{"a"}})
+	expectInvalid(t, "update invalid", tables.product.Upd(Product{Item: model.Item{ID: id}, Tags: []string{"b"}}), "name:required")
+	expectInvalid(t, "update invalid field", tables.product.Upd(Product{Item: model.Item{ID: id}, Name: "p2", Tags: []string{"1", "2", "3", "4", "5", "6"}}, "name", "tags"), "tags:max")
+	if err := tables.product.Upd(Product{Item: model.Item{ID: id}, Tags: []string{"b"}}, "tags"); err != nil {
+		t.Fatalf("update valid field: %v", err)
+	}
+	if p := mustGetProduct(t, tables.product, id); p.Name != "p1" || strings.Join(p.Tags, ",") != "b" {
+		t.Fatalf("updated %s %v", p.Name, p.Tags)
+	}
+} //testValidate()
@@ -0,0 +1,91 @@
+package dbtest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/go-msvc/msf/db"
+	"github.com/go-msvc/msf/model"
+)
+
+func testVersion(t *testing.T, tables conformanceTables) {
+	ctx := context.Background()
+	locationId := mustAdd(t, tables.location, Location{Name: "here"})
+
+	//version in the item is ignored on add
+	id := mustAdd(t, tables.note, Note{Version: model.Version{Version: 7}, Text: "v", Location: Location{Item: model.Item{ID: locationId}}})
+	n := mustGetNote(t, ctx, tables.note, id)
+	if n.Version.Version != 1 {
+		t.Fatalf("added version %d", n.Version.Version)
+	}
+
+	//update increments the version, also when only some fields are updated
+	for i, fieldNames := range [][]string{nil, {"text"}} {
+		n.Text += "v"
+		if err := tables.note.Upd(n, fieldNames...); err != nil {
+			t.Fatalf("update %v: %v", fieldNames, err)
+		}
+		text := n.Text
+		if n = mustGetNote(t, ctx, tables.note, id); n.Version.Version != int64(i+2) || n.Text != text {
+			t.Fatalf("updated %v: %+v", fieldNames, n)
+		}
+	}
+
+	//update of a stale item fails
+	stale := n
+	n.Text = "new"
+	if err := tables.note.Upd(n); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	stale.Text = "stale"
+	expect(t, "update stale", tables.note.Upd(stale), db.ERR_CONFLICT)
+	expect(t, "update stale text", tables.note.Upd(stale, "text"), db.ERR_CONFLICT)
+	if n = mustGetNote(t, ctx, tables.note, id); n.Text != "new" || n.Version.Version != 4 {
+		t.Fatalf("after stale update: %+v", n)
+	}
+	expect(t, "update unknown", tables.note.Upd(Note{Item: model.Item{ID: id + 100}, Version: n.Version, Text: "x", Location: Location{Item: model.Item{ID: locationId}}}), db.ERR_NOT_FOUND)
+
+	//two clients that read the same version: only the first update succeeds
+	conflicts := 0
+	for i := 0; i < 2; i++ {
+		update := n
+		update.Text = fmt.Sprintf("c%d", i)
+		if err := tables.note.Upd(update); err != nil {
+			expect(t, "second update", err, db.ERR_CONFLICT)
+			conflicts++
+		}
+	}
+	if n = mustGetNote(t, ctx, tables.note, id); conflicts != 1 || n.Text != "c0" || n.Version.Version != 5 {
+		t.Fatalf("after updates of the same version: %d conflicts, %+v", conflicts, n)
+	}
+
+	//upsert increments the version of an existing item
+	if upsertId, err := tables.note.Upsert(Note{Text: n.Text, Location: Location{Item: model.Item{ID: locationId}}}, "text"); err != nil || upsertId != id {
+		t.Fatalf("upsert: %d, %v", upsertId, err)
+	}
+	if n = mustGetNote(t, ctx, tables.note, id); n.Version.Version != 6 {
+		t.Fatalf("upserted version %d", n.Version.Version)
+	}
+
+	//delete, restore and purge check the version when asked for
+	expect(t, "delete stale", tables.note.DelByIdContext(db.IfVersion(ctx, 5), id), db.ERR_CONFLICT)
+	if err := tables.note.DelByIdContext(db.IfVersion(ctx, 6), id); err != nil {
+		t.Fatalf("delete version 6: %v", err)
+	}
+	expect(t, "delete deleted", tables.note.DelByIdContext(db.IfVersion(ctx, 7), id), db.ERR_NOT_FOUND)
+	expect(t, "restore stale", tables.note.RestoreContext(db.IfVersion(ctx, 6), id), db.ERR_CONFLICT)
+	if err := tables.note.RestoreContext(db.IfVersion(ctx, 7), id); err != nil {
+		t.Fatalf("restore version 7: %v", err)
+	}
+	expect(t, "purge stale", tables.note.PurgeContext(db.IfVersion(ctx, 7), id), db.ERR_CONFLICT)
+	if err := tables.note.PurgeContext(db.IfVersion(ctx, 8), id); err != nil {
+		t.Fatalf("purge version 8: %v", err)
+	}
+	expect(t, "purge purged", tables.note.PurgeContext(db.IfVersion(ctx, 8), id), db.ERR_NOT_FOUND)
+
+	//the version is ignored for items without version
+	if err := tables.location.DelByIdContext(db.IfVersion(ctx, 99), locationId); err != nil {
+		t.Fatalf("delete location with version: %v", err)
+	}
+} //testVersion()
@@ -17,6 +17,17 @@ const (
 	ERR_QUERY_ROW_PARSER
 	ERR_QUERY_ONE_HAS_MORE
 	ERR_NYI
+	//new codes are added at the end, so the values of existing codes do not change
+	ERR_UPDATE_FAILED
+	ERR_DELETE_FAILED
+	ERR_FOREIGN_KEY //item is referenced by other items, or refers to an item that does not exist
+	ERR_INVALID_CURSOR
+	ERR_DEADLOCK   //transaction failed because of concurrent transactions and can be retried
+	ERR_TX_FAILED  //transaction could not begin, commit or rollback
+	ERR_CONNECTION //db cannot be reached
+	ERR_CANCELED   //context was canceled or its deadline expired
+	ERR_INVALID    //item failed validation, the error wraps model.ValidationErrors
+	ERR_CONFLICT   //item was changed since it was read, see model.Version
 )
 
 var ErrorName = map[ErrorCode]string{
@@ -32,6 +43,16 @@ var ErrorName = map[ErrorCode]string{
 	ERR_QUERY_ROW_PARSER:   "QUERY_ROW_PARSER",
 	ERR_QUERY_ONE_HAS_MORE: "ERR_QUERY_ONE_HAS_MORE",
 	ERR_NYI:                "NYI", //not yet implemented
+	ERR_UPDATE_FAILED:      "UPDATE_FAILED",
+	ERR_DELETE_FAILED:      "DELETE_FAILED",
+	ERR_FOREIGN_KEY:        "FOREIGN_KEY",
+	ERR_INVALID_CURSOR:     "INVALID_CURSOR",
+	ERR_DEADLOCK:           "DEADLOCK",
+	ERR_TX_FAILED:          "TX_FAILED",
+	ERR_CONNECTION:         "CONNECTION",
+	ERR_CANCELED:           "CANCELED",
+	ERR_INVALID:            "INVALID",
+	ERR_CONFLICT:           "CONFLICT",
 }
 
 func NewError(code ErrorCode, err error) IError {
@@ -69,3 +90,8 @@ type dbError struct {
 func (e dbError) Code() ErrorCode {
 	return e.code
 }
+
+//Unwrap allows errors.As() to get e.g. model.ValidationErrors from ERR_INVALID
+func (e dbError) Unwrap() error {
+	return e.error
+}
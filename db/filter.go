@@ -0,0 +1,98 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+)
+
+//Filter selects items in ITable.GetByFilter() and ITable.GetOneByFilter()
+//it is one of Cond, And or Or, which may be nested, e.g.:
+//	db.And{
+//		db.Eq("status", "active"),
+//		db.Or{db.Lt("qty", 10), db.IsNull("qty")},
+//	}
+type Filter interface {
+	String() string
+}
+
+type Op string
+
+const (
+	OP_EQ       Op = "="
+	OP_NE       Op = "!="
+	OP_LT       Op = "<"
+	OP_LE       Op = "<="
+	OP_GT       Op = ">"
+	OP_GE       Op = ">="
+	OP_IN       Op = "in"       //Value is []interface{}
+	OP_LIKE     Op = "like"     //Value is pattern string with % and _ wildcards
+	OP_PREFIX   Op = "prefix"   //Value is string that must be at the start, wildcards are matched literally
+	OP_IS_NULL  Op = "is_null"  //Value is not used
+	OP_NOT_NULL Op = "not_null" //Value is not used
+)
+
+//Cond compares one field with a value
+type Cond struct {
+	Field string //model field name, e.g. "name" or "location_id"
+	Op    Op
+	Value interface{}
+}
+
+func (c Cond) String() string {
+	switch c.Op {
+	case OP_IS_NULL, OP_NOT_NULL:
+		return fmt.Sprintf("%s %s", c.Field, c.Op)
+	}
+	return fmt.Sprintf("%s %s %v", c.Field, c.Op, c.Value)
+}
+
+//And matches when all filters match, and always matches when empty
+type And []Filter
+
+func (and And) String() string { return join("AND", and) }
+
+//Or matches when any filter matches, and never matches when empty
+type Or []Filter
+
+func (or Or) String() string { return join("OR", or) }
+
+func join(op string, filters []Filter) string {
+	s := "("
+	for i, f := range filters {
+		if i > 0 {
+			s += " " + op + " "
+		}
+		s += f.String()
+	}
+	return s + ")"
+}
+
+func Eq(field string, value interface{}) Cond { return Cond{Field: field, Op: OP_EQ, Value: value} }
+func Ne(field string, value interface{}) Cond { return Cond{Field: field, Op: OP_NE, Value: value} }
+func Lt(field string, value interface{}) Cond { return Cond{Field: field, Op: OP_LT, Value: value} }
+func Le(field string, value interface{}) Cond { return Cond{Field: field, Op: OP_LE, Value: value} }
+func Gt(field string, value interface{}) Cond { return Cond{Field: field, Op: OP_GT, Value: value} }
+func Ge(field string, value interface{}) Cond { return Cond{Field: field, Op: OP_GE, Value: value} }
+func In(field string, values ...interface{}) Cond {
+	return Cond{Field: field, Op: OP_IN, Value: values}
+}
+func Like(field string, pattern string) Cond { return Cond{Field: field, Op: OP_LIKE, Value: pattern} }
+func Prefix(field string, prefix string) Cond {
+	return Cond{Field: field, Op: OP_PREFIX, Value: prefix}
+}
+func IsNull(field string) Cond  { return Cond{Field: field, Op: OP_IS_NULL} }
+func NotNull(field string) Cond { return Cond{Field: field, Op: OP_NOT_NULL} }
+
+//KeyFilter matches items where all key fields are equal to the key values
+func KeyFilter(key map[string]interface{}) Filter {
+	names := []string{}
+	for name := range key {
+		names = append(names, name)
+	}
+	sort.Strings(names) //same order for same key names
+	and := And{}
+	for _, name := range names {
+		and = append(and, Eq(name, key[name]))
+	}
+	return and
+}
@@ -0,0 +1,189 @@
+package db
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"github.com/go-msvc/msf/model"
+)
+
+//max ids in one IN condition when loading referenced items
+const includeBatchSize = 500
+
+//RefField returns the reference field by its model field name or the name without "_id",
+//e.g. "location" for Stock.Location in field "location_id"
+func RefField(itemModel model.IItem, name string) (model.ItemField, IError) {
+	for i, f := range itemModel.Fields() {
+		if i > 0 && f.RefItem != nil && (f.Name == name || f.Name == name+"_id") {
+			return f, nil
+		}
+	}
+	return model.ItemField{}, Errorf(ERR_KEY_FIELD_UNKNOWN, "%s has no reference \"%s\"", itemModel.Name(), name)
+}
+
+//RefFilter matches items that refer to the item with refId, see ITable.QueryByRef()
+func RefFilter(itemModel model.IItem, refName string, refId int64) (Filter, IError) {
+	f, dberr := RefField(itemModel, refName)
+	if dberr != nil {
+		return nil, dberr
+	}
+	return Cond{Field: f.Name, Op: OP_EQ, Value: refId}, nil
+}
+
+//LinksFunc returns the linked ids of each item in a many-to-many relation, ordered by linked id
+type LinksFunc func(ctx context.Context, r model.ItemRelation, ids []int64) (map[int64][]int64, IError)
+
+//IncludeRefs implements ITable.Include() for all backends
+//items are replaced with copies that have the referenced items loaded, using one query per
+//reference for all items rather than one per item, and nested names like "location.region"
+//also load the references of the referenced items
+//refTable returns the table of a referenced item, in the same transaction as the items
+//links reads the links of many-to-many relations, in the same transaction as the items
+func IncludeRefs(ctx context.Context, itemModel model.IItem, items []interface{}, include []string, refTable func(name string) (ITable, error), links LinksFunc) IError {
+	//nested names by reference, in the order of the include list
+	names := []string{}
+	nested := map[string][]string{}
+	for _, name := range include {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		p := strings.SplitN(name, ".", 2)
+		if _, ok := nested[p[0]]; !ok {
+			names = append(names, p[0])
+			nested[p[0]] = []string{}
+		}
+		if len(p) > 1 {
+			nested[p[0]] = append(nested[p[0]], p[1])
+		}
+	}
+
+	for _, name := range names {
+		if r, ok := itemModel.RelationByName(name); ok && r.RefItem != nil {
+			if dberr := includeLinks(ctx, itemModel, items, r, nested[name], refTable, links); dberr != nil {
+				return dberr
+			}
+			continue
+		}
+		f, dberr := RefField(itemModel, name)
+		if dberr != nil {
+			return dberr
+		}
+
+		//load each referenced item once
+		ids := []int64{}
+		seen := map[int64]bool{}
+		for _, item := range items {
+			if id := f.Value(item).(int64); id != 0 && !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		refs, dberr := loadRefs(ctx, itemModel, name, f.RefItem, ids, nested[name], refTable, links)
+		if dberr != nil {
+			return dberr
+		}
+
+		//the reference field index is the referenced item struct, then its model.Item and ID
+		refIndex := f.StructField.Index[:len(f.StructField.Index)-2]
+		for i, item := range items {
+			refItem, ok := refs[f.Value(item).(int64)]
+			if !ok {
+				continue
+			}
+			itemValue := reflect.New(itemModel.StructType()).Elem()
+			itemValue.Set(reflect.ValueOf(item))
+			itemValue.FieldByIndex(refIndex).Set(reflect.ValueOf(refItem))
+			items[i] = itemValue.Interface()
+		}
+	}
+	return nil
+} //IncludeRefs()
+
+//includeLinks sets the slice of a many-to-many relation in each item to the linked items
+func includeLinks(ctx context.Context, itemModel model.IItem, items []interface{}, r model.ItemRelation, nested []string, refTable func(name string) (ITable, error), links LinksFunc) IError {
+	idField := itemModel.Fields()[0]
+	ids := []int64{}
+	for _, item := range items {
+		ids = append(ids, idField.Value(item).(int64))
+	}
+	linked := map[int64][]int64{}
+	for start := 0; start < len(ids); start += includeBatchSize {
+		end := start + includeBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		batch, dberr := links(ctx, r, ids[start:end])
+		if dberr != nil {
+			return dberr
+		}
+		for id, refIds := range batch {
+			linked[id] = refIds
+		}
+	}
+
+	refIds := []int64{}
+	seen := map[int64]bool{}
+	for _, id := range ids {
+		for _, refId := range linked[id] {
+			if !seen[refId] {
+				seen[refId] = true
+				refIds = append(refIds, refId)
+			}
+		}
+	}
+	refs, dberr := loadRefs(ctx, itemModel, r.Name, r.RefItem, refIds, nested, refTable, links)
+	if dberr != nil {
+		return dberr
+	}
+
+	for i, item := range items {
+		slice := reflect.MakeSlice(r.StructField.Type, 0, len(linked[ids[i]]))
+		for _, refId := range linked[ids[i]] {
+			if refItem, ok := refs[refId]; ok {
+				slice = reflect.Append(slice, reflect.ValueOf(refItem))
+			}
+		}
+		itemValue := reflect.New(itemModel.StructType()).Elem()
+		itemValue.Set(reflect.ValueOf(item))
+		itemValue.FieldByIndex(r.StructField.Index).Set(slice)
+		items[i] = itemValue.Interface()
+	}
+	return nil
+} //includeLinks()
+
+//loadRefs reads the referenced items by id with their nested includes
+func loadRefs(ctx context.Context, itemModel model.IItem, name string, refItem model.IItem, ids []int64, nested []string, refTable func(name string) (ITable, error), links LinksFunc) (map[int64]interface{}, IError) {
+	table, err := refTable(refItem.Name())
+	if err != nil {
+		return nil, Errorf(ERR_KEY_FIELD_UNKNOWN, "cannot include %s.%s: %v", itemModel.Name(), name, err)
+	}
+	refIdField := table.Model().Fields()[0]
+	refItems := []interface{}{}
+	for start := 0; start < len(ids); start += includeBatchSize {
+		end := start + includeBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		values := []interface{}{}
+		for _, id := range ids[start:end] {
+			values = append(values, id)
+		}
+		batch, dberr := table.GetByFilterContext(ctx, Cond{Field: refIdField.Name, Op: OP_IN, Value: values}, int64(end-start))
+		if dberr != nil && dberr.Code() != ERR_NOT_FOUND {
+			return nil, dberr
+		}
+		refItems = append(refItems, batch...)
+	}
+	if len(nested) > 0 {
+		if dberr := IncludeRefs(ctx, table.Model(), refItems, nested, refTable, links); dberr != nil {
+			return nil, dberr
+		}
+	}
+	refs := map[int64]interface{}{}
+	for _, refItem := range refItems {
+		refs[refIdField.Value(refItem).(int64)] = refItem
+	}
+	return refs, nil
+} //loadRefs()
@@ -0,0 +1,212 @@
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+//data has the tables by name
+type data map[string]*tableData
+
+type tableData struct {
+	lastId  int64                       //ids are never reused, like auto increment
+	version int64                       //incremented on each change, to detect concurrent transactions
+	items   map[int64]interface{}       //item structs by id
+	uniq    map[string]map[string]int64 //id by uniq set name and key of the set's values
+	refs    map[int64]int               //nr of items in other tables that refer to each id
+	links   map[int64][]int64           //in join tables: sorted linked ids of each item
+}
+
+func newTableData() *tableData {
+	return &tableData{
+		items: map[int64]interface{}{},
+		uniq:  map[string]map[string]int64{},
+		refs:  map[int64]int{},
+		links: map[int64][]int64{},
+	}
+}
+
+//clone for a transaction, items and links are not copied because they are never modified
+func (td *tableData) clone() *tableData {
+	c := &tableData{
+		lastId:  td.lastId,
+		version: td.version,
+		items:   make(map[int64]interface{}, len(td.items)),
+		uniq:    make(map[string]map[string]int64, len(td.uniq)),
+		refs:    make(map[int64]int, len(td.refs)),
+		links:   make(map[int64][]int64, len(td.links)),
+	}
+	for id, item := range td.items {
+		c.items[id] = item
+	}
+	for uniqSetName, keys := range td.uniq {
+		c.uniq[uniqSetName] = make(map[string]int64, len(keys))
+		for key, id := range keys {
+			c.uniq[uniqSetName][key] = id
+		}
+	}
+	for id, n := range td.refs {
+		c.refs[id] = n
+	}
+	for id, refIds := range td.links {
+		c.links[id] = refIds
+	}
+	return c
+}
+
+//sorted ids of the items
+func (td *tableData) ids() []int64 {
+	ids := make([]int64, 0, len(td.items))
+	for id := range td.items {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+//deepCopy copies pointers, slices and maps in the value, so the caller
+//cannot change stored items and stored items do not change with the caller's values
+func deepCopy(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(deepCopy(v.Elem()))
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i)))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), deepCopy(iter.Value()))
+		}
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(deepCopy(v.Elem()))
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v) //also copies unexported fields, e.g. in time.Time
+		for i := 0; i < v.NumField(); i++ {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(deepCopy(v.Field(i)))
+			}
+		}
+		return c
+	}
+	return v
+} //deepCopy()
+
+//table in the snapshot file
+type jsonTable struct {
+	LastId int64                        `json:"last_id"`
+	Items  []map[string]json.RawMessage `json:"items"`           //field values by model field name
+	Links  map[string]map[int64][]int64 `json:"links,omitempty"` //linked ids by relation name and item id
+}
+
+//save encodes the table with model field names, because embedded references
+//cannot be encoded as JSON of the item struct
+//values of relations are saved with the item, and links of the item's join tables with the table
+func (t memoryTable) save(d data, td *tableData) (json.RawMessage, error) {
+	jt := jsonTable{LastId: td.lastId, Items: []map[string]json.RawMessage{}}
+	for _, id := range td.ids() {
+		jsonItem := map[string]json.RawMessage{}
+		for _, f := range t.itemModel.Fields() {
+			jsonValue, err := json.Marshal(f.Value(td.items[id]))
+			if err != nil {
+				return nil, fmt.Errorf("%s(%d).%s: %v", t.Name(), id, f.Name, err)
+			}
+			jsonItem[f.Name] = jsonValue
+		}
+		for _, r := range t.itemModel.Relations() {
+			if r.RefItem == nil {
+				jsonValue, err := json.Marshal(r.Slice(td.items[id]).Interface())
+				if err != nil {
+					return nil, fmt.Errorf("%s(%d).%s: %v", t.Name(), id, r.Name, err)
+				}
+				jsonItem[r.Name] = jsonValue
+			}
+		}
+		jt.Items = append(jt.Items, jsonItem)
+	}
+	for _, r := range t.linkRelations {
+		if len(d[r.Table].links) > 0 {
+			if jt.Links == nil {
+				jt.Links = map[string]map[int64][]int64{}
+			}
+			jt.Links[r.Name] = d[r.Table].links
+		}
+	}
+	return json.Marshal(jt)
+}
+
+//load decodes the table from the snapshot and indexes the items
+func (t memoryTable) load(d data, td *tableData, jsonTableValue json.RawMessage) error {
+	var jt jsonTable
+	if err := json.Unmarshal(jsonTableValue, &jt); err != nil {
+		return err
+	}
+	td.lastId = jt.LastId
+	for _, jsonItem := range jt.Items {
+		itemValue := reflect.New(t.itemModel.StructType()).Elem()
+		for _, f := range t.itemModel.Fields() {
+			jsonValue, ok := jsonItem[f.Name]
+			if !ok {
+				continue //field added to the model since the snapshot
+			}
+			if err := json.Unmarshal(jsonValue, itemValue.FieldByIndex(f.StructField.Index).Addr().Interface()); err != nil {
+				return fmt.Errorf("cannot decode %s.%s: %v", t.Name(), f.Name, err)
+			}
+		}
+		for _, r := range t.itemModel.Relations() {
+			jsonValue, ok := jsonItem[r.Name]
+			if !ok || r.RefItem != nil {
+				continue
+			}
+			if err := json.Unmarshal(jsonValue, itemValue.FieldByIndex(r.StructField.Index).Addr().Interface()); err != nil {
+				return fmt.Errorf("cannot decode %s.%s: %v", t.Name(), r.Name, err)
+			}
+		}
+		item := t.stored(itemValue.Interface())
+		id := t.id(item)
+		if dberr := t.check(d, td, id, item); dberr != nil {
+			return dberr
+		}
+		t.index(d, td, id, item, 1)
+		td.items[id] = item
+		if id > td.lastId {
+			td.lastId = id
+		}
+	}
+	for _, r := range t.linkRelations {
+		for id, refIds := range jt.Links[r.Name] {
+			if _, ok := td.items[id]; !ok {
+				return fmt.Errorf("%s.%s links %s(%d) that does not exist", t.Name(), r.Name, t.Name(), id)
+			}
+			if dberr := t.checkLinks(d, r, refIds); dberr != nil {
+				return dberr
+			}
+			t.setLinks(d, r, id, refIds)
+		}
+	}
+	return nil
+} //memoryTable.load()
@@ -0,0 +1,167 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/go-msvc/msf/db"
+	"github.com/go-msvc/msf/logger"
+	"github.com/go-msvc/msf/model"
+)
+
+var log = logger.New("msf").New("db-memory")
+
+func init() {
+	db.Register("memory", Config{})
+}
+
+type Config struct {
+	Filename string `json:"filename"` //optional JSON snapshot loaded on create and saved on close
+}
+
+func (c *Config) Validate() error {
+	return nil
+} //Config.Validate()
+
+func (c Config) MustCreate() db.IDatabase {
+	s, err := c.Create()
+	if err != nil {
+		panic(err)
+	}
+	return s
+} //Config.MustCreate()
+
+func (c Config) Create() (db.IDatabase, error) {
+	mdb := &memoryDb{
+		filename: c.Filename,
+		data:     data{},
+		loaded:   map[string]json.RawMessage{},
+		table:    map[string]*memoryTable{},
+	}
+	if c.Filename != "" {
+		jsonSnapshot, err := ioutil.ReadFile(c.Filename)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("cannot read snapshot file \"%s\": %v", c.Filename, err)
+		}
+		if err == nil {
+			//tables are decoded when added, because the item models are needed
+			if err := json.Unmarshal(jsonSnapshot, &mdb.loaded); err != nil {
+				return nil, fmt.Errorf("cannot decode snapshot file \"%s\": %v", c.Filename, err)
+			}
+			log.Debugf("loaded snapshot \"%s\" with %d tables", c.Filename, len(mdb.loaded))
+		}
+	}
+	return mdb, nil
+}
+
+//ISnapshot is implemented by the memory db to save its snapshot file before Close()
+type ISnapshot interface {
+	Save() error
+}
+
+//implements db.IDatabase
+//all tables share one lock, so every operation is atomic
+type memoryDb struct {
+	sync.Mutex
+	filename string
+	data     data                       //committed items
+	loaded   map[string]json.RawMessage //snapshot of tables not yet added
+	table    map[string]*memoryTable
+}
+
+func (mdb *memoryDb) Close() {
+	if mdb.filename == "" {
+		return
+	}
+	if err := mdb.Save(); err != nil {
+		log.Errorf("failed to save snapshot: %v", err)
+	}
+}
+
+func (mdb *memoryDb) AddTable(itemModel model.IItem) (db.ITable, error) {
+	if itemModel == nil {
+		return nil, fmt.Errorf("cannot add itemModel=nil")
+	}
+
+	mdb.Lock()
+	defer mdb.Unlock()
+
+	if _, ok := mdb.table[itemModel.Name()]; ok {
+		return nil, fmt.Errorf("table(%s) already added to db", itemModel.Name())
+	}
+
+	t, err := newTable(mdb, itemModel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add table(%s): %v", itemModel.Name(), err)
+	}
+	td := newTableData()
+	for _, r := range t.linkRelations {
+		mdb.data[r.Table] = newTableData()
+	}
+	if jsonTable, ok := mdb.loaded[itemModel.Name()]; ok {
+		if err := t.load(mdb.data, td, jsonTable); err != nil {
+			for _, r := range t.linkRelations {
+				delete(mdb.data, r.Table)
+			}
+			return nil, db.Errorf(db.ERR_CREATE_TABLE, "failed to load table(%s) from snapshot: %v", itemModel.Name(), err)
+		}
+		delete(mdb.loaded, itemModel.Name())
+	}
+	mdb.data[itemModel.Name()] = td
+	mdb.table[itemModel.Name()] = t
+	//loaded items count references in other tables, which transactions may have copied
+	for _, name := range t.written() {
+		mdb.data[name].version++
+	}
+	log.Infof("Added table(%s)", t.Name())
+	return t, nil
+}
+
+//Ping always succeeds because there is no connection
+func (mdb *memoryDb) Ping(ctx context.Context) db.IError {
+	return nil
+}
+
+func (mdb *memoryDb) Stats() db.Stats {
+	return db.Stats{}
+}
+
+//Save writes all tables to the snapshot file
+func (mdb *memoryDb) Save() error {
+	if mdb.filename == "" {
+		return fmt.Errorf("no snapshot filename configured")
+	}
+	mdb.Lock()
+	snapshot := map[string]json.RawMessage{}
+	for name, jsonTable := range mdb.loaded {
+		snapshot[name] = jsonTable //keep tables that were not added
+	}
+	for name, t := range mdb.table {
+		jsonTable, err := t.save(mdb.data, mdb.data[name])
+		if err != nil {
+			mdb.Unlock()
+			return fmt.Errorf("cannot encode table(%s): %v", name, err)
+		}
+		snapshot[name] = jsonTable
+	}
+	mdb.Unlock()
+
+	jsonSnapshot, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("cannot encode snapshot: %v", err)
+	}
+	//write and rename, so a failure does not leave a partial file
+	tmpFilename := mdb.filename + ".tmp"
+	if err := ioutil.WriteFile(tmpFilename, jsonSnapshot, 0644); err != nil {
+		return fmt.Errorf("cannot write snapshot file \"%s\": %v", tmpFilename, err)
+	}
+	if err := os.Rename(tmpFilename, mdb.filename); err != nil {
+		return fmt.Errorf("cannot rename snapshot file to \"%s\": %v", mdb.filename, err)
+	}
+	log.Debugf("saved snapshot \"%s\"", mdb.filename)
+	return nil
+} //memoryDb.Save()
@@ -0,0 +1,409 @@
+package memory
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-msvc/msf/db"
+	"github.com/go-msvc/msf/model"
+)
+
+//escape character used with LIKE, same as in the SQL backends
+const likeEscape = '!'
+
+//checkFilter fails like the SQL backends on unknown fields and unsupported values
+func (t memoryTable) checkFilter(filter db.Filter) db.IError {
+	switch f := filter.(type) {
+	case db.And:
+		for _, sub := range f {
+			if dberr := t.checkFilter(sub); dberr != nil {
+				return dberr
+			}
+		}
+		return nil
+	case db.Or:
+		for _, sub := range f {
+			if dberr := t.checkFilter(sub); dberr != nil {
+				return dberr
+			}
+		}
+		return nil
+	case db.Cond:
+		if _, ok := t.itemModel.FieldByName(f.Field); !ok {
+			return db.Errorf(db.ERR_KEY_FIELD_UNKNOWN, "field(%s) does not exist in %s", f.Field, t.itemModel.Name())
+		}
+		switch f.Op {
+		case db.OP_EQ, db.OP_NE:
+			if f.Value == nil {
+				return nil
+			}
+			fallthrough
+		case db.OP_LT, db.OP_LE, db.OP_GT, db.OP_GE:
+			if !isScalar(f.Value) {
+				return db.Errorf(db.ERR_KEY_FIELD_TYPE, "no support for %s.%s value type %T", t.itemModel.Name(), f, f.Value)
+			}
+		case db.OP_IN:
+			values, ok := f.Value.([]interface{})
+			if !ok {
+				return db.Errorf(db.ERR_KEY_FIELD_TYPE, "%s.%s requires []interface{} instead of %T", t.itemModel.Name(), f, f.Value)
+			}
+			for _, v := range values {
+				if !isScalar(v) {
+					return db.Errorf(db.ERR_KEY_FIELD_TYPE, "no support for %s.%s value type %T", t.itemModel.Name(), f, v)
+				}
+			}
+		case db.OP_LIKE, db.OP_PREFIX:
+			if _, ok := f.Value.(string); !ok {
+				return db.Errorf(db.ERR_KEY_FIELD_TYPE, "%s.%s requires string instead of %T", t.itemModel.Name(), f, f.Value)
+			}
+		case db.OP_IS_NULL, db.OP_NOT_NULL:
+		default:
+			return db.Errorf(db.ERR_KEY_FIELD_TYPE, "no support for %s.%s operator \"%s\"", t.itemModel.Name(), f, f.Op)
+		}
+		return nil
+	}
+	return db.Errorf(db.ERR_KEY_FIELD_TYPE, "no support for filter type %T", filter)
+} //memoryTable.checkFilter()
+
+//match a filter that passed checkFilter()
+//like SQL, comparisons with NULL never match
+func (t memoryTable) match(filter db.Filter, item interface{}) bool {
+	switch f := filter.(type) {
+	case db.And:
+		for _, sub := range f {
+			if !t.match(sub, item) {
+				return false
+			}
+		}
+		return true
+	case db.Or:
+		for _, sub := range f {
+			if t.match(sub, item) {
+				return true
+			}
+		}
+		return false
+	case db.Cond:
+		field, _ := t.itemModel.FieldByName(f.Field)
+		v := normalize(field.Value(item))
+		switch f.Op {
+		case db.OP_IS_NULL:
+			return v == nil
+		case db.OP_NOT_NULL:
+			return v != nil
+		case db.OP_EQ, db.OP_NE:
+			if f.Value == nil {
+				return (v == nil) == (f.Op == db.OP_EQ)
+			}
+		case db.OP_IN:
+			for _, value := range f.Value.([]interface{}) {
+				if c, ok := compare(v, normalize(value)); ok && c == 0 {
+					return true
+				}
+			}
+			return false
+		case db.OP_LIKE, db.OP_PREFIX:
+			s, ok := v.(string)
+			if !ok {
+				return false
+			}
+			pattern := f.Value.(string)
+			if f.Op == db.OP_PREFIX {
+				return strings.HasPrefix(strings.ToLower(s), strings.ToLower(pattern))
+			}
+			return likeRegexp(pattern).MatchString(s)
+		}
+		c, ok := compare(v, normalize(f.Value))
+		if !ok {
+			return false
+		}
+		switch f.Op {
+		case db.OP_EQ:
+			return c == 0
+		case db.OP_NE:
+			return c != 0
+		case db.OP_LT:
+			return c < 0
+		case db.OP_LE:
+			return c <= 0
+		case db.OP_GT:
+			return c > 0
+		case db.OP_GE:
+			return c >= 0
+		}
+	}
+	return false
+} //memoryTable.match()
+
+//likeRegexp converts a LIKE pattern to a case insensitive regexp, as LIKE in MySQL and sqlite
+func likeRegexp(pattern string) *regexp.Regexp {
+	expr := "(?is)^"
+	escaped := false
+	for _, c := range pattern {
+		switch {
+		case escaped:
+			expr += regexp.QuoteMeta(string(c))
+			escaped = false
+		case c == likeEscape:
+			escaped = true
+		case c == '%':
+			expr += ".*"
+		case c == '_':
+			expr += "."
+		default:
+			expr += regexp.QuoteMeta(string(c))
+		}
+	}
+	return regexp.MustCompile(expr + "$")
+}
+
+//check if value can be compared to a field
+func isScalar(v interface{}) bool {
+	switch v.(type) {
+	case nil:
+		return false
+	case time.Time, []byte, driver.Valuer:
+		return true
+	}
+	switch reflect.TypeOf(v).Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+//normalize a field or filter value to nil, int64, float64, bool, string or time.Time
+//structs, maps and slices are compared as their JSON text, like they are stored in SQL
+func normalize(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	for rv.IsValid() && rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return nil
+	}
+	switch x := rv.Interface().(type) {
+	case time.Time:
+		return x
+	case []byte:
+		if x == nil {
+			return nil
+		}
+		return string(x)
+	case driver.Valuer:
+		dv, err := x.Value()
+		if err != nil {
+			return nil
+		}
+		return normalize(dv)
+	}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if u := rv.Uint(); u <= math.MaxInt64 {
+			return int64(u)
+		}
+		return float64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.String:
+		return rv.String()
+	case reflect.Map, reflect.Slice, reflect.Interface:
+		if rv.IsNil() {
+			return nil
+		}
+	}
+	jsonValue, _ := json.Marshal(rv.Interface())
+	return string(jsonValue)
+} //normalize()
+
+//compare normalized values, converting strings to the other type like SQL does
+//ok=false when the values cannot be compared, e.g. NULL
+func compare(a, b interface{}) (int, bool) {
+	if a == nil || b == nil {
+		return 0, false
+	}
+	if _, ok := a.(string); ok {
+		if _, ok := b.(string); !ok {
+			c, ok := compare(b, a)
+			return -c, ok
+		}
+	}
+	switch x := a.(type) {
+	case int64:
+		switch y := b.(type) {
+		case int64:
+			return compareInt(x, y), true
+		case float64:
+			return compareFloat(float64(x), y), true
+		case bool:
+			return compareFloat(float64(x), boolFloat(y)), true
+		case string:
+			if n, err := strconv.ParseFloat(strings.TrimSpace(y), 64); err == nil {
+				return compareFloat(float64(x), n), true
+			}
+		}
+	case float64:
+		switch y := b.(type) {
+		case int64:
+			return compareFloat(x, float64(y)), true
+		case float64:
+			return compareFloat(x, y), true
+		case bool:
+			return compareFloat(x, boolFloat(y)), true
+		case string:
+			if n, err := strconv.ParseFloat(strings.TrimSpace(y), 64); err == nil {
+				return compareFloat(x, n), true
+			}
+		}
+	case bool:
+		switch y := b.(type) {
+		case bool:
+			return compareFloat(boolFloat(x), boolFloat(y)), true
+		case int64, float64:
+			c, ok := compare(b, a)
+			return -c, ok
+		case string:
+			if yb, err := strconv.ParseBool(y); err == nil {
+				return compareFloat(boolFloat(x), boolFloat(yb)), true
+			}
+		}
+	case time.Time:
+		switch y := b.(type) {
+		case time.Time:
+			return compareTime(x, y), true
+		case string:
+			if yt, err := parseTime(y, x.Location()); err == nil {
+				return compareTime(x, yt), true
+			}
+		}
+	case string:
+		return strings.Compare(x, b.(string)), true
+	}
+	return 0, false
+} //compare()
+
+//compareForOrder sorts NULL first and values that cannot be compared as text
+func compareForOrder(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	if c, ok := compare(a, b); ok {
+		return c
+	}
+	if c, ok := compare(b, a); ok {
+		return -c
+	}
+	return strings.Compare(normalizeText(a), normalizeText(b))
+}
+
+func normalizeText(v interface{}) string {
+	jsonValue, _ := json.Marshal(v)
+	return string(jsonValue)
+}
+
+func compareFloat(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func compareInt(x, y int64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func compareTime(x, y time.Time) int {
+	switch {
+	case x.Before(y):
+		return -1
+	case x.After(y):
+		return 1
+	}
+	return 0
+}
+
+func boolFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+//setDefault sets the model default in a nil nullable field
+func setDefault(fieldValue reflect.Value, f model.ItemField) error {
+	var value interface{} = *f.Default
+	if f.Kind == model.KindTime {
+		t := time.Now()
+		if strings.ToUpper(*f.Default) != "CURRENT_TIMESTAMP" {
+			var err error
+			if t, err = parseTime(*f.Default, time.Local); err != nil {
+				return err
+			}
+		}
+		value = t
+	}
+	if scanner, ok := fieldValue.Addr().Interface().(sql.Scanner); ok {
+		return scanner.Scan(value) //e.g. sql.NullString
+	}
+	target := fieldValue
+	if fieldValue.Kind() == reflect.Ptr {
+		target = reflect.New(fieldValue.Type().Elem()).Elem()
+	}
+	switch v := value.(type) {
+	case time.Time:
+		target.Set(reflect.ValueOf(v))
+	case string:
+		if target.Kind() == reflect.String {
+			target.SetString(v)
+		} else if err := json.Unmarshal([]byte(v), target.Addr().Interface()); err != nil {
+			return err //numbers, bools and JSON
+		}
+	}
+	if fieldValue.Kind() == reflect.Ptr {
+		fieldValue.Set(target.Addr())
+	}
+	return nil
+} //setDefault()
+
+//parse time in the formats used in cursors and SQL
+func parseTime(s string, loc *time.Location) (time.Time, error) {
+	var err error
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999", "2006-01-02"} {
+		var t time.Time
+		if t, err = time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
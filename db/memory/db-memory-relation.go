@@ -0,0 +1,113 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/go-msvc/msf/db"
+	"github.com/go-msvc/msf/model"
+)
+
+//checkLinks fails like a foreign key when a linked item does not exist
+func (t memoryTable) checkLinks(d data, r model.ItemRelation, refIds []int64) db.IError {
+	for _, refId := range refIds {
+		if _, ok := d[r.RefItem.Name()].items[refId]; !ok {
+			return db.Errorf(db.ERR_FOREIGN_KEY, "%s.%s links %s(%d) that does not exist", t.Name(), r.Name, r.RefItem.Name(), refId)
+		}
+	}
+	return nil
+}
+
+//setLinks replaces the links of the item with id in the join table, and counts them as references to the linked items
+func (t memoryTable) setLinks(d data, r model.ItemRelation, id int64, refIds []int64) {
+	jtd := d[r.Table]
+	refs := d[r.RefItem.Name()].refs
+	for _, refId := range jtd.links[id] {
+		if refs[refId]--; refs[refId] <= 0 {
+			delete(refs, refId)
+		}
+	}
+	delete(jtd.links, id)
+	if len(refIds) == 0 {
+		return
+	}
+	linked := []int64{} //new slice, because links are shared with transactions
+	seen := map[int64]bool{}
+	for _, refId := range refIds {
+		if !seen[refId] {
+			seen[refId] = true
+			linked = append(linked, refId)
+			refs[refId]++
+		}
+	}
+	sort.Slice(linked, func(i, j int) bool { return linked[i] < linked[j] })
+	jtd.links[id] = linked
+}
+
+//links implements db.LinksFunc for Include()
+func (t memoryTable) links(ctx context.Context, r model.ItemRelation, ids []int64) (map[int64][]int64, db.IError) {
+	linked := map[int64][]int64{}
+	dberr := t.access(ctx, false, func(d data, td *tableData) db.IError {
+		for _, id := range ids {
+			if refIds, ok := d[r.Table].links[id]; ok {
+				linked[id] = append([]int64{}, refIds...)
+			}
+		}
+		return nil
+	})
+	if dberr != nil {
+		return nil, dberr
+	}
+	return linked, nil
+}
+
+func (t memoryTable) Link(id int64, relation string, refIds ...int64) db.IError {
+	return t.LinkContext(context.Background(), id, relation, refIds...)
+}
+
+func (t memoryTable) LinkContext(ctx context.Context, id int64, relation string, refIds ...int64) db.IError {
+	r, dberr := db.LinkRelation(t.itemModel, relation)
+	if dberr != nil {
+		return dberr
+	}
+	if len(refIds) == 0 {
+		return nil
+	}
+	return t.access(ctx, true, func(d data, td *tableData) db.IError {
+		if _, ok := td.items[id]; !ok {
+			return db.Errorf(db.ERR_FOREIGN_KEY, "%s(%d) does not exist to link %s", t.Name(), id, r.Name)
+		}
+		if dberr := t.checkLinks(d, r, refIds); dberr != nil {
+			return dberr
+		}
+		t.setLinks(d, r, id, append(append([]int64{}, d[r.Table].links[id]...), refIds...))
+		return nil
+	})
+}
+
+func (t memoryTable) Unlink(id int64, relation string, refIds ...int64) db.IError {
+	return t.UnlinkContext(context.Background(), id, relation, refIds...)
+}
+
+func (t memoryTable) UnlinkContext(ctx context.Context, id int64, relation string, refIds ...int64) db.IError {
+	r, dberr := db.LinkRelation(t.itemModel, relation)
+	if dberr != nil {
+		return dberr
+	}
+	return t.access(ctx, true, func(d data, td *tableData) db.IError {
+		remaining := []int64{}
+		if len(refIds) > 0 {
+			unlink := map[int64]bool{}
+			for _, refId := range refIds {
+				unlink[refId] = true
+			}
+			for _, refId := range d[r.Table].links[id] {
+				if !unlink[refId] {
+					remaining = append(remaining, refId)
+				}
+			}
+		}
+		t.setLinks(d, r, id, remaining)
+		return nil
+	})
+}
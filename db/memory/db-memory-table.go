@@ -0,0 +1,768 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/go-msvc/msf/db"
+	"github.com/go-msvc/msf/model"
+)
+
+//implements db.ITable
+type memoryTable struct {
+	mdb           *memoryDb
+	itemModel     model.IItem
+	uniqSets      map[string][]model.ItemField //fields in each uniq set
+	refFields     []model.ItemField            //fields that refer to items in other tables
+	linkRelations []model.ItemRelation         //slices of items in join tables
+	tx            *memoryTx                    //nil when not in a transaction
+}
+
+func newTable(mdb *memoryDb, itemModel model.IItem) (*memoryTable, error) {
+	t := &memoryTable{
+		mdb:           mdb,
+		itemModel:     itemModel,
+		uniqSets:      map[string][]model.ItemField{},
+		refFields:     []model.ItemField{},
+		linkRelations: []model.ItemRelation{},
+	}
+	for i, f := range itemModel.Fields() {
+		for _, uniqSetName := range f.UniqSets {
+			t.uniqSets[uniqSetName] = append(t.uniqSets[uniqSetName], f)
+		}
+		if i > 0 && f.RefItem != nil {
+			if _, ok := mdb.table[f.RefItem.Name()]; !ok {
+				return nil, db.Errorf(db.ERR_CREATE_TABLE, "%s refers to table(%s) which was not added to the db", f.Name, f.RefItem.Name())
+			}
+			t.refFields = append(t.refFields, f)
+		}
+	}
+	for _, r := range itemModel.Relations() {
+		if r.RefItem != nil {
+			if _, ok := mdb.table[r.RefItem.Name()]; !ok {
+				return nil, db.Errorf(db.ERR_CREATE_TABLE, "%s links table(%s) which was not added to the db", r.Name, r.RefItem.Name())
+			}
+			t.linkRelations = append(t.linkRelations, r)
+		}
+	}
+	return t, nil
+}
+
+func (t memoryTable) Model() model.IItem { return t.itemModel }
+
+func (t memoryTable) Name() string { return t.itemModel.Name() }
+
+//access runs fnc with the data of the transaction, or else the db
+//all changes in fnc must be made after all checks passed, so a failed operation changes nothing
+//operations are not interrupted, so the context is only checked before fnc
+func (t memoryTable) access(ctx context.Context, write bool, fnc func(d data, td *tableData) db.IError) db.IError {
+	if err := ctx.Err(); err != nil {
+		return db.Errorf(db.ERR_CANCELED, "%s: %v", t.Name(), err)
+	}
+	var written []string
+	if write {
+		written = t.written()
+	}
+	if t.tx != nil {
+		t.tx.Lock()
+		defer t.tx.Unlock()
+		if t.tx.done {
+			return db.Errorf(db.ERR_TX_FAILED, "%s: transaction already ended", t.Name())
+		}
+		t.mdb.Lock()
+		defer t.mdb.Unlock()
+		d := t.tx.view(written)
+		return fnc(d, d[t.Name()])
+	}
+	t.mdb.Lock()
+	defer t.mdb.Unlock()
+	dberr := fnc(t.mdb.data, t.mdb.data[t.Name()])
+	if dberr == nil {
+		for _, name := range written {
+			t.mdb.data[name].version++
+		}
+	}
+	return dberr
+}
+
+//written returns the names of the tables changed by writing this table: the table,
+//the tables it refers to, which count references, and its join tables and the tables they link
+func (t memoryTable) written() []string {
+	names := []string{t.Name()}
+	for _, f := range t.refFields {
+		names = append(names, f.RefItem.Name())
+	}
+	for _, r := range t.linkRelations {
+		names = append(names, r.Table, r.RefItem.Name())
+	}
+	return names
+}
+
+func (t memoryTable) id(item interface{}) int64 {
+	return t.itemModel.Fields()[0].Value(item).(int64)
+}
+
+//copy of the item with the specified id
+func (t memoryTable) withId(item interface{}, id int64) interface{} {
+	itemValue := deepCopy(reflect.ValueOf(item))
+	itemValue.FieldByIndex(t.itemModel.Fields()[0].StructField.Index).SetInt(id)
+	return itemValue.Interface()
+}
+
+//stored returns a copy of the item as it is stored: without the slices of linked items, which are
+//kept in the join tables, and with empty slices of values as nil, like they are read from SQL
+func (t memoryTable) stored(item interface{}) interface{} {
+	itemValue := reflect.New(t.itemModel.StructType()).Elem()
+	itemValue.Set(reflect.ValueOf(item))
+	for _, r := range t.itemModel.Relations() {
+		if slice := itemValue.FieldByIndex(r.StructField.Index); r.RefItem != nil || slice.Len() == 0 {
+			slice.Set(reflect.Zero(slice.Type()))
+		}
+	}
+	return itemValue.Interface()
+}
+
+//hidden is true when the item is soft deleted and the context is not db.WithDeleted()
+func (t memoryTable) hidden(ctx context.Context, item interface{}) bool {
+	f, ok := model.AutoField(t.itemModel, model.FieldDeletedAt)
+	return ok && !db.IsWithDeleted(ctx) && f.Value(item).(*time.Time) != nil
+}
+
+//key of the values of a uniq set, ok=false when a value is NULL, which is never a duplicate
+func uniqKey(fields []model.ItemField, item interface{}) (string, bool) {
+	values := []interface{}{}
+	for _, f := range fields {
+		v := normalize(f.Value(item))
+		if v == nil {
+			return "", false
+		}
+		values = append(values, v)
+	}
+	key, _ := json.Marshal(values)
+	return string(key), true
+}
+
+//check that uniq sets are not used by other items and referenced items exist
+func (t memoryTable) check(d data, td *tableData, id int64, item interface{}) db.IError {
+	for uniqSetName, fields := range t.uniqSets {
+		if key, ok := uniqKey(fields, item); ok {
+			if otherId, ok := td.uniq[uniqSetName][key]; ok && otherId != id {
+				return db.Errorf(db.ERR_DUPLICATE_KEY, "%s uniq set %s=%s already used by %s(%d)", t.Name(), uniqSetName, key, t.Name(), otherId)
+			}
+		}
+	}
+	for _, f := range t.refFields {
+		refId := f.Value(item).(int64)
+		if _, ok := d[f.RefItem.Name()].items[refId]; !ok {
+			return db.Errorf(db.ERR_FOREIGN_KEY, "%s.%s=%d refers to %s that does not exist", t.Name(), f.Name, refId, f.RefItem.Name())
+		}
+	}
+	return nil
+}
+
+//index adds (n=1) or removes (n=-1) the uniq keys and references of the item
+func (t memoryTable) index(d data, td *tableData, id int64, item interface{}, n int) {
+	for uniqSetName, fields := range t.uniqSets {
+		if key, ok := uniqKey(fields, item); ok {
+			if n > 0 {
+				if td.uniq[uniqSetName] == nil {
+					td.uniq[uniqSetName] = map[string]int64{}
+				}
+				td.uniq[uniqSetName][key] = id
+			} else {
+				delete(td.uniq[uniqSetName], key)
+			}
+		}
+	}
+	for _, f := range t.refFields {
+		refs := d[f.RefItem.Name()].refs
+		refId := f.Value(item).(int64)
+		if refs[refId] += n; refs[refId] <= 0 {
+			delete(refs, refId)
+		}
+	}
+}
+
+func (t memoryTable) Add(itemValue interface{}) (int64, db.IError) {
+	return t.AddContext(context.Background(), itemValue)
+}
+
+func (t memoryTable) AddContext(ctx context.Context, itemValue interface{}) (int64, db.IError) {
+	if reflect.TypeOf(itemValue) != t.itemModel.StructType() {
+		return 0, db.Errorf(db.ERR_INSERT_WRONG_TYPE, "cannot add item(%s) using %T instead of %v", t.itemModel.Name(), itemValue, t.itemModel.StructType())
+	}
+	if dberr := db.Validate(t.itemModel, itemValue); dberr != nil {
+		return 0, dberr
+	}
+	item, err := t.withDefaults(db.SetTimestamps(t.itemModel, itemValue, db.Now(), true))
+	if err != nil {
+		return 0, db.Errorf(db.ERR_INSERT_WRONG_TYPE, "cannot add item(%s): %v", t.itemModel.Name(), err)
+	}
+	var id int64
+	dberr := t.access(ctx, true, func(d data, td *tableData) db.IError {
+		var dberr db.IError
+		id, dberr = t.insert(d, td, item)
+		return dberr
+	})
+	if dberr != nil {
+		return 0, dberr
+	}
+	return id, nil
+}
+
+//insert the item with defaults with the next id, and links to the items in its slices
+func (t memoryTable) insert(d data, td *tableData, item interface{}) (int64, db.IError) {
+	id := td.lastId + 1
+	item = t.withId(item, id)
+	if dberr := t.check(d, td, id, item); dberr != nil {
+		return 0, dberr
+	}
+	links := make([][]int64, len(t.linkRelations))
+	for i, r := range t.linkRelations {
+		links[i] = r.RefIds(item)
+		if dberr := t.checkLinks(d, r, links[i]); dberr != nil {
+			return 0, dberr
+		}
+	}
+	item = t.stored(item)
+	t.index(d, td, id, item, 1)
+	td.items[id] = item
+	td.lastId = id
+	for i, r := range t.linkRelations {
+		t.setLinks(d, r, id, links[i])
+	}
+	return id, nil
+}
+
+//remove the item and its links
+func (t memoryTable) remove(d data, td *tableData, id int64) {
+	t.index(d, td, id, td.items[id], -1)
+	delete(td.items, id)
+	for _, r := range t.linkRelations {
+		t.setLinks(d, r, id, nil)
+	}
+}
+
+func (t memoryTable) GetById(id int64) (interface{}, db.IError) {
+	return t.GetByIdContext(context.Background(), id)
+}
+
+func (t memoryTable) GetByIdContext(ctx context.Context, id int64) (interface{}, db.IError) {
+	var item interface{}
+	dberr := t.access(ctx, false, func(d data, td *tableData) db.IError {
+		stored, ok := td.items[id]
+		if !ok || t.hidden(ctx, stored) {
+			return db.Errorf(db.ERR_NOT_FOUND, "%s.GetById(%v) not found", t.itemModel.Name(), id)
+		}
+		item = deepCopy(reflect.ValueOf(stored)).Interface()
+		return nil
+	})
+	if dberr != nil {
+		return nil, dberr
+	}
+	return item, nil
+}
+
+//if >1: nil, ERR_FOUND_MANY; if 0: nil, ERR_NOT_FOUND
+func (t memoryTable) GetOneByKey(key map[string]interface{}) (interface{}, db.IError) {
+	return t.GetOneByFilterContext(context.Background(), db.KeyFilter(key))
+}
+
+func (t memoryTable) GetOneByKeyContext(ctx context.Context, key map[string]interface{}) (interface{}, db.IError) {
+	return t.GetOneByFilterContext(ctx, db.KeyFilter(key))
+}
+
+//if not found: nil, ERR_NOT_FOUND
+func (t memoryTable) GetByKey(key map[string]interface{}, limit int64) ([]interface{}, db.IError) {
+	return t.GetByFilterContext(context.Background(), db.KeyFilter(key), limit)
+}
+
+func (t memoryTable) GetByKeyContext(ctx context.Context, key map[string]interface{}, limit int64) ([]interface{}, db.IError) {
+	return t.GetByFilterContext(ctx, db.KeyFilter(key), limit)
+}
+
+//if >1: nil, ERR_FOUND_MANY; if 0: nil, ERR_NOT_FOUND
+func (t memoryTable) GetOneByFilter(filter db.Filter) (interface{}, db.IError) {
+	return t.GetOneByFilterContext(context.Background(), filter)
+}
+
+func (t memoryTable) GetOneByFilterContext(ctx context.Context, filter db.Filter) (interface{}, db.IError) {
+	items, dberr := t.find(ctx, filter, 2) //2 so we can detect presence of >1
+	if dberr != nil {
+		return nil, dberr
+	}
+	switch len(items) {
+	case 0:
+		return nil, db.Errorf(db.ERR_NOT_FOUND, "%s.GetOneByFilter(%v) not found", t.itemModel.Name(), filter)
+	case 1:
+		return items[0], nil
+	}
+	return nil, db.Errorf(db.ERR_QUERY_ONE_HAS_MORE, "%s.GetOneByFilter(%v) multiple entries matched the filter", t.itemModel.Name(), filter)
+}
+
+//if not found: nil, ERR_NOT_FOUND
+func (t memoryTable) GetByFilter(filter db.Filter, limit int64) ([]interface{}, db.IError) {
+	return t.GetByFilterContext(context.Background(), filter, limit)
+}
+
+func (t memoryTable) GetByFilterContext(ctx context.Context, filter db.Filter, limit int64) ([]interface{}, db.IError) {
+	if limit < 1 {
+		return nil, db.Errorf(db.ERR_NOT_FOUND, "%s.GetByFilter(%v) limit=%d will never return an item", t.itemModel.Name(), filter, limit)
+	}
+	items, dberr := t.find(ctx, filter, limit)
+	if dberr != nil {
+		return nil, dberr
+	}
+	if len(items) == 0 {
+		return nil, db.Errorf(db.ERR_NOT_FOUND, "%s.GetByFilter(%v) not found", t.itemModel.Name(), filter)
+	}
+	return items, nil
+}
+
+//find copies of up to limit items matching the filter (nil for all items) in order of id
+func (t memoryTable) find(ctx context.Context, filter db.Filter, limit int64) ([]interface{}, db.IError) {
+	filter = db.NotDeleted(ctx, t.itemModel, filter)
+	if filter != nil {
+		if dberr := t.checkFilter(filter); dberr != nil {
+			return nil, dberr
+		}
+	}
+	items := []interface{}{}
+	dberr := t.access(ctx, false, func(d data, td *tableData) db.IError {
+		for _, id := range td.ids() {
+			if int64(len(items)) >= limit {
+				break
+			}
+			if filter == nil || t.match(filter, td.items[id]) {
+				items = append(items, deepCopy(reflect.ValueOf(td.items[id])).Interface())
+			}
+		}
+		return nil
+	})
+	return items, dberr
+}
+
+//Query returns one page of items matching the filter (nil for all items)
+//with the same ordering and cursors as the SQL backends
+func (t memoryTable) Query(filter db.Filter, options db.QueryOptions) (db.Page, db.IError) {
+	return t.QueryContext(context.Background(), filter, options)
+}
+
+func (t memoryTable) QueryContext(ctx context.Context, filter db.Filter, options db.QueryOptions) (db.Page, db.IError) {
+	if options.Limit < 1 {
+		return db.Page{}, db.Errorf(db.ERR_KEY_FIELD_TYPE, "%s.Query(%v) limit=%d must be > 0", t.itemModel.Name(), filter, options.Limit)
+	}
+	order, dberr := options.FullOrder(t.itemModel)
+	if dberr != nil {
+		return db.Page{}, dberr
+	}
+	filter = db.NotDeleted(ctx, t.itemModel, filter)
+	if filter != nil {
+		if dberr := t.checkFilter(filter); dberr != nil {
+			return db.Page{}, dberr
+		}
+	}
+	var cursorFilter db.Filter
+	backward := false
+	if options.Cursor != "" {
+		if cursorFilter, backward, dberr = db.CursorFilter(t.itemModel, order, options.Cursor); dberr != nil {
+			return db.Page{}, dberr
+		}
+	}
+
+	page := db.Page{Items: []interface{}{}, Total: -1}
+	all := []interface{}{}
+	dberr = t.access(ctx, false, func(d data, td *tableData) db.IError {
+		for _, item := range td.items {
+			if filter == nil || t.match(filter, item) {
+				all = append(all, item)
+			}
+		}
+		return nil
+	})
+	if dberr != nil {
+		return db.Page{}, dberr
+	}
+	if options.WithTotal {
+		page.Total = int64(len(all))
+	}
+
+	sqlOrder := order
+	if backward {
+		sqlOrder = db.ReverseOrder(order) //read back from the cursor, then reverse the page
+	}
+	t.sort(all, sqlOrder)
+	start := int64(0)
+	if options.Cursor == "" {
+		start = options.Offset
+	}
+	for _, item := range all {
+		if cursorFilter != nil && !t.match(cursorFilter, item) {
+			continue
+		}
+		if start > 0 {
+			start--
+			continue
+		}
+		page.Items = append(page.Items, deepCopy(reflect.ValueOf(item)).Interface())
+		if int64(len(page.Items)) > options.Limit {
+			break //one more than limit to know if there are more items
+		}
+	}
+
+	more := int64(len(page.Items)) > options.Limit
+	if more {
+		page.Items = page.Items[:options.Limit]
+	}
+	if backward {
+		for i, j := 0, len(page.Items)-1; i < j; i, j = i+1, j-1 {
+			page.Items[i], page.Items[j] = page.Items[j], page.Items[i]
+		}
+	}
+	if len(page.Items) > 0 {
+		first := page.Items[0]
+		last := page.Items[len(page.Items)-1]
+		//moving back, there are always items after the page where we came from
+		if more || backward {
+			page.Next = db.EncodeCursor(t.itemModel, order, last, false)
+		}
+		if (backward && more) || (!backward && (options.Cursor != "" || options.Offset > 0)) {
+			page.Prev = db.EncodeCursor(t.itemModel, order, first, true)
+		}
+	}
+	if len(options.Include) > 0 {
+		if dberr := t.IncludeContext(ctx, page.Items, options.Include...); dberr != nil {
+			return db.Page{}, dberr
+		}
+	}
+	return page, nil
+} //memoryTable.Query()
+
+//sort items in the order, NULL before other values like in most SQL dbs
+func (t memoryTable) sort(items []interface{}, order []db.Order) {
+	fields := []model.ItemField{}
+	for _, o := range order {
+		f, _ := t.itemModel.FieldByName(o.Field)
+		fields = append(fields, f)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		for n, o := range order {
+			c := compareForOrder(normalize(fields[n].Value(items[i])), normalize(fields[n].Value(items[j])))
+			if o.Desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+}
+
+//update the item identified by its model.Item.ID
+//fieldNames may be specified to only update those fields, else all fields are updated
+func (t memoryTable) Upd(itemValue interface{}, fieldNames ...string) db.IError {
+	return t.UpdContext(context.Background(), itemValue, fieldNames...)
+}
+
+func (t memoryTable) UpdContext(ctx context.Context, itemValue interface{}, fieldNames ...string) db.IError {
+	if reflect.TypeOf(itemValue) != t.itemModel.StructType() {
+		return db.Errorf(db.ERR_INSERT_WRONG_TYPE, "cannot update item(%s) using %T instead of %v", t.itemModel.Name(), itemValue, t.itemModel.StructType())
+	}
+	fields, relations, dberr := db.UpdFields(t.itemModel, fieldNames)
+	if dberr != nil {
+		return dberr
+	}
+	if dberr := db.ValidateUpd(t.itemModel, itemValue, fields, relations); dberr != nil {
+		return dberr
+	}
+	itemValue = db.SetTimestamps(t.itemModel, itemValue, db.Now(), false)
+
+	id := t.id(itemValue)
+	version, versioned := db.ItemVersion(t.itemModel, itemValue)
+	return t.access(ctx, true, func(d data, td *tableData) db.IError {
+		existing, ok := td.items[id]
+		if !ok || t.hidden(ctx, existing) {
+			return db.Errorf(db.ERR_NOT_FOUND, "%s.Upd(%v) not found", t.itemModel.Name(), id)
+		}
+		if dberr := t.checkVersion(existing, "Upd", id, version, versioned); dberr != nil {
+			return dberr
+		}
+		return t.update(d, td, id, itemValue, fields, relations)
+	})
+} //memoryTable.UpdContext()
+
+//checkVersion returns ERR_CONFLICT when the version is checked and is not the version of the existing item
+func (t memoryTable) checkVersion(existing interface{}, what string, id int64, version int64, checked bool) db.IError {
+	if storedVersion, _ := db.ItemVersion(t.itemModel, existing); checked && storedVersion != version {
+		return db.ConflictError(t.itemModel, what, id, version)
+	}
+	return nil
+}
+
+//incrementVersion of an item with a version
+func (t memoryTable) incrementVersion(itemValue reflect.Value) {
+	if f, ok := model.AutoField(t.itemModel, model.FieldVersion); ok {
+		v := itemValue.FieldByIndex(f.StructField.Index)
+		v.SetInt(v.Int() + 1)
+	}
+}
+
+//update the fields and relations of the existing item with the values in itemValue
+//and increment the version of the existing item
+func (t memoryTable) update(d data, td *tableData, id int64, itemValue interface{}, fields []model.ItemField, relations []model.ItemRelation) db.IError {
+	existing := td.items[id]
+	updated := reflect.New(t.itemModel.StructType()).Elem()
+	updated.Set(reflect.ValueOf(existing))
+	newValue := deepCopy(reflect.ValueOf(itemValue))
+	for _, f := range fields {
+		updated.FieldByIndex(f.StructField.Index).Set(newValue.FieldByIndex(f.StructField.Index))
+	}
+	t.incrementVersion(updated)
+	links := map[int][]int64{}
+	for i, r := range relations {
+		if r.RefItem == nil {
+			updated.FieldByIndex(r.StructField.Index).Set(newValue.FieldByIndex(r.StructField.Index))
+			continue
+		}
+		links[i] = r.RefIds(itemValue)
+		if dberr := t.checkLinks(d, r, links[i]); dberr != nil {
+			return dberr
+		}
+	}
+	item := t.stored(updated.Interface())
+
+	t.index(d, td, id, existing, -1)
+	if dberr := t.check(d, td, id, item); dberr != nil {
+		t.index(d, td, id, existing, 1)
+		return dberr
+	}
+	t.index(d, td, id, item, 1)
+	td.items[id] = item
+	for i, refIds := range links {
+		t.setLinks(d, relations[i], id, refIds)
+	}
+	return nil
+}
+
+func (t memoryTable) AddMany(items []interface{}) ([]int64, db.IError) {
+	return t.AddManyContext(context.Background(), items)
+}
+
+//AddManyContext adds all items in one operation, so all or none are added
+func (t memoryTable) AddManyContext(ctx context.Context, items []interface{}) ([]int64, db.IError) {
+	now := db.Now()
+	withDefaults := make([]interface{}, 0, len(items))
+	for i, itemValue := range items {
+		if reflect.TypeOf(itemValue) != t.itemModel.StructType() {
+			return nil, db.Errorf(db.ERR_INSERT_WRONG_TYPE, "cannot add item(%s)[%d] using %T instead of %v", t.itemModel.Name(), i, itemValue, t.itemModel.StructType())
+		}
+		if dberr := db.Validate(t.itemModel, itemValue); dberr != nil {
+			return nil, db.Errorf(db.ERR_INVALID, "cannot add item(%s)[%d]: %w", t.itemModel.Name(), i, dberr)
+		}
+		item, err := t.withDefaults(db.SetTimestamps(t.itemModel, itemValue, now, true))
+		if err != nil {
+			return nil, db.Errorf(db.ERR_INSERT_WRONG_TYPE, "cannot add item(%s)[%d]: %v", t.itemModel.Name(), i, err)
+		}
+		withDefaults = append(withDefaults, item)
+	}
+	ids := make([]int64, 0, len(items))
+	dberr := t.access(ctx, true, func(d data, td *tableData) db.IError {
+		lastId := td.lastId
+		for _, item := range withDefaults {
+			id, dberr := t.insert(d, td, item)
+			if dberr != nil {
+				//remove the items added before this one
+				for _, id := range ids {
+					t.remove(d, td, id)
+				}
+				td.lastId = lastId
+				return dberr
+			}
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	if dberr != nil {
+		return nil, dberr
+	}
+	return ids, nil
+} //memoryTable.AddManyContext()
+
+func (t memoryTable) Upsert(itemValue interface{}, conflictUniqSet string) (int64, db.IError) {
+	return t.UpsertContext(context.Background(), itemValue, conflictUniqSet)
+}
+
+func (t memoryTable) UpsertContext(ctx context.Context, itemValue interface{}, conflictUniqSet string) (int64, db.IError) {
+	if reflect.TypeOf(itemValue) != t.itemModel.StructType() {
+		return 0, db.Errorf(db.ERR_INSERT_WRONG_TYPE, "cannot upsert item(%s) using %T instead of %v", t.itemModel.Name(), itemValue, t.itemModel.StructType())
+	}
+	if dberr := db.Validate(t.itemModel, itemValue); dberr != nil {
+		return 0, dberr
+	}
+	itemValue = db.SetTimestamps(t.itemModel, itemValue, db.Now(), true)
+	conflictFields, ok := t.uniqSets[conflictUniqSet]
+	if !ok {
+		return 0, db.Errorf(db.ERR_KEY_FIELD_UNKNOWN, "%s has no uniq set \"%s\"", t.itemModel.Name(), conflictUniqSet)
+	}
+	//like SQL, NULL fields with a default are not updated, and an existing item
+	//keeps created_at, is restored when it was soft deleted, and its version is incremented
+	fields := []model.ItemField{}
+	for _, f := range t.itemModel.Fields()[1:] {
+		if f.Auto && (f.Name == model.FieldCreatedAt || f.Name == model.FieldVersion) {
+			continue
+		}
+		if f.Default == nil || normalize(f.Value(itemValue)) != nil {
+			fields = append(fields, f)
+		}
+	}
+	_, relations, _ := db.UpdFields(t.itemModel, nil) //values but not links
+	item, err := t.withDefaults(itemValue)
+	if err != nil {
+		return 0, db.Errorf(db.ERR_INSERT_WRONG_TYPE, "cannot upsert item(%s): %v", t.itemModel.Name(), err)
+	}
+	item = t.stored(item) //no links
+	var id int64
+	dberr := t.access(ctx, true, func(d data, td *tableData) db.IError {
+		if key, ok := uniqKey(conflictFields, itemValue); ok {
+			if existingId, ok := td.uniq[conflictUniqSet][key]; ok {
+				id = existingId
+				return t.update(d, td, id, itemValue, fields, relations)
+			}
+		}
+		var dberr db.IError
+		id, dberr = t.insert(d, td, item)
+		return dberr
+	})
+	if dberr != nil {
+		return 0, dberr
+	}
+	return id, nil
+} //memoryTable.UpsertContext()
+
+func (t memoryTable) DelById(id int64) db.IError {
+	return t.DelByIdContext(context.Background(), id)
+}
+
+//DelByIdContext only sets deleted_at when the item has soft delete
+func (t memoryTable) DelByIdContext(ctx context.Context, id int64) db.IError {
+	if _, ok := model.AutoField(t.itemModel, model.FieldDeletedAt); ok {
+		now := db.Now()
+		return t.setDeleted(ctx, "DelById", id, &now)
+	}
+	return t.delete(ctx, "DelById", id)
+}
+
+func (t memoryTable) Restore(id int64) db.IError {
+	return t.RestoreContext(context.Background(), id)
+}
+
+func (t memoryTable) RestoreContext(ctx context.Context, id int64) db.IError {
+	if _, dberr := db.SoftDeleteField(t.itemModel); dberr != nil {
+		return dberr
+	}
+	return t.setDeleted(ctx, "Restore", id, nil)
+}
+
+//setDeleted sets deleted_at of an item that is not deleted, or clears it (deletedAt=nil) of a deleted item
+//and increments the version of an item with a version
+func (t memoryTable) setDeleted(ctx context.Context, what string, id int64, deletedAt *time.Time) db.IError {
+	f, _ := model.AutoField(t.itemModel, model.FieldDeletedAt)
+	version, checked := db.ExpectedVersion(ctx, t.itemModel)
+	return t.access(ctx, true, func(d data, td *tableData) db.IError {
+		item, ok := td.items[id]
+		if !ok || (f.Value(item).(*time.Time) == nil) == (deletedAt == nil) {
+			return db.Errorf(db.ERR_NOT_FOUND, "%s.%s(%v) not found", t.itemModel.Name(), what, id)
+		}
+		if dberr := t.checkVersion(item, what, id, version, checked); dberr != nil {
+			return dberr
+		}
+		itemValue := reflect.New(t.itemModel.StructType()).Elem()
+		itemValue.Set(reflect.ValueOf(item))
+		itemValue.FieldByIndex(f.StructField.Index).Set(reflect.ValueOf(deletedAt))
+		t.incrementVersion(itemValue)
+		td.items[id] = itemValue.Interface()
+		return nil
+	})
+}
+
+func (t memoryTable) Purge(id int64) db.IError {
+	return t.PurgeContext(context.Background(), id)
+}
+
+func (t memoryTable) PurgeContext(ctx context.Context, id int64) db.IError {
+	return t.delete(ctx, "Purge", id)
+}
+
+//delete the item and its links, if it is not referenced
+func (t memoryTable) delete(ctx context.Context, what string, id int64) db.IError {
+	version, checked := db.ExpectedVersion(ctx, t.itemModel)
+	return t.access(ctx, true, func(d data, td *tableData) db.IError {
+		item, ok := td.items[id]
+		if !ok {
+			return db.Errorf(db.ERR_NOT_FOUND, "%s.%s(%v) not found", t.itemModel.Name(), what, id)
+		}
+		if dberr := t.checkVersion(item, what, id, version, checked); dberr != nil {
+			return dberr
+		}
+		if n := td.refs[id]; n > 0 {
+			return db.Errorf(db.ERR_FOREIGN_KEY, "cannot delete %s(%v) referenced by %d items", t.itemModel.Name(), id, n)
+		}
+		t.remove(d, td, id)
+		return nil
+	})
+}
+
+//withDefaults returns a copy of the item with the model defaults in nil nullable fields,
+//like SQL dbs set defaults when NULL is not inserted
+func (t memoryTable) withDefaults(itemValue interface{}) (interface{}, error) {
+	item := reflect.New(t.itemModel.StructType()).Elem()
+	item.Set(reflect.ValueOf(itemValue))
+	for _, f := range t.itemModel.Fields() {
+		if f.Default == nil || normalize(f.Value(itemValue)) != nil {
+			continue
+		}
+		if err := setDefault(item.FieldByIndex(f.StructField.Index), f); err != nil {
+			return nil, fmt.Errorf("field(%s) invalid default \"%s\": %v", f.Name, *f.Default, err)
+		}
+	}
+	return item.Interface(), nil
+}
+
+func (t memoryTable) Include(items []interface{}, include ...string) db.IError {
+	return t.IncludeContext(context.Background(), items, include...)
+}
+
+func (t memoryTable) IncludeContext(ctx context.Context, items []interface{}, include ...string) db.IError {
+	return db.IncludeRefs(ctx, t.itemModel, items, include, t.refTable, t.links)
+}
+
+//refTable returns another table of the db, in the same transaction as this table
+func (t memoryTable) refTable(name string) (db.ITable, error) {
+	if t.tx != nil {
+		return t.tx.Table(name)
+	}
+	t.mdb.Lock()
+	defer t.mdb.Unlock()
+	refTable, ok := t.mdb.table[name]
+	if !ok {
+		return nil, fmt.Errorf("table(%s) was not added to the db", name)
+	}
+	return refTable, nil
+}
+
+func (t memoryTable) QueryByRef(refName string, refId int64, options db.QueryOptions) (db.Page, db.IError) {
+	return t.QueryByRefContext(context.Background(), refName, refId, options)
+}
+
+func (t memoryTable) QueryByRefContext(ctx context.Context, refName string, refId int64, options db.QueryOptions) (db.Page, db.IError) {
+	filter, dberr := db.RefFilter(t.itemModel, refName, refId)
+	if dberr != nil {
+		return db.Page{}, dberr
+	}
+	return t.QueryContext(ctx, filter, options)
+}
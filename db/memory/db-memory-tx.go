@@ -0,0 +1,96 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/go-msvc/msf/db"
+)
+
+//implements db.ITx
+//the transaction works on copies of the tables it writes, which replace the db tables on commit
+//tables are copied on the first write, and other tables are read from the db
+//commit fails with ERR_DEADLOCK when a copied table changed since it was copied, so db.WithTx() retries
+type memoryTx struct {
+	sync.Mutex
+	mdb  *memoryDb
+	data data //copies of the tables written in the transaction
+	done bool
+}
+
+func (mdb *memoryDb) Begin(ctx context.Context) (db.ITx, db.IError) {
+	if err := ctx.Err(); err != nil {
+		return nil, db.Errorf(db.ERR_TX_FAILED, "failed to begin transaction: %v", err)
+	}
+	return &memoryTx{
+		mdb:  mdb,
+		data: data{},
+	}, nil
+}
+
+//view returns the tables of the transaction, after copying the specified tables that were not yet copied
+//the caller must lock the transaction and the db
+func (mtx *memoryTx) view(write []string) data {
+	for _, name := range write {
+		if _, ok := mtx.data[name]; !ok {
+			mtx.data[name] = mtx.mdb.data[name].clone()
+		}
+	}
+	d := make(data, len(mtx.mdb.data))
+	for name, td := range mtx.mdb.data {
+		d[name] = td
+	}
+	for name, td := range mtx.data {
+		d[name] = td
+	}
+	return d
+}
+
+func (mtx *memoryTx) Table(name string) (db.ITable, error) {
+	mtx.mdb.Lock()
+	defer mtx.mdb.Unlock()
+	t, ok := mtx.mdb.table[name]
+	if !ok {
+		return nil, fmt.Errorf("table(%s) was not added to the db", name)
+	}
+	txTable := *t
+	txTable.tx = mtx
+	return txTable, nil
+}
+
+func (mtx *memoryTx) MustTable(name string) db.ITable {
+	t, err := mtx.Table(name)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func (mtx *memoryTx) Commit() db.IError {
+	mtx.Lock()
+	defer mtx.Unlock()
+	if mtx.done {
+		return db.Errorf(db.ERR_TX_FAILED, "failed to commit: transaction already ended")
+	}
+	mtx.done = true
+	mtx.mdb.Lock()
+	defer mtx.mdb.Unlock()
+	for name, td := range mtx.data {
+		if mtx.mdb.data[name].version != td.version {
+			return db.Errorf(db.ERR_DEADLOCK, "failed to commit: table(%s) changed since the transaction wrote it", name)
+		}
+	}
+	for name, td := range mtx.data {
+		td.version++
+		mtx.mdb.data[name] = td
+	}
+	return nil
+}
+
+func (mtx *memoryTx) Rollback() db.IError {
+	mtx.Lock()
+	defer mtx.Unlock()
+	mtx.done = true
+	return nil
+}
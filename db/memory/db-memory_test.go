@@ -0,0 +1,216 @@
+package memory_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/go-msvc/msf/db"
+	"github.com/go-msvc/msf/db/dbtest"
+	"github.com/go-msvc/msf/db/memory"
+	"github.com/go-msvc/msf/model"
+)
+
+func TestConformance(t *testing.T) {
+	dbtest.RunConformance(t, func() db.IDatabase {
+		return memory.Config{}.MustCreate()
+	})
+}
+
+func TestSnapshot(t *testing.T) {
+	filename := "./test-snapshot.json"
+	os.Remove(filename)
+	defer os.Remove(filename)
+
+	m := model.New()
+	locationModel := m.MustAdd(dbtest.Location{})
+	stockModel := m.MustAdd(dbtest.Stock{})
+
+	d := memory.Config{Filename: filename}.MustCreate()
+	location, _ := d.AddTable(locationModel)
+	stock, _ := d.AddTable(stockModel)
+	locationId, _ := location.Add(dbtest.Location{Name: "one"})
+	stockId, _ := stock.Add(dbtest.Stock{Name: "box", Location: dbtest.Location{Item: model.Item{ID: locationId}}, Qty: 3})
+	if dberr := location.DelById(locationId); dberr == nil || dberr.Code() != db.ERR_FOREIGN_KEY {
+		t.Fatalf("deleted referenced location: %v", dberr)
+	}
+	d.Close()
+
+	//loaded items keep ids, uniq sets and references
+	d = memory.Config{Filename: filename}.MustCreate()
+	defer d.Close()
+	location, _ = d.AddTable(locationModel)
+	stock, _ = d.AddTable(stockModel)
+	item, dberr := stock.GetById(stockId)
+	if dberr != nil || item.(dbtest.Stock).Location.ID != locationId || item.(dbtest.Stock).Qty != 3 {
+		t.Fatalf("loaded stock: %+v, %v", item, dberr)
+	}
+	if _, dberr := location.Add(dbtest.Location{Name: "one"}); dberr == nil || dberr.Code() != db.ERR_DUPLICATE_KEY {
+		t.Fatalf("added duplicate after load: %v", dberr)
+	}
+	if dberr := location.DelById(locationId); dberr == nil || dberr.Code() != db.ERR_FOREIGN_KEY {
+		t.Fatalf("deleted referenced location after load: %v", dberr)
+	}
+	if id, _ := location.Add(dbtest.Location{Name: "two"}); id <= locationId {
+		t.Fatalf("id %d reused after load", id)
+	}
+}
+
+func TestSnapshotRelations(t *testing.T) {
+	filename := "./test-snapshot-relations.json"
+	os.Remove(filename)
+	defer os.Remove(filename)
+
+	m := model.New()
+	categoryModel := m.MustAdd(dbtest.Category{})
+	productModel := m.MustAdd(dbtest.Product{})
+
+	d := memory.Config{Filename: filename}.MustCreate()
+	category, _ := d.AddTable(categoryModel)
+	product, _ := d.AddTable(productModel)
+	categoryId, _ := category.Add(dbtest.Category{Name: "one"})
+	productId, _ := product.Add(dbtest.Product{Name: "box", Categories: []dbtest.Category{{Item: model.Item{ID: categoryId}}}, Tags: []string{"b", "a"}})
+	d.Close()
+
+	//loaded items keep values and links
+	d = memory.Config{Filename: filename}.MustCreate()
+	defer d.Close()
+	category, _ = d.AddTable(categoryModel)
+	product, _ = d.AddTable(productModel)
+	item, dberr := product.GetById(productId)
+	if dberr != nil || len(item.(dbtest.Product).Tags) != 2 || item.(dbtest.Product).Tags[0] != "b" || item.(dbtest.Product).Categories != nil {
+		t.Fatalf("loaded product: %+v, %v", item, dberr)
+	}
+	items := []interface{}{item}
+	if dberr := product.Include(items, "categories"); dberr != nil || len(items[0].(dbtest.Product).Categories) != 1 || items[0].(dbtest.Product).Categories[0].Name != "one" {
+		t.Fatalf("loaded links: %+v, %v", items, dberr)
+	}
+	if dberr := category.DelById(categoryId); dberr == nil || dberr.Code() != db.ERR_FOREIGN_KEY {
+		t.Fatalf("deleted linked category after load: %v", dberr)
+	}
+}
+
+func TestTx(t *testing.T) {
+	m := model.New()
+	d := memory.Config{}.MustCreate()
+	defer d.Close()
+	location, _ := d.AddTable(m.MustAdd(dbtest.Location{}))
+
+	//rolled back
+	tx, _ := d.Begin(context.Background())
+	tx.MustTable("location").Add(dbtest.Location{Name: "one"})
+	tx.Rollback()
+	if _, dberr := location.GetOneByKey(db.Key{"name": "one"}); dberr == nil || dberr.Code() != db.ERR_NOT_FOUND {
+		t.Fatalf("rolled back item found: %v", dberr)
+	}
+
+	//concurrent change fails with deadlock, which WithTx retries
+	tx, _ = d.Begin(context.Background())
+	tx.MustTable("location").Add(dbtest.Location{Name: "one"})
+	location.Add(dbtest.Location{Name: "two"})
+	if dberr := tx.Commit(); dberr == nil || dberr.Code() != db.ERR_DEADLOCK {
+		t.Fatalf("commit after concurrent change: %v", dberr)
+	}
+	attempts := 0
+	err := db.WithTx(context.Background(), d, func(tx db.ITx) error {
+		attempts++
+		if _, dberr := tx.MustTable("location").Add(dbtest.Location{Name: "three"}); dberr != nil {
+			return dberr
+		}
+		if attempts == 1 {
+			location.Add(dbtest.Location{Name: "four"})
+		}
+		return nil
+	})
+	if err != nil || attempts != 2 {
+		t.Fatalf("WithTx: %v after %d attempts", err, attempts)
+	}
+	if _, dberr := location.GetOneByKey(db.Key{"name": "three"}); dberr != nil {
+		t.Fatalf("committed item not found: %v", dberr)
+	}
+}
+
+func TestTxTables(t *testing.T) {
+	m := model.New()
+	d := memory.Config{}.MustCreate()
+	defer d.Close()
+	location, _ := d.AddTable(m.MustAdd(dbtest.Location{}))
+	category, _ := d.AddTable(m.MustAdd(dbtest.Category{}))
+	stock, _ := d.AddTable(m.MustAdd(dbtest.Stock{}))
+	locationId, _ := location.Add(dbtest.Location{Name: "one"})
+
+	//changes to other tables do not conflict
+	tx, _ := d.Begin(context.Background())
+	tx.MustTable("location").Add(dbtest.Location{Name: "two"})
+	category.Add(dbtest.Category{Name: "one"})
+	if dberr := tx.Commit(); dberr != nil {
+		t.Fatalf("commit after change to other table: %v", dberr)
+	}
+
+	//reads see committed changes to tables not written in the transaction
+	tx, _ = d.Begin(context.Background())
+	category.Add(dbtest.Category{Name: "two"})
+	if _, dberr := tx.MustTable("category").GetOneByKey(db.Key{"name": "two"}); dberr != nil {
+		t.Fatalf("committed item not found in transaction: %v", dberr)
+	}
+	tx.Rollback()
+
+	//referenced tables are written, so deleting a referenced item conflicts
+	tx, _ = d.Begin(context.Background())
+	if _, dberr := tx.MustTable("stock").Add(dbtest.Stock{Name: "box", Location: dbtest.Location{Item: model.Item{ID: locationId}}, Qty: 1}); dberr != nil {
+		t.Fatalf("add stock in transaction: %v", dberr)
+	}
+	if dberr := location.DelById(locationId); dberr != nil {
+		t.Fatalf("delete location not yet referenced: %v", dberr)
+	}
+	if dberr := tx.Commit(); dberr == nil || dberr.Code() != db.ERR_DEADLOCK {
+		t.Fatalf("commit after referenced item was deleted: %v", dberr)
+	}
+	if items, _ := stock.GetByKey(db.Key{}, 10); len(items) != 0 {
+		t.Fatalf("stock committed: %+v", items)
+	}
+}
+
+func TestTxSnapshot(t *testing.T) {
+	filename := "./test-tx-snapshot.json"
+	os.Remove(filename)
+	defer os.Remove(filename)
+
+	m := model.New()
+	locationModel := m.MustAdd(dbtest.Location{})
+	stockModel := m.MustAdd(dbtest.Stock{})
+
+	d := memory.Config{Filename: filename}.MustCreate()
+	location, _ := d.AddTable(locationModel)
+	stock, _ := d.AddTable(stockModel)
+	locationId, _ := location.Add(dbtest.Location{Name: "one"})
+	stock.Add(dbtest.Stock{Name: "box", Location: dbtest.Location{Item: model.Item{ID: locationId}}, Qty: 3})
+	d.Close()
+
+	//loading a table counts references in the tables it refers to, which a transaction copied
+	d = memory.Config{Filename: filename}.MustCreate()
+	defer d.Close()
+	location, _ = d.AddTable(locationModel)
+	tx, _ := d.Begin(context.Background())
+	tx.MustTable("location").Add(dbtest.Location{Name: "two"})
+	d.AddTable(stockModel)
+	if dberr := tx.Commit(); dberr == nil || dberr.Code() != db.ERR_DEADLOCK {
+		t.Fatalf("commit after table was loaded: %v", dberr)
+	}
+	if dberr := location.DelById(locationId); dberr == nil || dberr.Code() != db.ERR_FOREIGN_KEY {
+		t.Fatalf("deleted location referenced by loaded stock: %v", dberr)
+	}
+
+	//and tables added after Begin() can be used in the transaction
+	tx, _ = d.Begin(context.Background())
+	category, _ := d.AddTable(m.MustAdd(dbtest.Category{}))
+	if _, dberr := tx.MustTable("category").Add(dbtest.Category{Name: "one"}); dberr != nil {
+		t.Fatalf("add to table added after Begin(): %v", dberr)
+	}
+	if dberr := tx.Commit(); dberr != nil {
+		t.Fatalf("commit: %v", dberr)
+	}
+	if _, dberr := category.GetOneByKey(db.Key{"name": "one"}); dberr != nil {
+		t.Fatalf("committed item not found: %v", dberr)
+	}
+}
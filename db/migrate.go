@@ -0,0 +1,336 @@
+package db
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//ISqlDatabase is implemented by SQL databases that can run migrations
+type ISqlDatabase interface {
+	IDatabase
+	Conn() *sql.DB
+	Placeholder(n int) string //n'th placeholder in a statement, counting from 1, e.g. "?" or "$1"
+}
+
+//MigrationFunc is a migration step written in Go
+type MigrationFunc func(tx *sql.Tx) error
+
+//Migration is one versioned step, Up and Down are either SQL text or a MigrationFunc
+type Migration struct {
+	Version int64
+	Name    string
+	Up      interface{}
+	Down    interface{} //nil if the migration cannot be reverted
+}
+
+//MigrationStatus describes a migration of the binary or the db
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt string //RFC3339 when applied
+}
+
+//table where applied migrations are recorded
+const migrationsTable = "msf_migrations"
+
+//Migrator has the ordered migrations for a database
+//each migration runs in a transaction and is recorded with a checksum, so that edits of applied migrations are detected
+//note that MySQL commits DDL statements implicitly, so a failed migration with DDL may be partially applied
+type Migrator struct {
+	sync.Mutex
+	migrations []Migration //sorted by version
+}
+
+var (
+	migrators      = map[string]*Migrator{}
+	migratorsMutex sync.Mutex
+)
+
+//Migrations returns the migrator for the named db, then Open(name) runs its pending migrations, e.g.:
+//	db.Migrations("stock").MustAdd(1, "create location", "CREATE TABLE ...", "DROP TABLE ...")
+func Migrations(dbName string) *Migrator {
+	migratorsMutex.Lock()
+	defer migratorsMutex.Unlock()
+	m, ok := migrators[dbName]
+	if !ok {
+		m = &Migrator{migrations: []Migration{}}
+		migrators[dbName] = m
+	}
+	return m
+}
+
+//Add a migration with version > 0, up and down are SQL text or MigrationFunc, down may be nil
+//SQL text may have multiple statements separated by ";"
+func (m *Migrator) Add(version int64, name string, up interface{}, down interface{}) error {
+	if version < 1 {
+		return fmt.Errorf("migration(%s) version=%d must be > 0", name, version)
+	}
+	if up == nil {
+		return fmt.Errorf("migration(%d:%s) without up", version, name)
+	}
+	for _, step := range []interface{}{up, down} {
+		switch step.(type) {
+		case nil, string, MigrationFunc, func(tx *sql.Tx) error:
+		default:
+			return fmt.Errorf("migration(%d:%s) step %T is not SQL text or MigrationFunc", version, name, step)
+		}
+	}
+	m.Lock()
+	defer m.Unlock()
+	for _, existing := range m.migrations {
+		if existing.Version == version {
+			return fmt.Errorf("migration(%d:%s) has same version as migration(%d:%s)", version, name, existing.Version, existing.Name)
+		}
+	}
+	m.migrations = append(m.migrations, Migration{Version: version, Name: name, Up: up, Down: down})
+	sort.Slice(m.migrations, func(i, j int) bool { return m.migrations[i].Version < m.migrations[j].Version })
+	return nil
+}
+
+func (m *Migrator) MustAdd(version int64, name string, up interface{}, down interface{}) *Migrator {
+	if err := m.Add(version, name, up, down); err != nil {
+		panic(err)
+	}
+	return m
+}
+
+//checksum of the migration name and SQL text (Go functions cannot be hashed)
+func (migration Migration) checksum() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d:%s", migration.Version, migration.Name)
+	for _, step := range []interface{}{migration.Up, migration.Down} {
+		if text, ok := step.(string); ok {
+			fmt.Fprintf(h, ":%s", text)
+		} else {
+			fmt.Fprintf(h, ":%v", step != nil)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+//applied migration as recorded in the db
+type appliedMigration struct {
+	name      string
+	checksum  string
+	appliedAt string
+}
+
+//Up applies all pending migrations in order
+//it fails without changes when the db has migrations that the binary does not have, or that were edited after they were applied
+func (m *Migrator) Up(d IDatabase) error {
+	m.Lock()
+	defer m.Unlock()
+	sqlDb, applied, err := m.check(d)
+	if err != nil {
+		return err
+	}
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		if err := run(sqlDb, migration, migration.Up, true); err != nil {
+			return err
+		}
+		log.Infof("migration(%d:%s) applied", migration.Version, migration.Name)
+	}
+	return nil
+}
+
+//Down reverts applied migrations with version > toVersion, latest first
+func (m *Migrator) Down(d IDatabase, toVersion int64) error {
+	m.Lock()
+	defer m.Unlock()
+	sqlDb, applied, err := m.check(d)
+	if err != nil {
+		return err
+	}
+	for i := len(m.migrations) - 1; i >= 0 && m.migrations[i].Version > toVersion; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if migration.Down == nil {
+			return fmt.Errorf("migration(%d:%s) cannot be reverted", migration.Version, migration.Name)
+		}
+		if err := run(sqlDb, migration, migration.Down, false); err != nil {
+			return err
+		}
+		log.Infof("migration(%d:%s) reverted", migration.Version, migration.Name)
+	}
+	return nil
+}
+
+//Status lists the migrations of the binary followed by migrations that are only in the db
+func (m *Migrator) Status(d IDatabase) ([]MigrationStatus, error) {
+	m.Lock()
+	defer m.Unlock()
+	sqlDb, ok := d.(ISqlDatabase)
+	if !ok {
+		return nil, fmt.Errorf("db %T does not support migrations", d)
+	}
+	applied, err := readApplied(sqlDb)
+	if err != nil {
+		return nil, err
+	}
+	list := []MigrationStatus{}
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if a, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = a.appliedAt
+			delete(applied, migration.Version)
+		}
+		list = append(list, status)
+	}
+	for _, version := range sortedVersions(applied) {
+		list = append(list, MigrationStatus{Version: version, Name: applied[version].name, Applied: true, AppliedAt: applied[version].appliedAt})
+	}
+	return list, nil
+}
+
+//check the db is not ahead of the binary, and applied migrations did not change
+func (m *Migrator) check(d IDatabase) (ISqlDatabase, map[int64]appliedMigration, error) {
+	sqlDb, ok := d.(ISqlDatabase)
+	if !ok {
+		return nil, nil, fmt.Errorf("db %T does not support migrations", d)
+	}
+	applied, err := readApplied(sqlDb)
+	if err != nil {
+		return nil, nil, err
+	}
+	known := map[int64]Migration{}
+	for _, migration := range m.migrations {
+		known[migration.Version] = migration
+	}
+	for _, version := range sortedVersions(applied) {
+		migration, ok := known[version]
+		if !ok {
+			return nil, nil, fmt.Errorf("db has migration(%d:%s) which is unknown to this binary, the db is ahead of the binary", version, applied[version].name)
+		}
+		if migration.checksum() != applied[version].checksum {
+			return nil, nil, fmt.Errorf("migration(%d:%s) was changed after it was applied to the db", version, migration.Name)
+		}
+	}
+	return sqlDb, applied, nil
+}
+
+func readApplied(sqlDb ISqlDatabase) (map[int64]appliedMigration, error) {
+	if _, err := sqlDb.Conn().Exec("CREATE TABLE IF NOT EXISTS " + migrationsTable + " (" +
+		"version BIGINT NOT NULL PRIMARY KEY," +
+		"name VARCHAR(255) NOT NULL," +
+		"checksum VARCHAR(64) NOT NULL," +
+		"applied_at VARCHAR(40) NOT NULL)"); err != nil {
+		return nil, fmt.Errorf("failed to create table(%s): %v", migrationsTable, err)
+	}
+	rows, err := sqlDb.Conn().Query("SELECT version,name,checksum,applied_at FROM " + migrationsTable)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", migrationsTable, err)
+	}
+	defer rows.Close()
+	applied := map[int64]appliedMigration{}
+	for rows.Next() {
+		var version int64
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.name, &a.checksum, &a.appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", migrationsTable, err)
+		}
+		applied[version] = a
+	}
+	return applied, rows.Err()
+}
+
+func sortedVersions(applied map[int64]appliedMigration) []int64 {
+	versions := []int64{}
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return versions
+}
+
+//run one step of the migration in a transaction that also records (up) or removes (down) the version
+func run(sqlDb ISqlDatabase, migration Migration, step interface{}, up bool) error {
+	tx, err := sqlDb.Conn().Begin()
+	if err != nil {
+		return fmt.Errorf("migration(%d:%s) cannot begin transaction: %v", migration.Version, migration.Name, err)
+	}
+	defer tx.Rollback() //no effect after commit
+
+	switch s := step.(type) {
+	case string:
+		for _, statement := range splitStatements(s) {
+			if _, err := tx.Exec(statement); err != nil {
+				return fmt.Errorf("migration(%d:%s) failed SQL: %s: %v", migration.Version, migration.Name, statement, err)
+			}
+		}
+	case MigrationFunc:
+		err = s(tx)
+	case func(tx *sql.Tx) error:
+		err = s(tx)
+	}
+	if err != nil {
+		return fmt.Errorf("migration(%d:%s) failed: %v", migration.Version, migration.Name, err)
+	}
+
+	if up {
+		_, err = tx.Exec(fmt.Sprintf("INSERT INTO %s (version,name,checksum,applied_at) VALUES (%s,%s,%s,%s)",
+			migrationsTable, sqlDb.Placeholder(1), sqlDb.Placeholder(2), sqlDb.Placeholder(3), sqlDb.Placeholder(4)),
+			migration.Version, migration.Name, migration.checksum(), time.Now().UTC().Format(time.RFC3339))
+	} else {
+		_, err = tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE version=%s", migrationsTable, sqlDb.Placeholder(1)), migration.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("migration(%d:%s) cannot be recorded: %v", migration.Version, migration.Name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("migration(%d:%s) failed to commit: %v", migration.Version, migration.Name, err)
+	}
+	return nil
+} //run()
+
+//split SQL text on ";" outside quotes and comments, and skip empty statements
+func splitStatements(text string) []string {
+	statements := []string{}
+	current := strings.Builder{}
+	var quote rune //current quote character, 0 when not quoted
+	comment := false
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case comment:
+			if c == '\n' {
+				comment = false
+				current.WriteRune(c)
+			}
+			continue
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			comment = true
+			continue
+		case c == ';':
+			if statement := strings.TrimSpace(current.String()); statement != "" {
+				statements = append(statements, statement)
+			}
+			current.Reset()
+			continue
+		}
+		current.WriteRune(c)
+	}
+	if statement := strings.TrimSpace(current.String()); statement != "" {
+		statements = append(statements, statement)
+	}
+	return statements
+}
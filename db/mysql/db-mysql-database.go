@@ -1,16 +1,17 @@
 package mysql
 
 import (
-	"database/sql"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
-	"os"
-	"sync"
+	"io/ioutil"
+	"net/url"
 
 	"github.com/go-msvc/msf/db"
+	"github.com/go-msvc/msf/db/sqldb"
+	"github.com/go-msvc/msf/db/sqlite"
 	"github.com/go-msvc/msf/logger"
-	"github.com/go-msvc/msf/model"
-	_ "github.com/go-sql-driver/mysql"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/go-sql-driver/mysql"
 )
 
 var log = logger.New("msf").New("db-mysql") //.WithLevel(logger.LevelInfo)
@@ -22,10 +23,17 @@ func init() {
 type Config struct {
 	Host           string `json:"host"`
 	Port           int    `json:"port"`
-	SqliteFilename string `json:"sqlite"` //filename to use instead of MySQL host+port
+	SqliteFilename string `json:"sqlite"` //deprecated: filename to use instead of MySQL host+port, rather configure db/sqlite
 	DbName         string `json:"db_name"`
 	DbUser         string `json:"db_user"`
 	DbPass         string `json:"db_pass"`
+	Migrate        string `json:"migrate"`    //policy when existing tables differ from the model: "apply" (default), "refuse" or "log"
+	BatchSize      int    `json:"batch_size"` //max nr of rows inserted in one statement by AddMany() (default 100)
+	Tls            string `json:"tls"`        //"false" (default), "true", "skip-verify" (no certificate check) or "preferred" (use TLS if server supports it)
+	TlsCaFile      string `json:"tls_ca"`     //PEM file with CA certificates to verify the server, default uses the system CAs
+	TlsCertFile    string `json:"tls_cert"`   //PEM file with client certificate, along with tls_key
+	TlsKeyFile     string `json:"tls_key"`
+	sqldb.PoolConfig
 }
 
 func (c *Config) Validate() error {
@@ -50,6 +58,28 @@ func (c *Config) Validate() error {
 	if c.DbPass == "" {
 		return fmt.Errorf("missing db_pass")
 	}
+	if err := sqldb.ValidateMigrate(&c.Migrate); err != nil {
+		return err
+	}
+	if err := sqldb.ValidateBatchSize(&c.BatchSize); err != nil {
+		return err
+	}
+	switch c.Tls {
+	case "":
+		c.Tls = "false"
+	case "false", "true", "skip-verify", "preferred":
+	default:
+		return fmt.Errorf("tls=\"%s\" is not one of false, true, skip-verify or preferred", c.Tls)
+	}
+	if (c.TlsCertFile == "") != (c.TlsKeyFile == "") {
+		return fmt.Errorf("tls_cert and tls_key must be specified together")
+	}
+	if (c.TlsCaFile != "" || c.TlsCertFile != "") && c.Tls != "true" && c.Tls != "skip-verify" {
+		return fmt.Errorf("tls_ca and tls_cert requires tls=true or tls=skip-verify")
+	}
+	if err := c.PoolConfig.Validate(); err != nil {
+		return err
+	}
 	return nil
 } //Config.Validate()
 
@@ -62,70 +92,63 @@ func (c Config) MustCreate() db.IDatabase {
 } //Config.MustCreate()
 
 func (c Config) Create() (db.IDatabase, error) {
-	mdb := &mysqlDb{
-		table: map[string]db.ITable{},
-	}
-
 	if c.SqliteFilename != "" {
-		dbfile, err := os.Open(c.SqliteFilename)
-		if err != nil {
-			dbfile, err = os.Create(c.SqliteFilename)
-			if err != nil {
-				return nil, fmt.Errorf("cannot open/create sqlite file \"%s\": %v", c.SqliteFilename, err)
-			}
-			log.Debugf("created sqlite file \"%s\"", c.SqliteFilename)
-		}
-		dbfile.Close()
-
-		mdb.conn, err = sql.Open("sqlite3", c.SqliteFilename)
-		if err != nil {
-			return nil, fmt.Errorf("failed to open sqlite file(%v): %v", c.SqliteFilename, err)
-		}
-	} else {
-		connectionString := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8&parseTime=True&loc=Local",
-			c.DbUser,
-			c.DbPass,
-			c.Host,
-			c.Port,
-			c.DbName,
-		)
-		var err error
-		mdb.conn, err = sql.Open("mysql", connectionString)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create mysql connector: %v: %v", connectionString, err)
-		}
+		return sqlite.Config{Filename: c.SqliteFilename, Migrate: c.Migrate, BatchSize: c.BatchSize, PoolConfig: c.PoolConfig}.Create()
 	}
-	return mdb, nil
-}
 
-//implements db.IDatabase
-type mysqlDb struct {
-	sync.Mutex
-	conn  *sql.DB
-	table map[string]db.ITable
-}
+	tlsName, err := c.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
 
-func (mdb mysqlDb) Close() {
-	mdb.conn.Close()
+	//clientFoundRows makes UPDATE report matched rather than changed rows, so not found can be detected
+	connectionString := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8&parseTime=True&loc=Local&clientFoundRows=true&tls=%s",
+		c.DbUser,
+		c.DbPass,
+		c.Host,
+		c.Port,
+		c.DbName,
+		url.QueryEscape(tlsName),
+	)
+	conn, err := c.PoolConfig.Open("mysql", connectionString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mysql db(%s) on %s:%d: %v", c.DbName, c.Host, c.Port, err)
+	}
+	log.Debugf("opened mysql db(%s) on %s:%d", c.DbName, c.Host, c.Port)
+	return sqldb.New(conn, dialect{}, c.Migrate, c.BatchSize), nil
 }
 
-func (mdb *mysqlDb) AddTable(itemModel model.IItem) (db.ITable, error) {
-	if itemModel == nil {
-		return nil, fmt.Errorf("cannot add itemModel=nil")
+//tlsConfig returns the DSN tls value, registering a custom TLS config
+//with the driver when CA or client certificate files are configured
+func (c Config) tlsConfig() (string, error) {
+	if c.TlsCaFile == "" && c.TlsCertFile == "" {
+		return c.Tls, nil
 	}
-
-	mdb.Lock()
-	defer mdb.Unlock()
-
-	if _, ok := mdb.table[itemModel.Name()]; ok {
-		return nil, fmt.Errorf("table(%s) already added to db", itemModel.Name())
+	tlsConfig := &tls.Config{
+		ServerName:         c.Host,
+		InsecureSkipVerify: c.Tls == "skip-verify",
 	}
-
-	t, err := newTable(mdb, itemModel)
-	if err != nil {
-		return nil, fmt.Errorf("failed to add table(%s): %v", itemModel.Name(), err)
+	if c.TlsCaFile != "" {
+		pem, err := ioutil.ReadFile(c.TlsCaFile)
+		if err != nil {
+			return "", fmt.Errorf("cannot read tls_ca file \"%s\": %v", c.TlsCaFile, err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return "", fmt.Errorf("no certificates in tls_ca file \"%s\"", c.TlsCaFile)
+		}
 	}
-	mdb.table[itemModel.Name()] = t
-	log.Infof("Added table(%s)", t.Name())
-	return t, nil
-}
+	if c.TlsCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.TlsCertFile, c.TlsKeyFile)
+		if err != nil {
+			return "", fmt.Errorf("cannot load tls_cert and tls_key: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	//registered per server+db so configs of different dbs do not replace each other
+	name := fmt.Sprintf("msf-%s-%d-%s", c.Host, c.Port, c.DbName)
+	if err := mysql.RegisterTLSConfig(name, tlsConfig); err != nil {
+		return "", fmt.Errorf("cannot register TLS config: %v", err)
+	}
+	return name, nil
+} //Config.tlsConfig()
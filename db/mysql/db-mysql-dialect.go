@@ -0,0 +1,176 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/go-msvc/msf/db"
+	"github.com/go-msvc/msf/db/sqldb"
+	"github.com/go-msvc/msf/model"
+	"github.com/go-sql-driver/mysql"
+)
+
+//implements sqldb.Dialect
+type dialect struct{}
+
+func (dialect) Quote(identifier string) string {
+	return "`" + strings.ReplaceAll(identifier, "`", "``") + "`"
+}
+
+func (dialect) Placeholder(n int) string { return "?" }
+
+//backslash is an escape character in MySQL string literals
+func (dialect) StringLiteral(s string) string {
+	return "'" + strings.NewReplacer("'", "''", "\\", "\\\\").Replace(s) + "'"
+}
+
+func (dialect) CurrentTimestamp() string { return "CURRENT_TIMESTAMP(6)" }
+
+//new id is read with LastInsertId()
+func (dialect) Returning(idColumn string) string { return "" }
+
+//LastInsertId() of a multi-row INSERT is the id of the first row
+func (dialect) FirstInsertId() bool { return true }
+
+//see Upsert()
+func (dialect) UpsertOnConflictColumns() bool { return false }
+
+//MySQL cannot specify the conflicting columns, so this updates on conflicts with any uniq set,
+//and items are not upserted with it, only rows of child and join tables, where that does not matter
+func (d dialect) Upsert(conflictColumns, updateColumns []string) string {
+	set := []string{}
+	for _, column := range updateColumns {
+		set = append(set, d.Quote(column)+"=VALUES("+d.Quote(column)+")")
+	}
+	return " ON DUPLICATE KEY UPDATE " + strings.Join(set, ",")
+}
+
+func (d dialect) IdColumn(tableName string) string {
+	return d.Quote(tableName+"_id") + " INT(11) NOT NULL AUTO_INCREMENT PRIMARY KEY"
+}
+
+func (dialect) ColumnType(f model.ItemField) (string, error) {
+	var def string
+	switch f.Kind {
+	case model.KindRef:
+		def = "INT(11)"
+	case model.KindString:
+		switch {
+		case f.Size == 0:
+			def = "VARCHAR(255)"
+		case f.Size <= 16383: //max VARCHAR length in utf8mb4
+			def = fmt.Sprintf("VARCHAR(%d)", f.Size)
+		case f.Size <= 65535:
+			def = "TEXT"
+		case f.Size <= 16777215:
+			def = "MEDIUMTEXT"
+		default:
+			def = "LONGTEXT"
+		}
+	case model.KindInt, model.KindUint:
+		switch f.Size {
+		case 1:
+			def = "TINYINT"
+		case 2:
+			def = "SMALLINT"
+		case 4:
+			def = "INT"
+		default:
+			def = "BIGINT"
+		}
+		if f.Kind == model.KindUint {
+			def += " UNSIGNED"
+		}
+	case model.KindFloat:
+		if f.Size == 4 {
+			def = "FLOAT"
+		} else {
+			def = "DOUBLE"
+		}
+	case model.KindDecimal:
+		def = fmt.Sprintf("DECIMAL(%d,%d)", f.Size, f.Scale)
+	case model.KindBool:
+		def = "BOOLEAN"
+	case model.KindTime:
+		def = "DATETIME(6)"
+	case model.KindBytes:
+		switch {
+		case f.Size == 0 || f.Size > 16777215:
+			def = "LONGBLOB"
+		case f.Size <= 255:
+			def = fmt.Sprintf("VARBINARY(%d)", f.Size)
+		case f.Size <= 65535:
+			def = "BLOB"
+		default:
+			def = "MEDIUMBLOB"
+		}
+	case model.KindJSON:
+		def = "JSON"
+	default:
+		return "", fmt.Errorf("field(%s) has unknown kind %v", f.Name, f.Kind)
+	}
+	return def, nil
+} //dialect.ColumnType()
+
+func (dialect) CreateTableOptions() string { return " ENGINE=InnoDB DEFAULT CHARSET=utf8" }
+
+func (dialect) AddColumnNeedsDefault() bool { return false }
+
+func (d dialect) AddForeignKey(table, column, refTable, refColumn string) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD FOREIGN KEY(%s) REFERENCES %s(%s)", d.Quote(table), d.Quote(column), d.Quote(refTable), d.Quote(refColumn))
+}
+
+func (dialect) Describe(conn *sql.DB, tableName string) (*sqldb.TableSchema, error) {
+	schema := &sqldb.TableSchema{Columns: map[string]sqldb.ColumnSchema{}}
+	rows, err := conn.Query("SELECT `COLUMN_NAME`,`COLUMN_TYPE`,`IS_NULLABLE` FROM information_schema.`COLUMNS` WHERE `TABLE_SCHEMA`=DATABASE() AND `TABLE_NAME`=?", tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, typ, nullable string
+		if err := rows.Scan(&name, &typ, &nullable); err != nil {
+			return nil, fmt.Errorf("failed to parse column: %v", err)
+		}
+		schema.Columns[name] = sqldb.ColumnSchema{Type: sqldb.NormalizeType(typ), Nullable: nullable == "YES"}
+	}
+	if len(schema.Columns) == 0 {
+		return nil, nil //table does not exist
+	}
+
+	indexRows, err := conn.Query("SELECT `INDEX_NAME`,`NON_UNIQUE`,`COLUMN_NAME` FROM information_schema.`STATISTICS` WHERE `TABLE_SCHEMA`=DATABASE() AND `TABLE_NAME`=? AND `INDEX_NAME`<>'PRIMARY' ORDER BY `INDEX_NAME`,`SEQ_IN_INDEX`", tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read indexes: %v", err)
+	}
+	defer indexRows.Close()
+	for indexRows.Next() {
+		var name, column string
+		var nonUnique int
+		if err := indexRows.Scan(&name, &nonUnique, &column); err != nil {
+			return nil, fmt.Errorf("failed to parse index: %v", err)
+		}
+		if n := len(schema.Indexes); n > 0 && schema.Indexes[n-1].Name == name {
+			schema.Indexes[n-1].Columns = append(schema.Indexes[n-1].Columns, column)
+		} else {
+			schema.Indexes = append(schema.Indexes, sqldb.IndexSchema{Name: name, Unique: nonUnique == 0, Columns: []string{column}})
+		}
+	}
+	return schema, nil
+} //dialect.Describe()
+
+func (dialect) ErrorCode(err error) (db.ErrorCode, bool) {
+	e, ok := err.(*mysql.MySQLError)
+	if !ok {
+		return 0, false
+	}
+	switch e.Number {
+	case 1062: //ER_DUP_ENTRY
+		return db.ERR_DUPLICATE_KEY, true
+	case 1451, 1452: //ER_ROW_IS_REFERENCED_2, ER_NO_REFERENCED_ROW_2
+		return db.ERR_FOREIGN_KEY, true
+	case 1205, 1213: //ER_LOCK_WAIT_TIMEOUT, ER_LOCK_DEADLOCK
+		return db.ERR_DEADLOCK, true
+	}
+	return 0, false
+}
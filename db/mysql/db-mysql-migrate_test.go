@@ -0,0 +1,86 @@
+package mysql_test
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/go-msvc/msf/config"
+	"github.com/go-msvc/msf/db"
+	_ "github.com/go-msvc/msf/db/mysql"
+)
+
+func TestMigrations(t *testing.T) {
+	dbFilename := "./test-migrations.db"
+	os.Remove(dbFilename)
+	defer os.Remove(dbFilename)
+
+	config.Set("db", map[string]interface{}{
+		"migrations": map[string]interface{}{
+			"mysql": map[string]interface{}{
+				"sqlite":  dbFilename,
+				"db_name": "test",
+				"db_user": "test",
+				"db_pass": "test",
+			},
+		},
+	})
+
+	m := db.Migrations("migrations")
+	m.MustAdd(1, "create color",
+		"CREATE TABLE color (name VARCHAR(64) NOT NULL PRIMARY KEY); INSERT INTO color (name) VALUES ('red;dish')",
+		"DROP TABLE color")
+	m.MustAdd(2, "add blue", db.MigrationFunc(func(tx *sql.Tx) error {
+		_, err := tx.Exec("INSERT INTO color (name) VALUES ('blue')")
+		return err
+	}), db.MigrationFunc(func(tx *sql.Tx) error {
+		_, err := tx.Exec("DELETE FROM color WHERE name='blue'")
+		return err
+	}))
+
+	//open applies all migrations
+	testDb := db.MustOpen("migrations")
+	if n := count(t, testDb, "SELECT COUNT(*) FROM color"); n != 2 {
+		t.Fatalf("%d colors instead of 2", n)
+	}
+	status, err := m.Status(testDb)
+	if err != nil || len(status) != 2 || !status[0].Applied || !status[1].Applied {
+		t.Fatalf("status: %+v, %v", status, err)
+	}
+
+	//down to version 1 reverts only version 2
+	if err := m.Down(testDb, 1); err != nil {
+		t.Fatalf("down failed: %v", err)
+	}
+	if n := count(t, testDb, "SELECT COUNT(*) FROM color"); n != 1 {
+		t.Fatalf("%d colors instead of 1", n)
+	}
+
+	//failed migration is rolled back
+	m.MustAdd(3, "fail", "INSERT INTO color (name) VALUES ('green'); INSERT INTO nothing VALUES (1)", nil)
+	if err := m.Up(testDb); err == nil {
+		t.Fatalf("failed migration did not fail")
+	}
+	if n := count(t, testDb, "SELECT COUNT(*) FROM color"); n != 2 {
+		t.Fatalf("%d colors instead of 2 (failed migration must be rolled back)", n)
+	}
+
+	//db ahead of the binary is refused
+	if err := db.Migrations("other").Up(testDb); err == nil {
+		t.Fatalf("migrated db that is ahead of the binary")
+	}
+	testDb.Close()
+
+	//open fails when migrations fail
+	if _, err := db.Open("migrations"); err == nil {
+		t.Fatalf("opened with failed migration")
+	}
+}
+
+func count(t *testing.T, d db.IDatabase, query string) int {
+	var n int
+	if err := d.(db.ISqlDatabase).Conn().QueryRow(query).Scan(&n); err != nil {
+		t.Fatalf("failed to count: %v", err)
+	}
+	return n
+}
@@ -2,11 +2,13 @@ package mysql_test
 
 import (
 	"os"
+	"strconv"
 	"testing"
 
 	"github.com/go-msvc/msf/config"
 	"github.com/go-msvc/msf/db"
-	_ "github.com/go-msvc/msf/db/mysql"
+	"github.com/go-msvc/msf/db/dbtest"
+	"github.com/go-msvc/msf/db/mysql"
 	"github.com/go-msvc/msf/model"
 )
 
@@ -23,7 +25,11 @@ type Stock struct {
 	//Second Location
 }
 
+//runs against the server in MYSQL_HOST with the stock db and user
 func TestOne(t *testing.T) {
+	if os.Getenv("MYSQL_HOST") == "" {
+		t.Skip("MYSQL_HOST not set")
+	}
 	dbFilename := "./test.db"
 	os.Remove(dbFilename)
 
@@ -34,6 +40,7 @@ func TestOne(t *testing.T) {
 				// "db_name": "test",
 				// "db_user": "test",
 				// "db_pass": "test",
+				"host":    os.Getenv("MYSQL_HOST"),
 				"db_name": "stock",
 				"db_user": "stock",
 				"db_pass": "P@$$w0rd",
@@ -92,6 +99,35 @@ func TestOne(t *testing.T) {
 	}
 }
 
+//runs against the server in MYSQL_HOST, e.g.:
+//	MYSQL_HOST=127.0.0.1 MYSQL_DATABASE=test MYSQL_USER=test MYSQL_PASSWORD=test go test -run Conformance ./db/mysql
+//all tables of the conformance tests are dropped in that db
+func TestConformance(t *testing.T) {
+	if os.Getenv("MYSQL_HOST") == "" {
+		t.Skip("MYSQL_HOST not set")
+	}
+	port, _ := strconv.Atoi(os.Getenv("MYSQL_PORT"))
+	c := mysql.Config{
+		Host:   os.Getenv("MYSQL_HOST"),
+		Port:   port,
+		DbName: os.Getenv("MYSQL_DATABASE"),
+		DbUser: os.Getenv("MYSQL_USER"),
+		DbPass: os.Getenv("MYSQL_PASSWORD"),
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	dbtest.RunConformance(t, func() db.IDatabase {
+		d := c.MustCreate()
+		for i := len(dbtest.TableNames) - 1; i >= 0; i-- {
+			if _, err := d.(db.ISqlDatabase).Conn().Exec("DROP TABLE IF EXISTS " + dbtest.TableNames[i]); err != nil {
+				t.Fatalf("failed to drop table(%s): %v", dbtest.TableNames[i], err)
+			}
+		}
+		return d
+	})
+}
+
 //todo:
 //commit to github, then proceed
 //read with join to get full struct returned
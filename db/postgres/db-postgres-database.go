@@ -0,0 +1,104 @@
+package postgres
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/go-msvc/msf/db"
+	"github.com/go-msvc/msf/db/sqldb"
+	"github.com/go-msvc/msf/logger"
+	_ "github.com/lib/pq"
+)
+
+var log = logger.New("msf").New("db-postgres")
+
+func init() {
+	db.Register("postgres", Config{})
+}
+
+type Config struct {
+	Host        string `json:"host"`
+	Port        int    `json:"port"`
+	DbName      string `json:"db_name"`
+	DbUser      string `json:"db_user"`
+	DbPass      string `json:"db_pass"`
+	SslMode     string `json:"sslmode"`     //"disable", "require" (default), "verify-ca" or "verify-full"
+	Migrate     string `json:"migrate"`     //policy when existing tables differ from the model: "apply" (default), "refuse" or "log"
+	BatchSize   int    `json:"batch_size"`  //max nr of rows inserted in one statement by AddMany() (default 100)
+	SslRootCert string `json:"sslrootcert"` //PEM file with CA certificates for verify-ca and verify-full
+	SslCert     string `json:"sslcert"`     //PEM file with client certificate, along with sslkey
+	SslKey      string `json:"sslkey"`
+	sqldb.PoolConfig
+}
+
+func (c *Config) Validate() error {
+	if c.Host == "" {
+		c.Host = "127.0.0.1"
+	}
+	if c.Port == 0 {
+		c.Port = 5432
+	}
+	if c.DbName == "" {
+		return fmt.Errorf("missing db_name")
+	}
+	if c.DbUser == "" {
+		return fmt.Errorf("missing db_user")
+	}
+	if c.DbPass == "" {
+		return fmt.Errorf("missing db_pass")
+	}
+	switch c.SslMode {
+	case "":
+		c.SslMode = "require"
+	case "disable", "require", "verify-ca", "verify-full":
+	default:
+		return fmt.Errorf("sslmode=\"%s\" is not one of disable, require, verify-ca or verify-full", c.SslMode)
+	}
+	if (c.SslCert == "") != (c.SslKey == "") {
+		return fmt.Errorf("sslcert and sslkey must be specified together")
+	}
+	if err := sqldb.ValidateMigrate(&c.Migrate); err != nil {
+		return err
+	}
+	if err := sqldb.ValidateBatchSize(&c.BatchSize); err != nil {
+		return err
+	}
+	if err := c.PoolConfig.Validate(); err != nil {
+		return err
+	}
+	return nil
+} //Config.Validate()
+
+func (c Config) MustCreate() db.IDatabase {
+	s, err := c.Create()
+	if err != nil {
+		panic(err)
+	}
+	return s
+} //Config.MustCreate()
+
+func (c Config) Create() (db.IDatabase, error) {
+	params := url.Values{"sslmode": []string{c.SslMode}}
+	for name, value := range map[string]string{
+		"sslrootcert": c.SslRootCert,
+		"sslcert":     c.SslCert,
+		"sslkey":      c.SslKey,
+	} {
+		if value != "" {
+			params.Set(name, value)
+		}
+	}
+	connectionURL := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(c.DbUser, c.DbPass),
+		Host:     fmt.Sprintf("%s:%d", c.Host, c.Port),
+		Path:     "/" + c.DbName,
+		RawQuery: params.Encode(),
+	}
+	conn, err := c.PoolConfig.Open("postgres", connectionURL.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open postgres %s: %v", connectionURL.Redacted(), err)
+	}
+	log.Debugf("opened postgres db(%s) on %s:%d", c.DbName, c.Host, c.Port)
+	return sqldb.New(conn, dialect{}, c.Migrate, c.BatchSize), nil
+}
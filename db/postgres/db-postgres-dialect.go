@@ -0,0 +1,183 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/go-msvc/msf/db"
+	"github.com/go-msvc/msf/db/sqldb"
+	"github.com/go-msvc/msf/model"
+	"github.com/lib/pq"
+)
+
+//implements sqldb.Dialect
+type dialect struct{}
+
+func (dialect) Quote(identifier string) string { return pq.QuoteIdentifier(identifier) }
+
+func (dialect) Placeholder(n int) string { return fmt.Sprintf("$%d", n) }
+
+func (dialect) StringLiteral(s string) string { return pq.QuoteLiteral(s) }
+
+func (dialect) CurrentTimestamp() string { return "CURRENT_TIMESTAMP" }
+
+//postgres has no LastInsertId(), so the new id is returned by the INSERT
+func (d dialect) Returning(idColumn string) string { return " RETURNING " + d.Quote(idColumn) }
+
+//not used, because ids are returned
+func (dialect) FirstInsertId() bool { return false }
+
+func (dialect) UpsertOnConflictColumns() bool { return true }
+
+func (d dialect) Upsert(conflictColumns, updateColumns []string) string {
+	conflict := []string{}
+	for _, column := range conflictColumns {
+		conflict = append(conflict, d.Quote(column))
+	}
+	set := []string{}
+	for _, column := range updateColumns {
+		set = append(set, d.Quote(column)+"=EXCLUDED."+d.Quote(column))
+	}
+	return " ON CONFLICT (" + strings.Join(conflict, ",") + ") DO UPDATE SET " + strings.Join(set, ",")
+}
+
+func (d dialect) IdColumn(tableName string) string {
+	return d.Quote(tableName+"_id") + " BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY"
+}
+
+//types are written as information_schema describes them, so that existing tables can be compared with the model
+func (dialect) ColumnType(f model.ItemField) (string, error) {
+	switch f.Kind {
+	case model.KindRef:
+		return "BIGINT", nil
+	case model.KindString:
+		switch {
+		case f.Size == 0:
+			return "VARCHAR(255)", nil
+		case f.Size <= 10485760: //max VARCHAR length
+			return fmt.Sprintf("VARCHAR(%d)", f.Size), nil
+		}
+		return "TEXT", nil
+	case model.KindInt:
+		switch f.Size {
+		case 1, 2:
+			return "SMALLINT", nil
+		case 4:
+			return "INTEGER", nil
+		}
+		return "BIGINT", nil
+	case model.KindUint:
+		//no unsigned types, so use the next larger type
+		switch f.Size {
+		case 1:
+			return "SMALLINT", nil
+		case 2:
+			return "INTEGER", nil
+		case 4:
+			return "BIGINT", nil
+		}
+		return "NUMERIC(20,0)", nil
+	case model.KindFloat:
+		if f.Size == 4 {
+			return "REAL", nil
+		}
+		return "DOUBLE PRECISION", nil
+	case model.KindDecimal:
+		return fmt.Sprintf("NUMERIC(%d,%d)", f.Size, f.Scale), nil
+	case model.KindBool:
+		return "BOOLEAN", nil
+	case model.KindTime:
+		return "TIMESTAMP WITH TIME ZONE", nil
+	case model.KindBytes:
+		return "BYTEA", nil
+	case model.KindJSON:
+		return "JSONB", nil
+	}
+	return "", fmt.Errorf("field(%s) has unknown kind %v", f.Name, f.Kind)
+} //dialect.ColumnType()
+
+func (dialect) CreateTableOptions() string { return "" }
+
+//postgres cannot add a NOT NULL column without a default to a table with rows
+func (dialect) AddColumnNeedsDefault() bool { return true }
+
+func (d dialect) AddForeignKey(table, column, refTable, refColumn string) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD FOREIGN KEY(%s) REFERENCES %s(%s)", d.Quote(table), d.Quote(column), d.Quote(refTable), d.Quote(refColumn))
+}
+
+func (dialect) Describe(conn *sql.DB, tableName string) (*sqldb.TableSchema, error) {
+	schema := &sqldb.TableSchema{Columns: map[string]sqldb.ColumnSchema{}}
+	rows, err := conn.Query("SELECT column_name,data_type,character_maximum_length,numeric_precision,numeric_scale,is_nullable"+
+		" FROM information_schema.columns WHERE table_schema=current_schema() AND table_name=$1", tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, typ, nullable string
+		var length, precision, scale sql.NullInt64
+		if err := rows.Scan(&name, &typ, &length, &precision, &scale, &nullable); err != nil {
+			return nil, fmt.Errorf("failed to parse column: %v", err)
+		}
+		switch typ {
+		case "character varying":
+			typ = "varchar"
+			if length.Valid {
+				typ = fmt.Sprintf("varchar(%d)", length.Int64)
+			}
+		case "numeric":
+			if precision.Valid {
+				typ = fmt.Sprintf("numeric(%d,%d)", precision.Int64, scale.Int64)
+			}
+		}
+		schema.Columns[name] = sqldb.ColumnSchema{Type: sqldb.NormalizeType(typ), Nullable: nullable == "YES"}
+	}
+	if len(schema.Columns) == 0 {
+		return nil, nil //table does not exist
+	}
+
+	indexRows, err := conn.Query("SELECT i.relname,x.indisunique,a.attname"+
+		" FROM pg_index x"+
+		" JOIN pg_class t ON t.oid=x.indrelid"+
+		" JOIN pg_class i ON i.oid=x.indexrelid"+
+		" JOIN LATERAL unnest(x.indkey) WITH ORDINALITY AS k(attnum,seq) ON true"+
+		" JOIN pg_attribute a ON a.attrelid=t.oid AND a.attnum=k.attnum"+
+		" WHERE t.relname=$1 AND t.relnamespace=current_schema()::regnamespace AND NOT x.indisprimary"+
+		" ORDER BY i.relname,k.seq", tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read indexes: %v", err)
+	}
+	defer indexRows.Close()
+	for indexRows.Next() {
+		var name, column string
+		var unique bool
+		if err := indexRows.Scan(&name, &unique, &column); err != nil {
+			return nil, fmt.Errorf("failed to parse index: %v", err)
+		}
+		if n := len(schema.Indexes); n > 0 && schema.Indexes[n-1].Name == name {
+			schema.Indexes[n-1].Columns = append(schema.Indexes[n-1].Columns, column)
+		} else {
+			schema.Indexes = append(schema.Indexes, sqldb.IndexSchema{Name: name, Unique: unique, Columns: []string{column}})
+		}
+	}
+	return schema, nil
+} //dialect.Describe()
+
+func (dialect) ErrorCode(err error) (db.ErrorCode, bool) {
+	e, ok := err.(*pq.Error)
+	if !ok {
+		return 0, false
+	}
+	switch e.Code {
+	case "23505": //unique_violation
+		return db.ERR_DUPLICATE_KEY, true
+	case "23503": //foreign_key_violation
+		return db.ERR_FOREIGN_KEY, true
+	case "40001", "40P01", "55P03": //serialization_failure, deadlock_detected, lock_not_available
+		return db.ERR_DEADLOCK, true
+	case "57014": //query_canceled, also when lib/pq cancels the statement because its context ended
+		return db.ERR_CANCELED, true
+	}
+	return 0, false
+}
@@ -0,0 +1,28 @@
+package postgres
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/go-msvc/msf/db"
+	"github.com/lib/pq"
+)
+
+func TestErrorCode(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		code db.ErrorCode
+		ok   bool
+	}{
+		{&pq.Error{Code: "23505"}, db.ERR_DUPLICATE_KEY, true},
+		{&pq.Error{Code: "23503"}, db.ERR_FOREIGN_KEY, true},
+		{&pq.Error{Code: "40P01"}, db.ERR_DEADLOCK, true},
+		{&pq.Error{Code: "57014"}, db.ERR_CANCELED, true},
+		{&pq.Error{Code: "42601"}, 0, false},
+		{fmt.Errorf("not a postgres error"), 0, false},
+	} {
+		if code, ok := (dialect{}).ErrorCode(test.err); code != test.code || ok != test.ok {
+			t.Fatalf("ErrorCode(%v) = %s, %v instead of %s, %v", test.err, db.ErrorName[code], ok, db.ErrorName[test.code], test.ok)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package postgres_test
+
+import (
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/go-msvc/msf/db"
+	"github.com/go-msvc/msf/db/dbtest"
+	"github.com/go-msvc/msf/db/postgres"
+)
+
+//runs against the server in PGHOST, e.g.:
+//	PGHOST=127.0.0.1 PGDATABASE=test PGUSER=test PGPASSWORD=test PGSSLMODE=disable go test ./db/postgres
+//all tables of the conformance tests are dropped in that db
+func TestConformance(t *testing.T) {
+	if os.Getenv("PGHOST") == "" {
+		t.Skip("PGHOST not set")
+	}
+	port, _ := strconv.Atoi(os.Getenv("PGPORT"))
+	c := postgres.Config{
+		Host:    os.Getenv("PGHOST"),
+		Port:    port,
+		DbName:  os.Getenv("PGDATABASE"),
+		DbUser:  os.Getenv("PGUSER"),
+		DbPass:  os.Getenv("PGPASSWORD"),
+		SslMode: os.Getenv("PGSSLMODE"),
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	dbtest.RunConformance(t, func() db.IDatabase {
+		d := c.MustCreate()
+		for i := len(dbtest.TableNames) - 1; i >= 0; i-- {
+			if _, err := d.(db.ISqlDatabase).Conn().Exec("DROP TABLE IF EXISTS " + dbtest.TableNames[i]); err != nil {
+				t.Fatalf("failed to drop table(%s): %v", dbtest.TableNames[i], err)
+			}
+		}
+		return d
+	})
+}
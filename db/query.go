@@ -0,0 +1,155 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-msvc/msf/model"
+)
+
+//QueryOptions for ITable.Query()
+type QueryOptions struct {
+	OrderBy   []Order  //items are always ordered by <name>_id after these fields, so the order is stable
+	Limit     int64    //max nr of items in the page, must be > 0
+	Offset    int64    //nr of items to skip, ignored when Cursor is used
+	Cursor    string   //Page.Next or Page.Prev from a previous query with the same filter and OrderBy
+	WithTotal bool     //true to count all items that match the filter in Page.Total
+	Include   []string //references to load in the page items, see ITable.Include()
+}
+
+type Order struct {
+	Field string //model field name
+	Desc  bool
+}
+
+//ParseOrder parses comma separated field names, with "-" prefix for descending order, e.g. "-qty,name"
+func ParseOrder(s string) []Order {
+	order := []Order{}
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		desc := strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(strings.TrimPrefix(name, "-"), "+")
+		if name != "" {
+			order = append(order, Order{Field: name, Desc: desc})
+		}
+	}
+	return order
+}
+
+type Page struct {
+	Items []interface{} //empty when nothing matched
+	Next  string        //cursor to get the next page, "" when there are no more items
+	Prev  string        //cursor to get the previous page, "" on the first page
+	Total int64         //nr of items matching the filter when QueryOptions.WithTotal, else -1
+}
+
+//FullOrder returns the options order followed by own id, unless own id is already in the order
+//it fails when an order field is not in the model
+func (opts QueryOptions) FullOrder(itemModel model.IItem) ([]Order, IError) {
+	idName := itemModel.Name() + "_id"
+	order := []Order{}
+	for _, o := range opts.OrderBy {
+		if _, ok := itemModel.FieldByName(o.Field); !ok {
+			return nil, Errorf(ERR_KEY_FIELD_UNKNOWN, "cannot order by %s.%s", itemModel.Name(), o.Field)
+		}
+		order = append(order, o)
+		if o.Field == idName {
+			return order, nil //id is unique, further fields will not change the order
+		}
+	}
+	return append(order, Order{Field: idName}), nil
+}
+
+//cursor refers to one item using the values of the order fields
+type cursor struct {
+	Values   []interface{} `json:"v"`
+	Backward bool          `json:"b,omitempty"` //true for items before the cursor item
+}
+
+//EncodeCursor makes a cursor for the item in a page
+//backward is false for the cursor to items after the item and true for items before the item
+func EncodeCursor(itemModel model.IItem, order []Order, item interface{}, backward bool) string {
+	c := cursor{Values: []interface{}{}, Backward: backward}
+	for _, o := range order {
+		f, _ := itemModel.FieldByName(o.Field)
+		c.Values = append(c.Values, f.Value(item))
+	}
+	jsonCursor, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(jsonCursor)
+}
+
+//CursorFilter returns the filter to select items after (or before when backward) the cursor item in the specified order
+//the cursor values are decoded into the Go types of the order fields, e.g. time.Time, so they compare as values
+//rather than as JSON text
+//ordering by fields that may be NULL is not supported with cursors
+func CursorFilter(itemModel model.IItem, order []Order, encodedCursor string) (filter Filter, backward bool, err IError) {
+	jsonCursor, decodeErr := base64.RawURLEncoding.DecodeString(encodedCursor)
+	if decodeErr != nil {
+		return nil, false, Errorf(ERR_INVALID_CURSOR, "invalid cursor: %v", decodeErr)
+	}
+	var c struct {
+		Values   []json.RawMessage `json:"v"`
+		Backward bool              `json:"b"`
+	}
+	if decodeErr := json.Unmarshal(jsonCursor, &c); decodeErr != nil {
+		return nil, false, Errorf(ERR_INVALID_CURSOR, "invalid cursor: %v", decodeErr)
+	}
+	if len(c.Values) != len(order) {
+		return nil, false, Errorf(ERR_INVALID_CURSOR, "cursor has %d values instead of %d for the order", len(c.Values), len(order))
+	}
+	values := make([]interface{}, len(order))
+	for i, o := range order {
+		f, ok := itemModel.FieldByName(o.Field)
+		if !ok {
+			return nil, false, Errorf(ERR_KEY_FIELD_UNKNOWN, "cannot order by %s.%s", itemModel.Name(), o.Field)
+		}
+		//type of the value in the item, e.g. int64 for a reference
+		valuePtr := reflect.New(reflect.ValueOf(f.Value(reflect.Zero(itemModel.StructType()).Interface())).Type())
+		if decodeErr := json.Unmarshal(c.Values[i], valuePtr.Interface()); decodeErr != nil {
+			return nil, false, Errorf(ERR_INVALID_CURSOR, "invalid cursor %s value: %v", o.Field, decodeErr)
+		}
+		value := valuePtr.Elem()
+		if value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				return nil, false, Errorf(ERR_INVALID_CURSOR, "invalid cursor %s value null", o.Field)
+			}
+			value = value.Elem()
+		}
+		values[i] = value.Interface()
+	}
+
+	//(a > va) OR (a = va AND b > vb) OR (a = va AND b = vb AND id > vid) ...
+	or := Or{}
+	for i, o := range order {
+		and := And{}
+		for j := 0; j < i; j++ {
+			and = append(and, Eq(order[j].Field, values[j]))
+		}
+		if o.Desc != c.Backward {
+			and = append(and, Lt(o.Field, values[i]))
+		} else {
+			and = append(and, Gt(o.Field, values[i]))
+		}
+		or = append(or, and)
+	}
+	return or, c.Backward, nil
+}
+
+//ReverseOrder is used to get items before a cursor, then the page must also be reversed
+func ReverseOrder(order []Order) []Order {
+	reversed := []Order{}
+	for _, o := range order {
+		reversed = append(reversed, Order{Field: o.Field, Desc: !o.Desc})
+	}
+	return reversed
+}
+
+func (o Order) String() string {
+	if o.Desc {
+		return fmt.Sprintf("-%s", o.Field)
+	}
+	return o.Field
+}
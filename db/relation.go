@@ -0,0 +1,51 @@
+package db
+
+import (
+	"github.com/go-msvc/msf/model"
+)
+
+//LinkRelation returns the many-to-many relation by name, see ITable.Link()
+func LinkRelation(itemModel model.IItem, name string) (model.ItemRelation, IError) {
+	r, ok := itemModel.RelationByName(name)
+	if !ok || r.RefItem == nil {
+		return model.ItemRelation{}, Errorf(ERR_KEY_FIELD_UNKNOWN, "%s has no many-to-many relation \"%s\"", itemModel.Name(), name)
+	}
+	return r, nil
+}
+
+//UpdFields returns the fields and relations that ITable.Upd() updates
+//without fieldNames, that is all fields except the own id and the values in child tables,
+//but not the links in join tables, which are only replaced when the relation is named
+//created_at and deleted_at are never updated, and modified_at always when the item has it
+//version is not in the fields, as the db increments it rather than writing the value in the item
+func UpdFields(itemModel model.IItem, fieldNames []string) ([]model.ItemField, []model.ItemRelation, IError) {
+	fields := []model.ItemField{}
+	relations := []model.ItemRelation{}
+	if len(fieldNames) == 0 {
+		for _, f := range itemModel.Fields()[1:] {
+			if !f.Auto {
+				fields = append(fields, f)
+			}
+		}
+		for _, r := range itemModel.Relations() {
+			if r.RefItem == nil {
+				relations = append(relations, r)
+			}
+		}
+	}
+	for _, fieldName := range fieldNames {
+		if r, ok := itemModel.RelationByName(fieldName); ok {
+			relations = append(relations, r)
+			continue
+		}
+		f, ok := itemModel.FieldByName(fieldName)
+		if !ok || f.Auto || fieldName == itemModel.Name()+"_id" {
+			return nil, nil, Errorf(ERR_KEY_FIELD_UNKNOWN, "cannot update %s.%s", itemModel.Name(), fieldName)
+		}
+		fields = append(fields, f)
+	}
+	if f, ok := model.AutoField(itemModel, model.FieldModifiedAt); ok {
+		fields = append(fields, f)
+	}
+	return fields, relations, nil
+}
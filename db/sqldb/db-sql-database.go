@@ -0,0 +1,139 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/go-msvc/msf/db"
+	"github.com/go-msvc/msf/logger"
+	"github.com/go-msvc/msf/model"
+)
+
+var log = logger.New("msf").New("db-sql")
+
+//New returns a database on the connection, for backends that implement a Dialect
+//migrate is the policy for existing tables that differ from the model, see MigrateApply
+//batchSize is the max nr of rows inserted in one statement by ITable.AddMany()
+func New(conn *sql.DB, dialect Dialect, migrate string, batchSize int) db.IDatabase {
+	if batchSize < 1 {
+		batchSize = DefaultBatchSize
+	}
+	return &sqlDb{
+		conn:      conn,
+		dialect:   dialect,
+		migrate:   migrate,
+		batchSize: batchSize,
+		table:     map[string]db.ITable{},
+	}
+}
+
+//ValidateMigrate checks the migrate policy in a config and defaults to MigrateApply
+func ValidateMigrate(migrate *string) error {
+	switch *migrate {
+	case "":
+		*migrate = MigrateApply
+	case MigrateApply, MigrateRefuse, MigrateLog:
+	default:
+		return fmt.Errorf("migrate=\"%s\" is not one of \"%s\", \"%s\" or \"%s\"", *migrate, MigrateApply, MigrateRefuse, MigrateLog)
+	}
+	return nil
+}
+
+//default nr of rows inserted in one statement
+const DefaultBatchSize = 100
+
+//ValidateBatchSize checks the batch size in a config and defaults to DefaultBatchSize
+func ValidateBatchSize(batchSize *int) error {
+	switch {
+	case *batchSize == 0:
+		*batchSize = DefaultBatchSize
+	case *batchSize < 0:
+		return fmt.Errorf("invalid batch_size=%d", *batchSize)
+	}
+	return nil
+}
+
+//implements db.IDatabase
+type sqlDb struct {
+	sync.Mutex
+	conn      *sql.DB
+	dialect   Dialect
+	migrate   string //policy for tables that differ from the model
+	batchSize int    //max rows per INSERT in AddMany()
+	table     map[string]db.ITable
+}
+
+func (sdb *sqlDb) Close() {
+	sdb.Lock()
+	defer sdb.Unlock()
+	for _, t := range sdb.table {
+		t.(*sqlTable).close()
+	}
+	sdb.conn.Close()
+}
+
+func (sdb *sqlDb) AddTable(itemModel model.IItem) (db.ITable, error) {
+	if itemModel == nil {
+		return nil, fmt.Errorf("cannot add itemModel=nil")
+	}
+
+	sdb.Lock()
+	defer sdb.Unlock()
+
+	if _, ok := sdb.table[itemModel.Name()]; ok {
+		return nil, fmt.Errorf("table(%s) already added to db", itemModel.Name())
+	}
+
+	t, err := newTable(sdb, itemModel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add table(%s): %v", itemModel.Name(), err)
+	}
+	sdb.table[itemModel.Name()] = t
+	log.Infof("Added table(%s)", t.Name())
+	return t, nil
+}
+
+func (sdb *sqlDb) Ping(ctx context.Context) db.IError {
+	if err := sdb.conn.PingContext(ctx); err != nil {
+		return db.Errorf(db.ERR_CONNECTION, "ping failed: %v", err)
+	}
+	return nil
+}
+
+func (sdb *sqlDb) Stats() db.Stats {
+	s := sdb.conn.Stats()
+	return db.Stats{
+		MaxOpenConnections: s.MaxOpenConnections,
+		OpenConnections:    s.OpenConnections,
+		InUse:              s.InUse,
+		Idle:               s.Idle,
+		WaitCount:          s.WaitCount,
+		WaitDuration:       s.WaitDuration,
+		MaxIdleClosed:      s.MaxIdleClosed,
+		MaxIdleTimeClosed:  s.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  s.MaxLifetimeClosed,
+	}
+}
+
+//Conn implements db.ISqlDatabase
+func (sdb *sqlDb) Conn() *sql.DB { return sdb.conn }
+
+//Placeholder implements db.ISqlDatabase
+func (sdb *sqlDb) Placeholder(n int) string { return sdb.dialect.Placeholder(n) }
+
+//map driver errors to db error codes, else return defaultCode
+func (sdb *sqlDb) errorCode(err error, defaultCode db.ErrorCode) db.ErrorCode {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return db.ERR_CANCELED
+	}
+	if code, ok := sdb.dialect.ErrorCode(err); ok {
+		return code
+	}
+	return defaultCode
+}
+
+//quoted table or column name
+func (sdb *sqlDb) quote(name string) string { return sdb.dialect.Quote(name) }
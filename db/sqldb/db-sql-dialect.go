@@ -0,0 +1,88 @@
+package sqldb
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/go-msvc/msf/db"
+	"github.com/go-msvc/msf/model"
+)
+
+//Dialect has the SQL differences between databases
+//statements are generated with "?" placeholders and Placeholder() is used to rebind them when different
+type Dialect interface {
+	Quote(identifier string) string //quoted table or column name, e.g. `name` or "name"
+	Placeholder(n int) string       //n'th placeholder in a statement, counting from 1, e.g. "?" or "$1"
+	StringLiteral(s string) string  //quoted string for DDL where placeholders cannot be used
+	CurrentTimestamp() string       //column default for the current time
+
+	//Returning is appended to INSERT to return the new id, e.g. " RETURNING "x_id"", or "" to use LastInsertId()
+	Returning(idColumn string) string
+
+	//FirstInsertId is true when LastInsertId() of a multi-row INSERT is the first new id (MySQL), false if it is the last (sqlite)
+	FirstInsertId() bool
+
+	//Upsert is appended to INSERT to rather update the columns when the values conflict with the
+	//uniq constraint on conflictColumns, e.g. " ON CONFLICT ("name") DO UPDATE SET "qty"=excluded."qty""
+	Upsert(conflictColumns, updateColumns []string) string
+
+	//UpsertOnConflictColumns is false when Upsert updates on a conflict with any uniq constraint (MySQL),
+	//then ITable.Upsert selects the item by the conflict columns and updates or inserts it in a transaction
+	UpsertOnConflictColumns() bool
+
+	//DDL
+	IdColumn(tableName string) string                               //own id column definition with auto increment primary key
+	ColumnType(f model.ItemField) (string, error)                   //type of value or reference column, e.g. "VARCHAR(255)"
+	CreateTableOptions() string                                     //appended to CREATE TABLE (...), e.g. " ENGINE=InnoDB"
+	AddColumnNeedsDefault() bool                                    //true if NOT NULL columns can only be added to existing tables with a default
+	AddForeignKey(table, column, refTable, refColumn string) string //SQL to add a foreign key to an existing table, "" if not supported
+
+	//Describe reads the live table definition, or returns nil if the table does not exist
+	Describe(conn *sql.DB, tableName string) (*TableSchema, error)
+
+	//ErrorCode maps driver errors to db error codes, e.g. unique violations to db.ERR_DUPLICATE_KEY
+	ErrorCode(err error) (db.ErrorCode, bool)
+}
+
+//live definition of a table in the db, with lowercase types, e.g. "varchar(255)"
+type TableSchema struct {
+	Columns map[string]ColumnSchema
+	Indexes []IndexSchema //excluding the primary key
+}
+
+type ColumnSchema struct {
+	Type     string
+	Nullable bool
+}
+
+type IndexSchema struct {
+	Name    string
+	Unique  bool
+	Columns []string
+}
+
+//rebind "?" placeholders outside quotes when the dialect uses other placeholders
+func rebind(dialect Dialect, query string) string {
+	if dialect.Placeholder(1) == "?" {
+		return query
+	}
+	s := strings.Builder{}
+	var quote rune
+	n := 0
+	for _, c := range query {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '?':
+			n++
+			s.WriteString(dialect.Placeholder(n))
+			continue
+		}
+		s.WriteRune(c)
+	}
+	return s.String()
+}
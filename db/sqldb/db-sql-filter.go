@@ -0,0 +1,120 @@
+package sqldb
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-msvc/msf/db"
+)
+
+//escape character used with LIKE (not backslash which has different meaning in mysql and sqlite string literals)
+const likeEscape = "!"
+
+//return SQL condition with placeholders and the values for them
+func (t sqlTable) whereSQL(filter db.Filter) (string, []interface{}, db.IError) {
+	switch f := filter.(type) {
+	case db.And:
+		return t.whereGroupSQL(" AND ", "1=1", f)
+	case db.Or:
+		return t.whereGroupSQL(" OR ", "1=0", f)
+	case db.Cond:
+		return t.whereCondSQL(f)
+	}
+	return "", nil, db.Errorf(db.ERR_KEY_FIELD_TYPE, "no support for filter type %T", filter)
+}
+
+func (t sqlTable) whereGroupSQL(op string, emptySQL string, filters []db.Filter) (string, []interface{}, db.IError) {
+	if len(filters) == 0 {
+		return emptySQL, nil, nil
+	}
+	conditions := []string{}
+	args := []interface{}{}
+	for _, filter := range filters {
+		condition, conditionArgs, dberr := t.whereSQL(filter)
+		if dberr != nil {
+			return "", nil, dberr
+		}
+		conditions = append(conditions, "("+condition+")")
+		args = append(args, conditionArgs...)
+	}
+	return strings.Join(conditions, op), args, nil
+}
+
+func (t sqlTable) whereCondSQL(cond db.Cond) (string, []interface{}, db.IError) {
+	column, dberr := t.column(cond.Field)
+	if dberr != nil {
+		return "", nil, dberr
+	}
+
+	switch cond.Op {
+	case db.OP_EQ, db.OP_NE:
+		if cond.Value == nil {
+			if cond.Op == db.OP_EQ {
+				return column + " IS NULL", nil, nil
+			}
+			return column + " IS NOT NULL", nil, nil
+		}
+		fallthrough
+	case db.OP_LT, db.OP_LE, db.OP_GT, db.OP_GE:
+		if !isScalar(cond.Value) {
+			return "", nil, db.Errorf(db.ERR_KEY_FIELD_TYPE, "no support for %s.%s value type %T", t.itemModel.Name(), cond, cond.Value)
+		}
+		op := string(cond.Op)
+		if cond.Op == db.OP_NE {
+			op = "<>"
+		}
+		return column + op + "?", []interface{}{cond.Value}, nil
+
+	case db.OP_IN:
+		values, ok := cond.Value.([]interface{})
+		if !ok {
+			return "", nil, db.Errorf(db.ERR_KEY_FIELD_TYPE, "%s.%s requires []interface{} instead of %T", t.itemModel.Name(), cond, cond.Value)
+		}
+		if len(values) == 0 {
+			return "1=0", nil, nil
+		}
+		for _, v := range values {
+			if !isScalar(v) {
+				return "", nil, db.Errorf(db.ERR_KEY_FIELD_TYPE, "no support for %s.%s value type %T", t.itemModel.Name(), cond, v)
+			}
+		}
+		return column + " IN (?" + strings.Repeat(",?", len(values)-1) + ")", values, nil
+
+	case db.OP_LIKE, db.OP_PREFIX:
+		pattern, ok := cond.Value.(string)
+		if !ok {
+			return "", nil, db.Errorf(db.ERR_KEY_FIELD_TYPE, "%s.%s requires string instead of %T", t.itemModel.Name(), cond, cond.Value)
+		}
+		if cond.Op == db.OP_PREFIX {
+			pattern = strings.NewReplacer(likeEscape, likeEscape+likeEscape, "%", likeEscape+"%", "_", likeEscape+"_").Replace(pattern) + "%"
+		}
+		return column + " LIKE ? ESCAPE '" + likeEscape + "'", []interface{}{pattern}, nil
+
+	case db.OP_IS_NULL:
+		return column + " IS NULL", nil, nil
+
+	case db.OP_NOT_NULL:
+		return column + " IS NOT NULL", nil, nil
+	}
+	return "", nil, db.Errorf(db.ERR_KEY_FIELD_TYPE, "no support for %s.%s operator \"%s\"", t.itemModel.Name(), cond, cond.Op)
+} //sqlTable.whereCondSQL()
+
+//check if value can be compared to a column
+func isScalar(v interface{}) bool {
+	switch v.(type) {
+	case nil:
+		return false
+	case time.Time, []byte, driver.Valuer:
+		return true
+	}
+	switch reflect.TypeOf(v).Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package sqldb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-msvc/msf/db"
+)
+
+func (t sqlTable) Include(items []interface{}, include ...string) db.IError {
+	return t.IncludeContext(context.Background(), items, include...)
+}
+
+func (t sqlTable) IncludeContext(ctx context.Context, items []interface{}, include ...string) db.IError {
+	return db.IncludeRefs(ctx, t.itemModel, items, include, t.refTable, t.links)
+}
+
+//refTable returns another table of the db, in the same transaction as this table
+func (t sqlTable) refTable(name string) (db.ITable, error) {
+	if t.tx != nil {
+		return sqlTx{sdb: t.sdb, tx: t.tx}.Table(name)
+	}
+	t.sdb.Lock()
+	defer t.sdb.Unlock()
+	refTable, ok := t.sdb.table[name]
+	if !ok {
+		return nil, fmt.Errorf("table(%s) was not added to the db", name)
+	}
+	return refTable, nil
+}
+
+func (t sqlTable) QueryByRef(refName string, refId int64, options db.QueryOptions) (db.Page, db.IError) {
+	return t.QueryByRefContext(context.Background(), refName, refId, options)
+}
+
+func (t sqlTable) QueryByRefContext(ctx context.Context, refName string, refId int64, options db.QueryOptions) (db.Page, db.IError) {
+	filter, dberr := db.RefFilter(t.itemModel, refName, refId)
+	if dberr != nil {
+		return db.Page{}, dberr
+	}
+	return t.QueryContext(ctx, filter, options)
+}
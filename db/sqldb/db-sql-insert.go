@@ -0,0 +1,337 @@
+package sqldb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-msvc/msf/db"
+	"github.com/go-msvc/msf/model"
+)
+
+func (t sqlTable) AddMany(items []interface{}) ([]int64, db.IError) {
+	return t.AddManyContext(context.Background(), items)
+}
+
+//AddManyContext inserts up to batchSize items per statement, in a transaction so that all or none are added
+//consecutive items are only in the same statement when they insert the same columns,
+//because NULL values of fields with defaults are not inserted
+func (t sqlTable) AddManyContext(ctx context.Context, items []interface{}) ([]int64, db.IError) {
+	if t.tx == nil && (len(items) > 1 || len(t.itemModel.Relations()) > 0) {
+		var ids []int64
+		dberr := t.inTx(ctx, "AddMany", func(txTable sqlTable) db.IError {
+			var dberr db.IError
+			ids, dberr = txTable.AddManyContext(ctx, items)
+			return dberr
+		})
+		if dberr != nil {
+			return nil, dberr
+		}
+		return ids, nil
+	}
+
+	now := db.Now()
+	ids := make([]int64, 0, len(items))
+	var batchFieldNames []string
+	batchArgs := []interface{}{}
+	batchLen := 0
+	for i, itemValue := range items {
+		if reflect.TypeOf(itemValue) != t.itemModel.StructType() {
+			return nil, db.Errorf(db.ERR_INSERT_WRONG_TYPE, "cannot add item(%s)[%d] using %T instead of %v", t.itemModel.Name(), i, itemValue, t.itemModel.StructType())
+		}
+		if dberr := db.Validate(t.itemModel, itemValue); dberr != nil {
+			return nil, db.Errorf(db.ERR_INVALID, "cannot add item(%s)[%d]: %w", t.itemModel.Name(), i, dberr)
+		}
+		itemValue = db.SetTimestamps(t.itemModel, itemValue, now, true)
+		fieldNames, args, err := t.insertColumns(itemValue)
+		if err != nil {
+			return nil, db.Errorf(db.ERR_INSERT_WRONG_TYPE, "cannot add item(%s)[%d]: %v", t.itemModel.Name(), i, err)
+		}
+		if batchLen > 0 && (batchLen >= t.sdb.batchSize || !sameNames(fieldNames, batchFieldNames)) {
+			batchIds, dberr := t.insertBatch(ctx, batchFieldNames, batchLen, batchArgs)
+			if dberr != nil {
+				return nil, dberr
+			}
+			ids = append(ids, batchIds...)
+			batchArgs = []interface{}{}
+			batchLen = 0
+		}
+		batchFieldNames = fieldNames
+		batchArgs = append(batchArgs, args...)
+		batchLen++
+	}
+	if batchLen > 0 {
+		batchIds, dberr := t.insertBatch(ctx, batchFieldNames, batchLen, batchArgs)
+		if dberr != nil {
+			return nil, dberr
+		}
+		ids = append(ids, batchIds...)
+	}
+	if relations := t.itemModel.Relations(); len(relations) > 0 {
+		for i, itemValue := range items {
+			if dberr := t.writeRelations(ctx, ids[i], itemValue, relations, false); dberr != nil {
+				return nil, dberr
+			}
+		}
+	}
+	return ids, nil
+} //sqlTable.AddManyContext()
+
+//insert n rows with one statement and return their ids
+//without RETURNING, ids of the rows are consecutive from LastInsertId(), as auto increment
+//allocates them for one statement in MySQL (innodb_autoinc_lock_mode<2) and sqlite
+func (t sqlTable) insertBatch(ctx context.Context, fieldNames []string, n int, args []interface{}) ([]int64, db.IError) {
+	sql := t.insertRowsSQL(fieldNames, n)
+	log.Debugf("Insert %d rows into table(%s) SQL: %s", n, t.itemModel.Name(), sql)
+	ids := make([]int64, 0, n)
+	if returning := t.sdb.dialect.Returning(t.itemModel.Name() + "_id"); returning != "" {
+		rows, err := t.query(ctx, sql+returning, args...)
+		if err != nil {
+			return nil, db.Errorf(t.sdb.errorCode(err, db.ERR_INSERT_FAILED), "failed to insert(%s): %v", t.itemModel.Name(), err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return nil, db.Errorf(db.ERR_INSERT_NO_ID, "failed to get ids for add(%s): %v", t.itemModel.Name(), err)
+			}
+			ids = append(ids, id)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, db.Errorf(t.sdb.errorCode(err, db.ERR_INSERT_FAILED), "failed to insert(%s): %v", t.itemModel.Name(), err)
+		}
+		if len(ids) != n {
+			return nil, db.Errorf(db.ERR_INSERT_NO_ID, "failed to get ids for add(%s): %d rows returned instead of %d", t.itemModel.Name(), len(ids), n)
+		}
+		return ids, nil
+	}
+
+	result, err := t.exec(ctx, sql, args...)
+	if err != nil {
+		return nil, db.Errorf(t.sdb.errorCode(err, db.ERR_INSERT_FAILED), "failed to insert(%s): %v", t.itemModel.Name(), err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, db.Errorf(db.ERR_INSERT_NO_ID, "failed to get ids for add(%s): %v", t.itemModel.Name(), err)
+	}
+	if !t.sdb.dialect.FirstInsertId() {
+		id -= int64(n - 1)
+	}
+	for i := 0; i < n; i++ {
+		ids = append(ids, id+int64(i))
+	}
+	return ids, nil
+} //sqlTable.insertBatch()
+
+func sameNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (t sqlTable) Upsert(itemValue interface{}, conflictUniqSet string) (int64, db.IError) {
+	return t.UpsertContext(context.Background(), itemValue, conflictUniqSet)
+}
+
+//UpsertContext also replaces the values in child tables, but does not change links in join tables
+func (t sqlTable) UpsertContext(ctx context.Context, itemValue interface{}, conflictUniqSet string) (int64, db.IError) {
+	relations := t.valueRelations()
+	if len(relations) == 0 {
+		return t.upsert(ctx, itemValue, conflictUniqSet)
+	}
+	var id int64
+	dberr := t.inTx(ctx, "Upsert", func(txTable sqlTable) db.IError {
+		var dberr db.IError
+		if id, dberr = txTable.upsert(ctx, itemValue, conflictUniqSet); dberr != nil {
+			return dberr
+		}
+		return txTable.writeRelations(ctx, id, itemValue, relations, true)
+	})
+	if dberr != nil {
+		return 0, dberr
+	}
+	return id, nil
+}
+
+func (t sqlTable) upsert(ctx context.Context, itemValue interface{}, conflictUniqSet string) (int64, db.IError) {
+	if reflect.TypeOf(itemValue) != t.itemModel.StructType() {
+		return 0, db.Errorf(db.ERR_INSERT_WRONG_TYPE, "cannot upsert item(%s) using %T instead of %v", t.itemModel.Name(), itemValue, t.itemModel.StructType())
+	}
+	if dberr := db.Validate(t.itemModel, itemValue); dberr != nil {
+		return 0, dberr
+	}
+	itemValue = db.SetTimestamps(t.itemModel, itemValue, db.Now(), true)
+	_, uniqSets := t.uniqSets()
+	conflictFieldNames, ok := uniqSets[conflictUniqSet]
+	if !ok {
+		return 0, db.Errorf(db.ERR_KEY_FIELD_UNKNOWN, "%s has no uniq set \"%s\"", t.itemModel.Name(), conflictUniqSet)
+	}
+	fieldNames, args, err := t.insertColumns(itemValue)
+	if err != nil {
+		return 0, db.Errorf(db.ERR_INSERT_WRONG_TYPE, "cannot upsert item(%s): %v", t.itemModel.Name(), err)
+	}
+
+	//conflict values are always inserted, even NULL with a default, so they are the values used to find the item
+	key := db.Key{}
+	keyHasNull := false
+	for _, fieldName := range conflictFieldNames {
+		f, _ := t.itemModel.FieldByName(fieldName)
+		v, err := dbValue(f, itemValue)
+		if err != nil {
+			return 0, db.Errorf(db.ERR_INSERT_WRONG_TYPE, "cannot upsert item(%s): %v", t.itemModel.Name(), err)
+		}
+		if isNull(v) {
+			keyHasNull = true //NULL never conflicts
+		}
+		if !containsName(fieldNames, fieldName) {
+			fieldNames = append(fieldNames, fieldName)
+			args = append(args, v)
+		}
+		key[fieldName] = f.Value(itemValue)
+	}
+	//an existing item keeps created_at, is restored when it was soft deleted,
+	//and its version is incremented
+	_, hasCreatedAt := model.AutoField(t.itemModel, model.FieldCreatedAt)
+	_, versioned := model.AutoField(t.itemModel, model.FieldVersion)
+	updateFieldNames := []string{}
+	for _, fieldName := range fieldNames {
+		if (hasCreatedAt && fieldName == model.FieldCreatedAt) || (versioned && fieldName == model.FieldVersion) {
+			continue
+		}
+		if !containsName(conflictFieldNames, fieldName) {
+			updateFieldNames = append(updateFieldNames, fieldName)
+		}
+	}
+	if len(updateFieldNames) == 0 {
+		updateFieldNames = conflictFieldNames //nothing else to update, but the update is needed to return the id
+	}
+
+	if !t.sdb.dialect.UpsertOnConflictColumns() {
+		var id int64
+		dberr := t.inTx(ctx, "Upsert", func(txTable sqlTable) db.IError {
+			var dberr db.IError
+			id, dberr = txTable.updateOrInsert(ctx, key, keyHasNull, fieldNames, args, updateFieldNames, versioned)
+			return dberr
+		})
+		return id, dberr
+	}
+
+	sql := t.insertRowsSQL(fieldNames, 1) + t.sdb.dialect.Upsert(conflictFieldNames, updateFieldNames)
+	if versioned {
+		//qualified with the table for the existing row, as in postgres the unqualified column is ambiguous
+		column := t.sdb.quote(model.FieldVersion)
+		sql += "," + column + "=" + t.table() + "." + column + "+1"
+	}
+	log.Debugf("Upsert table(%s) SQL: %s", t.itemModel.Name(), sql)
+	if returning := t.sdb.dialect.Returning(t.itemModel.Name() + "_id"); returning != "" {
+		return t.insertReturning(ctx, sql+returning, args)
+	}
+	result, err := t.exec(ctx, sql, args...)
+	if err != nil {
+		return 0, db.Errorf(t.sdb.errorCode(err, db.ERR_INSERT_FAILED), "failed to upsert(%s): %v", t.itemModel.Name(), err)
+	}
+	if keyHasNull {
+		//must have been inserted
+		id, err := result.LastInsertId()
+		if err != nil {
+			return 0, db.Errorf(db.ERR_INSERT_NO_ID, "failed to get id for upsert(%s): %v", t.itemModel.Name(), err)
+		}
+		return id, nil
+	}
+
+	//LastInsertId() is not the updated id in all dbs, so read it with the key
+	sql = fmt.Sprintf("SELECT %s FROM %s", t.idColumn(), t.table())
+	where, whereArgs, dberr := t.whereSQL(db.KeyFilter(key))
+	if dberr != nil {
+		return 0, dberr
+	}
+	rows, err := t.query(ctx, sql+" WHERE "+where, whereArgs...)
+	if err != nil {
+		return 0, db.Errorf(t.sdb.errorCode(err, db.ERR_QUERY_FAILED), "failed to get id for upsert(%s): %v", t.itemModel.Name(), err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return 0, db.Errorf(t.sdb.errorCode(err, db.ERR_QUERY_FAILED), "failed to get id for upsert(%s): %v", t.itemModel.Name(), err)
+		}
+		return 0, db.Errorf(db.ERR_INSERT_NO_ID, "upserted %s not found", t.itemModel.Name())
+	}
+	var id int64
+	if err := rows.Scan(&id); err != nil {
+		return 0, db.Errorf(db.ERR_INSERT_NO_ID, "failed to get id for upsert(%s): %v", t.itemModel.Name(), err)
+	}
+	return id, nil
+} //sqlTable.upsert()
+
+//updateOrInsert upserts in a transaction when the dialect cannot limit the upsert to the conflict key:
+//the item with the key is locked and updated, or else the item is inserted,
+//so a conflict on another uniq set fails without changing the other item
+func (t sqlTable) updateOrInsert(ctx context.Context, key db.Key, keyHasNull bool, fieldNames []string, args []interface{}, updateFieldNames []string, versioned bool) (int64, db.IError) {
+	var id int64
+	found := false
+	if !keyHasNull {
+		where, whereArgs, dberr := t.whereSQL(db.KeyFilter(key))
+		if dberr != nil {
+			return 0, dberr
+		}
+		rows, err := t.query(ctx, fmt.Sprintf("SELECT %s FROM %s WHERE %s FOR UPDATE", t.idColumn(), t.table(), where), whereArgs...)
+		if err != nil {
+			return 0, db.Errorf(t.sdb.errorCode(err, db.ERR_QUERY_FAILED), "failed to get id for upsert(%s): %v", t.itemModel.Name(), err)
+		}
+		if found = rows.Next(); found {
+			err = rows.Scan(&id)
+		} else {
+			err = rows.Err()
+		}
+		rows.Close()
+		if err != nil {
+			return 0, db.Errorf(t.sdb.errorCode(err, db.ERR_QUERY_FAILED), "failed to get id for upsert(%s): %v", t.itemModel.Name(), err)
+		}
+	}
+	if !found {
+		sql := t.insertRowsSQL(fieldNames, 1)
+		log.Debugf("Upsert table(%s) SQL: %s", t.itemModel.Name(), sql)
+		result, err := t.exec(ctx, sql, args...)
+		if err != nil {
+			return 0, db.Errorf(t.sdb.errorCode(err, db.ERR_INSERT_FAILED), "failed to upsert(%s): %v", t.itemModel.Name(), err)
+		}
+		if id, err = result.LastInsertId(); err != nil {
+			return 0, db.Errorf(db.ERR_INSERT_NO_ID, "failed to get id for upsert(%s): %v", t.itemModel.Name(), err)
+		}
+		return id, nil
+	}
+
+	set := []string{}
+	setArgs := []interface{}{}
+	for i, fieldName := range fieldNames {
+		if containsName(updateFieldNames, fieldName) {
+			set = append(set, t.columns([]string{fieldName})+"=?")
+			setArgs = append(setArgs, args[i])
+		}
+	}
+	if versioned {
+		set = append(set, t.incrementVersionSQL())
+	}
+	sql := fmt.Sprintf("UPDATE %s SET %s WHERE %s=?", t.table(), strings.Join(set, ","), t.idColumn())
+	log.Debugf("Upsert table(%s) SQL: %s", t.itemModel.Name(), sql)
+	if _, err := t.exec(ctx, sql, append(setArgs, id)...); err != nil {
+		return 0, db.Errorf(t.sdb.errorCode(err, db.ERR_UPDATE_FAILED), "failed to upsert %s(%v): %v", t.itemModel.Name(), id, err)
+	}
+	return id, nil
+} //sqlTable.updateOrInsert()
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
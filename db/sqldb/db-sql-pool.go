@@ -0,0 +1,91 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/go-msvc/msf/config"
+)
+
+//PoolConfig is embedded in the backend configs to tune the connection pool
+//durations are specified as strings, e.g. "500ms", "5s" or "1m"
+type PoolConfig struct {
+	MaxOpenConns    int    `json:"max_open_conns"`     //0 means unlimited
+	MaxIdleConns    int    `json:"max_idle_conns"`     //0 uses the database/sql default of 2, <0 keeps no idle connections
+	ConnMaxLifetime string `json:"conn_max_lifetime"`  //connections are closed when older, not specified means forever
+	ConnMaxIdleTime string `json:"conn_max_idle_time"` //idle connections are closed when idle for longer, not specified means forever
+	ConnectTimeout  string `json:"connect_timeout"`    //time to retry the first connection in Create() (default 10s)
+
+	connMaxLifetime time.Duration
+	connMaxIdleTime time.Duration
+	connectTimeout  time.Duration
+}
+
+func (c *PoolConfig) Validate() error {
+	if c.MaxOpenConns < 0 {
+		return fmt.Errorf("invalid max_open_conns=%d", c.MaxOpenConns)
+	}
+	if c.MaxOpenConns > 0 && c.MaxIdleConns > c.MaxOpenConns {
+		return fmt.Errorf("max_idle_conns=%d > max_open_conns=%d", c.MaxIdleConns, c.MaxOpenConns)
+	}
+	if c.ConnectTimeout == "" {
+		c.ConnectTimeout = "10s"
+	}
+	return config.ParseDurations(
+		config.Duration{Name: "conn_max_lifetime", Value: c.ConnMaxLifetime, Parsed: &c.connMaxLifetime},
+		config.Duration{Name: "conn_max_idle_time", Value: c.ConnMaxIdleTime, Parsed: &c.connMaxIdleTime},
+		config.Duration{Name: "connect_timeout", Value: c.ConnectTimeout, Parsed: &c.connectTimeout},
+	)
+} //PoolConfig.Validate()
+
+//backoff between connection attempts in Open()
+const (
+	minRetryDelay = 100 * time.Millisecond
+	maxRetryDelay = 2 * time.Second
+)
+
+//Open the connection pool and ping until connected or connect_timeout expired,
+//so that wrong addresses and credentials fail on create rather than on the first query
+//without Validate() there is no connect_timeout and it pings only once
+func (c PoolConfig) Open(driverName, dataSourceName string) (*sql.DB, error) {
+	conn, err := sql.Open(driverName, dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetMaxOpenConns(c.MaxOpenConns)
+	if c.MaxIdleConns != 0 {
+		conn.SetMaxIdleConns(c.MaxIdleConns)
+	}
+	conn.SetConnMaxLifetime(c.connMaxLifetime)
+	conn.SetConnMaxIdleTime(c.connMaxIdleTime)
+
+	deadline := time.Now().Add(c.connectTimeout)
+	delay := minRetryDelay
+	for attempt := 1; ; attempt++ {
+		if c.connectTimeout == 0 {
+			err = conn.Ping()
+		} else {
+			ctx, cancel := context.WithDeadline(context.Background(), deadline)
+			err = conn.PingContext(ctx)
+			cancel()
+		}
+		if err == nil {
+			return conn, nil
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			conn.Close()
+			return nil, fmt.Errorf("cannot connect after %d attempts: %v", attempt, err)
+		}
+		if delay > remaining {
+			delay = remaining //last attempt at the deadline
+		}
+		log.Errorf("%s connection attempt %d failed (retry in %v): %v", driverName, attempt, delay, err)
+		time.Sleep(delay)
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+} //PoolConfig.Open()
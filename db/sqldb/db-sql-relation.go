@@ -0,0 +1,351 @@
+package sqldb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-msvc/msf/db"
+	"github.com/go-msvc/msf/model"
+)
+
+//column with the position of a value in a child table
+const relationSeq = "seq"
+
+//createRelationSQL returns the CREATE TABLE statement of a join or child table followed by CREATE INDEX statements
+//rows are deleted with the item, and linked items cannot be deleted while they are linked
+func (t sqlTable) createRelationSQL(r model.ItemRelation) ([]string, error) {
+	idType, err := t.sdb.dialect.ColumnType(model.ItemField{Name: r.IdName, Kind: model.KindRef})
+	if err != nil {
+		return nil, err
+	}
+	elemDefinition, err := t.sdb.columnDefinition(r.Elem)
+	if err != nil {
+		return nil, err
+	}
+	definitions := []string{t.sdb.quote(r.IdName) + " " + idType + " NOT NULL"}
+	primaryKey := []string{r.IdName, r.Elem.Name}
+	if r.RefItem == nil {
+		seqType, err := t.sdb.dialect.ColumnType(model.ItemField{Name: relationSeq, Kind: model.KindInt, Size: 4})
+		if err != nil {
+			return nil, err
+		}
+		definitions = append(definitions, t.sdb.quote(relationSeq)+" "+seqType+" NOT NULL")
+		primaryKey = []string{r.IdName, relationSeq}
+	}
+	definitions = append(definitions,
+		t.sdb.quote(r.Elem.Name)+" "+elemDefinition,
+		fmt.Sprintf("PRIMARY KEY(%s)", t.columns(primaryKey)),
+		fmt.Sprintf("FOREIGN KEY(%s) REFERENCES %s(%s) ON DELETE CASCADE", t.sdb.quote(r.IdName), t.table(), t.idColumn()))
+	indexStatements := []string{}
+	if r.RefItem != nil {
+		definitions = append(definitions, fmt.Sprintf("FOREIGN KEY(%s) REFERENCES %s(%s)",
+			t.sdb.quote(r.Elem.Name),
+			t.sdb.quote(r.RefItem.Name()),
+			t.sdb.quote(r.RefItem.Name()+"_id")))
+	}
+	if r.RefItem != nil || r.Elem.Index {
+		//linked ids are indexed for reverse lookups and to check links when linked items are deleted
+		indexStatements = append(indexStatements, fmt.Sprintf("CREATE INDEX %s ON %s (%s)",
+			t.sdb.quote(r.Table+"_"+r.Elem.Name), t.sdb.quote(r.Table), t.sdb.quote(r.Elem.Name)))
+	}
+
+	sql := "CREATE TABLE IF NOT EXISTS " + t.sdb.quote(r.Table) + " (" +
+		strings.Join(definitions, ",") +
+		")" + t.sdb.dialect.CreateTableOptions()
+	log.Debugf("Create table(%s) SQL: %s", r.Table, sql)
+	return append([]string{sql}, indexStatements...), nil
+} //sqlTable.createRelationSQL()
+
+//addRelations creates the join and child tables that do not exist yet
+//when the item table existed, that is a schema change applied according to the migrate policy
+//existing join and child tables are not compared with the model
+func (t sqlTable) addRelations(existed bool) db.IError {
+	for _, r := range t.itemModel.Relations() {
+		live, err := t.sdb.dialect.Describe(t.sdb.conn, r.Table)
+		if err != nil {
+			return db.Errorf(db.ERR_CREATE_TABLE, "cannot describe table(%s): %v", r.Table, err)
+		}
+		if live != nil {
+			continue
+		}
+		statements, err := t.createRelationSQL(r)
+		if err != nil {
+			return db.Errorf(db.ERR_CREATE_TABLE, "cannot create table(%s): %v", r.Table, err)
+		}
+		if existed {
+			switch t.sdb.migrate {
+			case MigrateRefuse:
+				return db.Errorf(db.ERR_CREATE_TABLE, "table(%s) does not match the model:\n  change: %s", t.itemModel.Name(), strings.Join(statements, "\n  change: "))
+			case MigrateLog:
+				log.Infof("table(%s) does not match the model:\n  change: %s", t.itemModel.Name(), strings.Join(statements, "\n  change: "))
+				continue
+			}
+		}
+		for _, statement := range statements {
+			if err := t.sdb.applyChange(t.itemModel.Name(), statement); err != nil {
+				return db.Errorf(db.ERR_CREATE_TABLE, "failed to create table(%s): %v", r.Table, err)
+			}
+		}
+	}
+	return nil
+} //sqlTable.addRelations()
+
+//relations with slices of values in child tables, which are read and written with the item
+func (t sqlTable) valueRelations() []model.ItemRelation {
+	relations := []model.ItemRelation{}
+	for _, r := range t.itemModel.Relations() {
+		if r.RefItem == nil {
+			relations = append(relations, r)
+		}
+	}
+	return relations
+}
+
+//writeRelations inserts rows for the slices in the item with id, after deleting existing rows when replace
+func (t sqlTable) writeRelations(ctx context.Context, id int64, itemValue interface{}, relations []model.ItemRelation, replace bool) db.IError {
+	for _, r := range relations {
+		if replace {
+			sql := fmt.Sprintf("DELETE FROM %s WHERE %s=?", t.sdb.quote(r.Table), t.sdb.quote(r.IdName))
+			if _, err := t.exec(ctx, sql, id); err != nil {
+				return db.Errorf(t.sdb.errorCode(err, db.ERR_UPDATE_FAILED), "failed to update %s(%v).%s: %v", t.itemModel.Name(), id, r.Name, err)
+			}
+		}
+		if r.RefItem != nil {
+			if dberr := t.insertLinks(ctx, r, id, r.RefIds(itemValue)); dberr != nil {
+				return dberr
+			}
+			continue
+		}
+		rows := [][]interface{}{}
+		slice := r.Slice(itemValue)
+		for i := 0; i < slice.Len(); i++ {
+			v, err := toDbValue(r.Elem, slice.Index(i).Interface())
+			if err != nil {
+				return db.Errorf(db.ERR_INSERT_WRONG_TYPE, "cannot write %s(%v).%s[%d]: %v", t.itemModel.Name(), id, r.Name, i, err)
+			}
+			rows = append(rows, []interface{}{id, i, v})
+		}
+		if dberr := t.insertRelationRows(ctx, r, []string{r.IdName, relationSeq, r.Elem.Name}, rows, false); dberr != nil {
+			return dberr
+		}
+	}
+	return nil
+} //sqlTable.writeRelations()
+
+//insert links of the item with id, ignoring links that exist
+func (t sqlTable) insertLinks(ctx context.Context, r model.ItemRelation, id int64, refIds []int64) db.IError {
+	rows := [][]interface{}{}
+	for _, refId := range uniqueIds(refIds) {
+		rows = append(rows, []interface{}{id, refId})
+	}
+	return t.insertRelationRows(ctx, r, []string{r.IdName, r.Elem.Name}, rows, true)
+}
+
+//insert rows into a join or child table with up to batchSize rows per statement
+//existing rows are updated with the same values, so they are ignored rather than duplicate keys
+func (t sqlTable) insertRelationRows(ctx context.Context, r model.ItemRelation, columns []string, rows [][]interface{}, ignoreExisting bool) db.IError {
+	for start := 0; start < len(rows); start += t.sdb.batchSize {
+		end := start + t.sdb.batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		row := "(" + strings.TrimSuffix(strings.Repeat("?,", len(columns)), ",") + ")"
+		sql := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s",
+			t.sdb.quote(r.Table),
+			t.columns(columns),
+			strings.TrimSuffix(strings.Repeat(row+",", end-start), ","))
+		if ignoreExisting {
+			sql += t.sdb.dialect.Upsert(columns, columns)
+		}
+		args := []interface{}{}
+		for _, values := range rows[start:end] {
+			args = append(args, values...)
+		}
+		if _, err := t.exec(ctx, sql, args...); err != nil {
+			return db.Errorf(t.sdb.errorCode(err, db.ERR_INSERT_FAILED), "failed to insert into %s: %v", r.Table, err)
+		}
+	}
+	return nil
+} //sqlTable.insertRelationRows()
+
+//loadValues reads the slices of values in child tables into the items, with one query per relation
+//items are replaced with copies that have the slices set
+func (t sqlTable) loadValues(ctx context.Context, items []interface{}) db.IError {
+	relations := t.valueRelations()
+	if len(relations) == 0 || len(items) == 0 {
+		return nil
+	}
+	idField := t.itemModel.Fields()[0]
+	itemValues := map[int64]reflect.Value{}
+	ids := []int64{}
+	for _, item := range items {
+		itemValue := reflect.New(t.itemModel.StructType()).Elem()
+		itemValue.Set(reflect.ValueOf(item))
+		id := idField.Value(item).(int64)
+		itemValues[id] = itemValue
+		ids = append(ids, id)
+	}
+	for _, r := range relations {
+		for start := 0; start < len(ids); start += t.sdb.batchSize {
+			end := start + t.sdb.batchSize
+			if end > len(ids) {
+				end = len(ids)
+			}
+			sql := fmt.Sprintf("SELECT %s,%s FROM %s WHERE %s IN (%s) ORDER BY %s,%s",
+				t.sdb.quote(r.IdName),
+				t.sdb.quote(r.Elem.Name),
+				t.sdb.quote(r.Table),
+				t.sdb.quote(r.IdName),
+				strings.TrimSuffix(strings.Repeat("?,", end-start), ","),
+				t.sdb.quote(r.IdName),
+				t.sdb.quote(relationSeq))
+			if dberr := t.loadValueRows(ctx, r, sql, ids[start:end], itemValues); dberr != nil {
+				return dberr
+			}
+		}
+	}
+	for i, id := range ids {
+		items[i] = itemValues[id].Interface()
+	}
+	return nil
+} //sqlTable.loadValues()
+
+//append the values in each row to the slice in the item
+func (t sqlTable) loadValueRows(ctx context.Context, r model.ItemRelation, sql string, ids []int64, itemValues map[int64]reflect.Value) db.IError {
+	args := []interface{}{}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	rows, err := t.query(ctx, sql, args...)
+	if err != nil {
+		return db.Errorf(t.sdb.errorCode(err, db.ERR_QUERY_FAILED), "%s.%s failed with SQL: %s: %v", t.itemModel.Name(), r.Name, sql, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		elemValue := reflect.New(r.StructField.Type.Elem()).Elem()
+		target, decode := scanTarget(r.Elem, elemValue)
+		if err := rows.Scan(&id, target); err != nil {
+			return db.Errorf(db.ERR_QUERY_ROW_PARSER, "%s.%s failed to parse row: %v", t.itemModel.Name(), r.Name, err)
+		}
+		if decode != nil {
+			if err := decode(); err != nil {
+				return db.Errorf(db.ERR_QUERY_ROW_PARSER, "%s.%s failed to parse row: %v", t.itemModel.Name(), r.Name, err)
+			}
+		}
+		slice := itemValues[id].FieldByIndex(r.StructField.Index)
+		slice.Set(reflect.Append(slice, elemValue))
+	}
+	if err := rows.Err(); err != nil {
+		return db.Errorf(t.sdb.errorCode(err, db.ERR_QUERY_FAILED), "%s.%s failed: %v", t.itemModel.Name(), r.Name, err)
+	}
+	return nil
+} //sqlTable.loadValueRows()
+
+//links implements db.LinksFunc for Include()
+func (t sqlTable) links(ctx context.Context, r model.ItemRelation, ids []int64) (map[int64][]int64, db.IError) {
+	linked := map[int64][]int64{}
+	if len(ids) == 0 {
+		return linked, nil
+	}
+	sql := fmt.Sprintf("SELECT %s,%s FROM %s WHERE %s IN (%s) ORDER BY %s,%s",
+		t.sdb.quote(r.IdName),
+		t.sdb.quote(r.Elem.Name),
+		t.sdb.quote(r.Table),
+		t.sdb.quote(r.IdName),
+		strings.TrimSuffix(strings.Repeat("?,", len(ids)), ","),
+		t.sdb.quote(r.IdName),
+		t.sdb.quote(r.Elem.Name))
+	args := []interface{}{}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	rows, err := t.query(ctx, sql, args...)
+	if err != nil {
+		return nil, db.Errorf(t.sdb.errorCode(err, db.ERR_QUERY_FAILED), "%s.%s failed with SQL: %s: %v", t.itemModel.Name(), r.Name, sql, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, refId int64
+		if err := rows.Scan(&id, &refId); err != nil {
+			return nil, db.Errorf(db.ERR_QUERY_ROW_PARSER, "%s.%s failed to parse row: %v", t.itemModel.Name(), r.Name, err)
+		}
+		linked[id] = append(linked[id], refId)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, db.Errorf(t.sdb.errorCode(err, db.ERR_QUERY_FAILED), "%s.%s failed: %v", t.itemModel.Name(), r.Name, err)
+	}
+	return linked, nil
+} //sqlTable.links()
+
+func (t sqlTable) Link(id int64, relation string, refIds ...int64) db.IError {
+	return t.LinkContext(context.Background(), id, relation, refIds...)
+}
+
+func (t sqlTable) LinkContext(ctx context.Context, id int64, relation string, refIds ...int64) db.IError {
+	r, dberr := db.LinkRelation(t.itemModel, relation)
+	if dberr != nil {
+		return dberr
+	}
+	if len(refIds) <= t.sdb.batchSize {
+		return t.insertLinks(ctx, r, id, refIds)
+	}
+	return t.inTx(ctx, "Link", func(txTable sqlTable) db.IError {
+		return txTable.insertLinks(ctx, r, id, refIds)
+	})
+}
+
+func (t sqlTable) Unlink(id int64, relation string, refIds ...int64) db.IError {
+	return t.UnlinkContext(context.Background(), id, relation, refIds...)
+}
+
+func (t sqlTable) UnlinkContext(ctx context.Context, id int64, relation string, refIds ...int64) db.IError {
+	r, dberr := db.LinkRelation(t.itemModel, relation)
+	if dberr != nil {
+		return dberr
+	}
+	sql := fmt.Sprintf("DELETE FROM %s WHERE %s=?", t.sdb.quote(r.Table), t.sdb.quote(r.IdName))
+	if len(refIds) == 0 {
+		if _, err := t.exec(ctx, sql, id); err != nil {
+			return db.Errorf(t.sdb.errorCode(err, db.ERR_DELETE_FAILED), "failed to unlink %s(%v).%s: %v", t.itemModel.Name(), id, r.Name, err)
+		}
+		return nil
+	}
+	refIds = uniqueIds(refIds)
+	unlink := func(table sqlTable) db.IError {
+		for start := 0; start < len(refIds); start += t.sdb.batchSize {
+			end := start + t.sdb.batchSize
+			if end > len(refIds) {
+				end = len(refIds)
+			}
+			args := []interface{}{id}
+			for _, refId := range refIds[start:end] {
+				args = append(args, refId)
+			}
+			batchSQL := sql + fmt.Sprintf(" AND %s IN (%s)", t.sdb.quote(r.Elem.Name), strings.TrimSuffix(strings.Repeat("?,", end-start), ","))
+			if _, err := table.exec(ctx, batchSQL, args...); err != nil {
+				return db.Errorf(t.sdb.errorCode(err, db.ERR_DELETE_FAILED), "failed to unlink %s(%v).%s: %v", t.itemModel.Name(), id, r.Name, err)
+			}
+		}
+		return nil
+	}
+	if len(refIds) <= t.sdb.batchSize {
+		return unlink(t)
+	}
+	return t.inTx(ctx, "Unlink", unlink)
+} //sqlTable.UnlinkContext()
+
+//ids without duplicates, in the same order
+func uniqueIds(ids []int64) []int64 {
+	unique := []int64{}
+	seen := map[int64]bool{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
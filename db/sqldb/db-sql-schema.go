@@ -0,0 +1,216 @@
+package sqldb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-msvc/msf/db"
+	"github.com/go-msvc/msf/model"
+)
+
+//policy for differences between an existing table and its item model, configured as "migrate"
+const (
+	MigrateApply  = "apply"  //apply additive changes (columns, indexes, uniq sets) and log other differences (default)
+	MigrateRefuse = "refuse" //fail to add the table with the list of differences
+	MigrateLog    = "log"    //only log the differences
+)
+
+//table where applied schema changes are recorded
+const schemaChangesTable = "msf_schema_changes"
+
+//NormalizeType returns the lowercase type without integer display width, e.g. "INT(11) UNSIGNED" -> "int unsigned"
+//dialects use it to describe column types that are compared with the types of the model
+func NormalizeType(typ string) string {
+	typ = strings.ToLower(strings.TrimSpace(typ))
+	for _, intType := range []string{"tinyint", "smallint", "mediumint", "int", "integer", "bigint"} {
+		if strings.HasPrefix(typ, intType+"(") && typ != "tinyint(1)" {
+			typ = intType + typ[strings.Index(typ, ")")+1:]
+		}
+	}
+	switch typ {
+	case "boolean", "bool":
+		return "tinyint(1)"
+	case "integer":
+		return "int"
+	}
+	return typ
+}
+
+func sameType(modelType string, liveType string) bool {
+	return modelType == liveType ||
+		(modelType == "json" && liveType == "longtext") //MariaDB stores JSON as LONGTEXT
+}
+
+//schemaChanges compares the live table with the item model and returns
+//SQL to apply the additive changes and descriptions of differences that cannot be applied
+func (t sqlTable) schemaChanges(live *TableSchema) (changes []string, differences []string, err error) {
+	changes = []string{}
+	differences = []string{}
+	fieldNames := map[string]bool{}
+	for i, f := range t.itemModel.Fields() {
+		fieldNames[f.Name] = true
+		typ, err := t.sdb.dialect.ColumnType(f)
+		if err != nil {
+			return nil, nil, err
+		}
+		typ = NormalizeType(typ)
+		column, ok := live.Columns[f.Name]
+		if !ok {
+			if i == 0 {
+				return nil, nil, fmt.Errorf("table(%s) exists without id column %s", t.itemModel.Name(), f.Name)
+			}
+			columnDefinition, err := t.sdb.columnDefinition(f)
+			if err != nil {
+				return nil, nil, err
+			}
+			if t.sdb.dialect.AddColumnNeedsDefault() && !f.Nullable && f.Default == nil {
+				columnDefinition += " DEFAULT " + zeroLiteral(f)
+			}
+			changes = append(changes, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", t.table(), t.sdb.quote(f.Name), columnDefinition))
+			if f.RefItem != nil {
+				if addForeignKey := t.sdb.dialect.AddForeignKey(t.itemModel.Name(), f.Name, f.RefItem.Name(), f.RefItem.Name()+"_id"); addForeignKey != "" {
+					changes = append(changes, addForeignKey)
+				} else {
+					differences = append(differences, fmt.Sprintf("column %s is added without FOREIGN KEY on %s which the db cannot add to an existing table", f.Name, f.RefItem.Name()))
+				}
+			}
+			continue
+		}
+		if i == 0 {
+			continue //own id type is not compared as it is the primary key with auto increment
+		}
+		if !sameType(typ, column.Type) {
+			differences = append(differences, fmt.Sprintf("column %s type is %s instead of %s", f.Name, column.Type, typ))
+		}
+		if column.Nullable != f.Nullable {
+			differences = append(differences, fmt.Sprintf("column %s nullable is %v instead of %v", f.Name, column.Nullable, f.Nullable))
+		}
+	}
+	liveColumnNames := []string{}
+	for name := range live.Columns {
+		liveColumnNames = append(liveColumnNames, name)
+	}
+	sort.Strings(liveColumnNames)
+	for _, name := range liveColumnNames {
+		if !fieldNames[name] {
+			differences = append(differences, fmt.Sprintf("column %s is not in the model", name))
+		}
+	}
+
+	//uniq sets are matched on the columns, because names are not kept in all dbs
+	uniqSetNames, uniqSets := t.uniqSets()
+	matchedIndexes := map[string]bool{}
+	for _, uniqSetName := range uniqSetNames {
+		if index, ok := live.findIndex(uniqSets[uniqSetName], true); ok {
+			matchedIndexes[index.Name] = true
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("CREATE UNIQUE INDEX %s ON %s (%s)", t.sdb.quote(t.itemModel.Name()+"_"+uniqSetName), t.table(), t.columns(uniqSets[uniqSetName])))
+	}
+	for _, index := range live.Indexes {
+		if index.Unique && !matchedIndexes[index.Name] {
+			differences = append(differences, fmt.Sprintf("unique index %s(%s) is not in the model", index.Name, strings.Join(index.Columns, ",")))
+		}
+	}
+	for _, f := range t.itemModel.Fields() {
+		if _, ok := live.findIndex([]string{f.Name}, false); f.Index && !ok {
+			changes = append(changes, fmt.Sprintf("CREATE INDEX %s ON %s (%s)", t.sdb.quote(t.itemModel.Name()+"_"+f.Name), t.table(), t.sdb.quote(f.Name)))
+		}
+	}
+	return changes, differences, nil
+} //sqlTable.schemaChanges()
+
+//find index on the columns, if not unique, any index starting with the columns will do
+func (live TableSchema) findIndex(columns []string, unique bool) (IndexSchema, bool) {
+	for _, index := range live.Indexes {
+		if unique && (!index.Unique || len(index.Columns) != len(columns)) {
+			continue
+		}
+		if len(index.Columns) < len(columns) {
+			continue
+		}
+		if strings.Join(index.Columns[:len(columns)], ",") == strings.Join(columns, ",") {
+			return index, true
+		}
+	}
+	return IndexSchema{}, false
+}
+
+//literal of the zero value for the field kind, used as default when adding a NOT NULL column to a table with rows
+func zeroLiteral(f model.ItemField) string {
+	switch f.Kind {
+	case model.KindString, model.KindJSON:
+		return "''"
+	case model.KindBytes:
+		return "X''"
+	case model.KindTime:
+		return "'0001-01-01 00:00:00'"
+	}
+	return "0"
+}
+
+//migrate compares the existing table with the model and applies the configured policy
+func (t sqlTable) migrate(live *TableSchema) db.IError {
+	changes, differences, err := t.schemaChanges(live)
+	if err != nil {
+		return db.Errorf(db.ERR_CREATE_TABLE, "cannot compare table(%s) with the model: %v", t.itemModel.Name(), err)
+	}
+	if len(changes) == 0 && len(differences) == 0 {
+		return nil
+	}
+	diff := ""
+	for _, change := range changes {
+		diff += "\n  change: " + change
+	}
+	for _, difference := range differences {
+		diff += "\n  difference: " + difference
+	}
+
+	switch t.sdb.migrate {
+	case MigrateRefuse:
+		return db.Errorf(db.ERR_CREATE_TABLE, "table(%s) does not match the model:%s", t.itemModel.Name(), diff)
+	case MigrateLog:
+		log.Infof("table(%s) does not match the model:%s", t.itemModel.Name(), diff)
+		return nil
+	}
+	for _, change := range changes {
+		if err := t.sdb.applyChange(t.itemModel.Name(), change); err != nil {
+			return db.Errorf(db.ERR_CREATE_TABLE, "failed to migrate table(%s): %v", t.itemModel.Name(), err)
+		}
+		log.Infof("table(%s) migrated: %s", t.itemModel.Name(), change)
+	}
+	for _, difference := range differences {
+		log.Errorf("table(%s) differs from the model: %s", t.itemModel.Name(), difference)
+	}
+	return nil
+} //sqlTable.migrate()
+
+//applyChange executes the SQL and records it in the schema changes table
+func (sdb *sqlDb) applyChange(tableName string, changeSQL string) error {
+	definitions := []string{}
+	for _, f := range []model.ItemField{
+		{Name: "table_name", Kind: model.KindString, Size: 64},
+		{Name: "change_sql", Kind: model.KindString, Size: 65535},
+		{Name: "applied_at", Kind: model.KindTime},
+	} {
+		typ, err := sdb.dialect.ColumnType(f)
+		if err != nil {
+			return err
+		}
+		definitions = append(definitions, sdb.quote(f.Name)+" "+typ+" NOT NULL")
+	}
+	if _, err := sdb.conn.Exec("CREATE TABLE IF NOT EXISTS " + sdb.quote(schemaChangesTable) + " (" + strings.Join(definitions, ",") + ")"); err != nil {
+		return fmt.Errorf("failed to create table(%s): %v", schemaChangesTable, err)
+	}
+	if _, err := sdb.conn.Exec(changeSQL); err != nil {
+		return fmt.Errorf("failed SQL: %s: %v", changeSQL, err)
+	}
+	if _, err := sdb.conn.Exec(rebind(sdb.dialect, fmt.Sprintf("INSERT INTO %s (%s,%s,%s) VALUES (?,?,?)",
+		sdb.quote(schemaChangesTable), sdb.quote("table_name"), sdb.quote("change_sql"), sdb.quote("applied_at"))),
+		tableName, changeSQL, time.Now()); err != nil {
+		return fmt.Errorf("failed to record change in %s: %v", schemaChangesTable, err)
+	}
+	return nil
+}
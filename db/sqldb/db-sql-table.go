@@ -0,0 +1,1025 @@
+package sqldb
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-msvc/msf/db"
+	"github.com/go-msvc/msf/model"
+)
+
+//implements db.ITable
+type sqlTable struct {
+	sdb       *sqlDb
+	itemModel model.IItem
+	stmts     *stmtCache
+	tx        *sql.Tx //nil when not in a transaction
+}
+
+//max prepared statements per table, because queries with IN lists and multi-row inserts have
+//different SQL for each nr of values, and dbs limit the nr of prepared statements, e.g. MySQL
+//max_prepared_stmt_count, so the least recently used statements are closed when more are prepared
+const maxCachedStmts = 64
+
+//prepared statements of a table by SQL text
+type stmtCache struct {
+	sync.Mutex
+	max  int
+	stmt map[string]*list.Element //value is *cachedStmt
+	lru  *list.List               //most recently used first
+}
+
+type cachedStmt struct {
+	query   string
+	stmt    *sql.Stmt
+	users   int  //nr of exec and query calls using the statement
+	evicted bool //removed from the cache, closed when there are no users
+}
+
+func newStmtCache(max int) *stmtCache {
+	return &stmtCache{max: max, stmt: map[string]*list.Element{}, lru: list.New()}
+}
+
+func newTable(sdb *sqlDb, itemModel model.IItem) (*sqlTable, db.IError) {
+	t := &sqlTable{
+		sdb:       sdb,
+		itemModel: itemModel,
+		stmts:     newStmtCache(maxCachedStmts),
+	}
+
+	live, err := sdb.dialect.Describe(sdb.conn, itemModel.Name())
+	if err != nil {
+		return nil, db.Errorf(db.ERR_CREATE_TABLE, "cannot describe table(%s): %v", itemModel.Name(), err)
+	}
+	if live != nil {
+		//table exists: compare with the model
+		if dberr := t.migrate(live); dberr != nil {
+			return nil, dberr
+		}
+		if dberr := t.addRelations(true); dberr != nil {
+			return nil, dberr
+		}
+		return t, nil
+	}
+
+	createTableSQL, err := t.createTableSQL()
+	if err != nil {
+		return nil, db.Errorf(db.ERR_CREATE_TABLE, "cannot create table(%s): %v", itemModel.Name(), err)
+	}
+	for _, statement := range createTableSQL {
+		if err := sdb.applyChange(itemModel.Name(), statement); err != nil {
+			return nil, db.Errorf(db.ERR_CREATE_TABLE, "failed to create table(%s): %v", itemModel.Name(), err)
+		}
+	}
+	if dberr := t.addRelations(false); dberr != nil {
+		return nil, dberr
+	}
+	return t, nil
+}
+
+func (t sqlTable) Model() model.IItem { return t.itemModel }
+
+func (t sqlTable) Name() string { return t.itemModel.Name() }
+
+//quoted table name
+func (t sqlTable) table() string { return t.sdb.quote(t.itemModel.Name()) }
+
+//quoted own id column name
+func (t sqlTable) idColumn() string { return t.sdb.quote(t.itemModel.Name() + "_id") }
+
+//notDeletedSQL is added to the WHERE clause to hide soft deleted items, see db.NotDeleted()
+func (t sqlTable) notDeletedSQL(ctx context.Context) string {
+	if _, ok := model.AutoField(t.itemModel, model.FieldDeletedAt); !ok || db.IsWithDeleted(ctx) {
+		return ""
+	}
+	return " AND " + t.sdb.quote(model.FieldDeletedAt) + " IS NULL"
+}
+
+//prepare returns the cached statement for the SQL, or prepares a new one
+//statements are written with "?" placeholders and rebound for the dialect
+//the statement must be released after use, so it is not closed while in use when evicted from the cache
+//the cache is not locked while preparing, because that may wait for a free connection,
+//while a transaction that holds one needs the cache to run its statements
+func (t sqlTable) prepare(ctx context.Context, query string) (*cachedStmt, error) {
+	if cs := t.stmts.use(query); cs != nil {
+		return cs, nil
+	}
+	stmt, err := t.sdb.conn.PrepareContext(ctx, rebind(t.sdb.dialect, query))
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare SQL: %s: %w", query, err)
+	}
+	t.stmts.Lock()
+	defer t.stmts.Unlock()
+	if cs := t.stmts.used(query); cs != nil {
+		stmt.Close() //prepared concurrently by another call
+		return cs, nil
+	}
+	cs := &cachedStmt{query: query, stmt: stmt, users: 1}
+	t.stmts.stmt[query] = t.stmts.lru.PushFront(cs)
+	for t.stmts.lru.Len() > t.stmts.max {
+		t.stmts.evict(t.stmts.lru.Back())
+	}
+	return cs, nil
+}
+
+//use returns the cached statement for the SQL counting the caller as a user, or nil
+func (c *stmtCache) use(query string) *cachedStmt {
+	c.Lock()
+	defer c.Unlock()
+	return c.used(query)
+}
+
+//used is use() with the cache already locked
+func (c *stmtCache) used(query string) *cachedStmt {
+	e, ok := c.stmt[query]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(e)
+	cs := e.Value.(*cachedStmt)
+	cs.users++
+	return cs
+}
+
+//release a statement returned by prepare()
+func (t sqlTable) release(cs *cachedStmt) {
+	t.stmts.Lock()
+	defer t.stmts.Unlock()
+	cs.users--
+	if cs.evicted && cs.users == 0 {
+		cs.stmt.Close()
+	}
+}
+
+//evict removes the statement from the cache, and closes it when not in use, else release() closes it
+//rows of a query keep working after the statement is closed
+func (c *stmtCache) evict(e *list.Element) {
+	cs := c.lru.Remove(e).(*cachedStmt)
+	delete(c.stmt, cs.query)
+	cs.evicted = true
+	if cs.users == 0 {
+		cs.stmt.Close()
+	}
+}
+
+//cached returns the prepared statement for the SQL, or nil
+//it may be closed when evicted, then the transaction prepares it again
+func (t sqlTable) cached(query string) *sql.Stmt {
+	t.stmts.Lock()
+	defer t.stmts.Unlock()
+	if e, ok := t.stmts.stmt[query]; ok {
+		return e.Value.(*cachedStmt).stmt
+	}
+	return nil
+}
+
+//in a transaction, statements are not prepared on the db, because that may wait
+//for a free connection while the transaction holds one
+func (t sqlTable) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if t.tx != nil {
+		if stmt := t.cached(query); stmt != nil {
+			return t.tx.StmtContext(ctx, stmt).ExecContext(ctx, args...)
+		}
+		return t.tx.ExecContext(ctx, rebind(t.sdb.dialect, query), args...)
+	}
+	cs, err := t.prepare(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer t.release(cs)
+	return cs.stmt.ExecContext(ctx, args...)
+}
+
+func (t sqlTable) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if t.tx != nil {
+		if stmt := t.cached(query); stmt != nil {
+			return t.tx.StmtContext(ctx, stmt).QueryContext(ctx, args...)
+		}
+		return t.tx.QueryContext(ctx, rebind(t.sdb.dialect, query), args...)
+	}
+	cs, err := t.prepare(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer t.release(cs)
+	return cs.stmt.QueryContext(ctx, args...)
+}
+
+func (t sqlTable) close() {
+	t.stmts.Lock()
+	defer t.stmts.Unlock()
+	for t.stmts.lru.Len() > 0 {
+		t.stmts.evict(t.stmts.lru.Back())
+	}
+}
+
+//quoted column name, only if it is a field in the item model
+func (t sqlTable) column(fieldName string) (string, db.IError) {
+	if _, ok := t.itemModel.FieldByName(fieldName); !ok {
+		return "", db.Errorf(db.ERR_KEY_FIELD_UNKNOWN, "field(%s) does not exist in %s", fieldName, t.itemModel.Name())
+	}
+	return t.sdb.quote(fieldName), nil
+}
+
+//comma separated list of quoted column names
+func (t sqlTable) columns(fieldNames []string) string {
+	quoted := []string{}
+	for _, fieldName := range fieldNames {
+		quoted = append(quoted, t.sdb.quote(fieldName))
+	}
+	return strings.Join(quoted, ",")
+}
+
+func (t sqlTable) Add(itemValue interface{}) (int64, db.IError) {
+	return t.AddContext(context.Background(), itemValue)
+}
+
+//AddContext also inserts the slices in join and child tables, in a transaction with the item
+func (t sqlTable) AddContext(ctx context.Context, itemValue interface{}) (int64, db.IError) {
+	if reflect.TypeOf(itemValue) != t.itemModel.StructType() {
+		return 0, db.Errorf(db.ERR_INSERT_WRONG_TYPE, "cannot add item(%s) using %T instead of %v", t.itemModel.Name(), itemValue, t.itemModel.StructType())
+	}
+	if dberr := db.Validate(t.itemModel, itemValue); dberr != nil {
+		return 0, dberr
+	}
+	itemValue = db.SetTimestamps(t.itemModel, itemValue, db.Now(), true)
+	relations := t.itemModel.Relations()
+	if len(relations) == 0 {
+		return t.insert(ctx, itemValue)
+	}
+	var id int64
+	dberr := t.inTx(ctx, "Add", func(txTable sqlTable) db.IError {
+		var dberr db.IError
+		if id, dberr = txTable.insert(ctx, itemValue); dberr != nil {
+			return dberr
+		}
+		return txTable.writeRelations(ctx, id, itemValue, relations, false)
+	})
+	if dberr != nil {
+		return 0, dberr
+	}
+	return id, nil
+}
+
+//insert the item row and return its new id
+func (t sqlTable) insert(ctx context.Context, itemValue interface{}) (int64, db.IError) {
+	sql, args, err := t.insertSQL(itemValue)
+	if err != nil {
+		return 0, db.Errorf(db.ERR_INSERT_WRONG_TYPE, "cannot add item(%s): %v", t.itemModel.Name(), err)
+	}
+	if returning := t.sdb.dialect.Returning(t.itemModel.Name() + "_id"); returning != "" {
+		return t.insertReturning(ctx, sql+returning, args)
+	}
+	result, err := t.exec(ctx, sql, args...)
+	if err != nil {
+		return 0, db.Errorf(t.sdb.errorCode(err, db.ERR_INSERT_FAILED), "failed to insert(%s): %v", t.itemModel.Name(), err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, db.Errorf(db.ERR_INSERT_NO_ID, "failed to get id for add(%s): %v", t.itemModel.Name(), err)
+	}
+	return id, nil
+}
+
+//insert and read the new id from the returned row, for dbs without LastInsertId()
+func (t sqlTable) insertReturning(ctx context.Context, sql string, args []interface{}) (int64, db.IError) {
+	rows, err := t.query(ctx, sql, args...)
+	if err != nil {
+		return 0, db.Errorf(t.sdb.errorCode(err, db.ERR_INSERT_FAILED), "failed to insert(%s): %v", t.itemModel.Name(), err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return 0, db.Errorf(t.sdb.errorCode(err, db.ERR_INSERT_FAILED), "failed to insert(%s): %v", t.itemModel.Name(), err)
+		}
+		return 0, db.Errorf(db.ERR_INSERT_NO_ID, "failed to get id for add(%s): no row returned", t.itemModel.Name())
+	}
+	var id int64
+	if err := rows.Scan(&id); err != nil {
+		return 0, db.Errorf(db.ERR_INSERT_NO_ID, "failed to get id for add(%s): %v", t.itemModel.Name(), err)
+	}
+	return id, nil
+}
+
+func (t sqlTable) GetById(id int64) (interface{}, db.IError) {
+	return t.GetByIdContext(context.Background(), id)
+}
+
+func (t sqlTable) GetByIdContext(ctx context.Context, id int64) (interface{}, db.IError) {
+	sql := fmt.Sprintf("SELECT %s FROM %s WHERE %s=?%s",
+		t.columns(t.itemModel.FieldNames()),
+		t.table(),
+		t.idColumn(),
+		t.notDeletedSQL(ctx))
+	rows, err := t.query(ctx, sql, id)
+	if err != nil {
+		return nil, db.Errorf(t.sdb.errorCode(err, db.ERR_QUERY_FAILED), "%s.GetById(%v) failed with SQL: %s: %v", t.itemModel.Name(), id, sql, err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, db.Errorf(t.sdb.errorCode(err, db.ERR_QUERY_FAILED), "%s.GetById(%v) failed: %v", t.itemModel.Name(), id, err)
+		}
+		return nil, db.Errorf(db.ERR_NOT_FOUND, "%s.GetById(%v) not found", t.itemModel.Name(), id)
+	}
+	item, err := newRow(t.itemModel).scan(rows)
+	if err != nil {
+		return nil, db.Errorf(db.ERR_QUERY_ROW_PARSER, "%s.GetById(%v) failed to parse row: %v", t.itemModel.Name(), id, err)
+	}
+	rows.Close() //before reading values in the same transaction
+	items := []interface{}{item}
+	if dberr := t.loadValues(ctx, items); dberr != nil {
+		return nil, dberr
+	}
+	return items[0], nil
+}
+
+//if >1: nil, ERR_FOUND_MANY; if 0: nil, ERR_NOT_FOUND
+func (t sqlTable) GetOneByKey(key map[string]interface{}) (interface{}, db.IError) {
+	return t.GetOneByFilterContext(context.Background(), db.KeyFilter(key))
+}
+
+func (t sqlTable) GetOneByKeyContext(ctx context.Context, key map[string]interface{}) (interface{}, db.IError) {
+	return t.GetOneByFilterContext(ctx, db.KeyFilter(key))
+}
+
+//if not found: nil, ERR_NOT_FOUND
+func (t sqlTable) GetByKey(key map[string]interface{}, limit int64) ([]interface{}, db.IError) {
+	return t.GetByFilterContext(context.Background(), db.KeyFilter(key), limit)
+}
+
+func (t sqlTable) GetByKeyContext(ctx context.Context, key map[string]interface{}, limit int64) ([]interface{}, db.IError) {
+	return t.GetByFilterContext(ctx, db.KeyFilter(key), limit)
+}
+
+//if >1: nil, ERR_FOUND_MANY; if 0: nil, ERR_NOT_FOUND
+func (t sqlTable) GetOneByFilter(filter db.Filter) (interface{}, db.IError) {
+	return t.GetOneByFilterContext(context.Background(), filter)
+}
+
+func (t sqlTable) GetOneByFilterContext(ctx context.Context, filter db.Filter) (interface{}, db.IError) {
+	filter = db.NotDeleted(ctx, t.itemModel, filter)
+	sql := fmt.Sprintf("SELECT %s FROM %s",
+		t.columns(t.itemModel.FieldNames()),
+		t.table())
+	args := []interface{}{}
+	if filter != nil {
+		where, whereArgs, dberr := t.whereSQL(filter)
+		if dberr != nil {
+			return nil, dberr
+		}
+		sql += " WHERE " + where
+		args = append(args, whereArgs...)
+	}
+	sql += " LIMIT 2" //2 so we can detect presence of >1
+
+	rows, err := t.query(ctx, sql, args...)
+	if err != nil {
+		return nil, db.Errorf(t.sdb.errorCode(err, db.ERR_QUERY_FAILED), "%s.GetOneByFilter(%v) failed with SQL: %s: %v", t.itemModel.Name(), filter, sql, err)
+	}
+	defer rows.Close()
+
+	count := 0
+	var item interface{}
+	for rows.Next() {
+		count++
+		if count > 1 {
+			return nil, db.Errorf(db.ERR_QUERY_ONE_HAS_MORE, "%s.GetOneByFilter(%v) multiple entries matched the filter", t.itemModel.Name(), filter)
+		}
+		if item, err = newRow(t.itemModel).scan(rows); err != nil {
+			return nil, db.Errorf(db.ERR_QUERY_ROW_PARSER, "%s.GetOneByFilter(%v) failed to parse row: %v", t.itemModel.Name(), filter, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, db.Errorf(t.sdb.errorCode(err, db.ERR_QUERY_FAILED), "%s.GetOneByFilter(%v) failed: %v", t.itemModel.Name(), filter, err)
+	}
+	if count == 0 {
+		return nil, db.Errorf(db.ERR_NOT_FOUND, "%s.GetOneByFilter(%v) not found", t.itemModel.Name(), filter)
+	}
+	items := []interface{}{item}
+	if dberr := t.loadValues(ctx, items); dberr != nil {
+		return nil, dberr
+	}
+	return items[0], nil
+}
+
+//if not found: nil, ERR_NOT_FOUND
+func (t sqlTable) GetByFilter(filter db.Filter, limit int64) ([]interface{}, db.IError) {
+	return t.GetByFilterContext(context.Background(), filter, limit)
+}
+
+func (t sqlTable) GetByFilterContext(ctx context.Context, filter db.Filter, limit int64) ([]interface{}, db.IError) {
+	if limit < 1 {
+		return nil, db.Errorf(db.ERR_NOT_FOUND, "%s.GetByFilter(%v) limit=%d will never return an item", t.itemModel.Name(), filter, limit)
+	}
+	filter = db.NotDeleted(ctx, t.itemModel, filter)
+	sql := fmt.Sprintf("SELECT %s FROM %s",
+		t.columns(t.itemModel.FieldNames()),
+		t.table())
+	args := []interface{}{}
+	if filter != nil {
+		where, whereArgs, dberr := t.whereSQL(filter)
+		if dberr != nil {
+			return nil, dberr
+		}
+		sql += " WHERE " + where
+		args = append(args, whereArgs...)
+	}
+	sql += " LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := t.query(ctx, sql, args...)
+	if err != nil {
+		return nil, db.Errorf(t.sdb.errorCode(err, db.ERR_QUERY_FAILED), "%s.GetByFilter(%v) failed with SQL: %s: %v", t.itemModel.Name(), filter, sql, err)
+	}
+	defer rows.Close()
+
+	items := []interface{}{}
+	for rows.Next() {
+		//parse into new struct and add to list
+		item, err := newRow(t.itemModel).scan(rows)
+		if err != nil {
+			return nil, db.Errorf(db.ERR_QUERY_ROW_PARSER, "%s.GetByFilter(%v) failed to parse row: %v", t.itemModel.Name(), filter, err)
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, db.Errorf(t.sdb.errorCode(err, db.ERR_QUERY_FAILED), "%s.GetByFilter(%v) failed: %v", t.itemModel.Name(), filter, err)
+	}
+	if len(items) == 0 {
+		return nil, db.Errorf(db.ERR_NOT_FOUND, "%s.GetByFilter(%v) not found", t.itemModel.Name(), filter)
+	}
+	if dberr := t.loadValues(ctx, items); dberr != nil {
+		return nil, dberr
+	}
+	return items, nil
+}
+
+//Query returns one page of items matching the filter (nil for all items)
+//a cursor selects items after/before the cursor item using the order, rather than skipping
+//offset rows, so pages stay consistent while items are added or deleted
+func (t sqlTable) Query(filter db.Filter, options db.QueryOptions) (db.Page, db.IError) {
+	return t.QueryContext(context.Background(), filter, options)
+}
+
+func (t sqlTable) QueryContext(ctx context.Context, filter db.Filter, options db.QueryOptions) (db.Page, db.IError) {
+	if options.Limit < 1 {
+		return db.Page{}, db.Errorf(db.ERR_KEY_FIELD_TYPE, "%s.Query(%v) limit=%d must be > 0", t.itemModel.Name(), filter, options.Limit)
+	}
+	order, dberr := options.FullOrder(t.itemModel)
+	if dberr != nil {
+		return db.Page{}, dberr
+	}
+	filter = db.NotDeleted(ctx, t.itemModel, filter)
+
+	page := db.Page{Items: []interface{}{}, Total: -1}
+	if options.WithTotal {
+		if page.Total, dberr = t.count(ctx, filter); dberr != nil {
+			return db.Page{}, dberr
+		}
+	}
+
+	pageFilter := filter
+	backward := false
+	if options.Cursor != "" {
+		var cursorFilter db.Filter
+		if cursorFilter, backward, dberr = db.CursorFilter(t.itemModel, order, options.Cursor); dberr != nil {
+			return db.Page{}, dberr
+		}
+		if filter != nil {
+			pageFilter = db.And{filter, cursorFilter}
+		} else {
+			pageFilter = cursorFilter
+		}
+	}
+	sqlOrder := order
+	if backward {
+		sqlOrder = db.ReverseOrder(order) //read back from the cursor, then reverse the page
+	}
+
+	sql := fmt.Sprintf("SELECT %s FROM %s",
+		t.columns(t.itemModel.FieldNames()),
+		t.table())
+	args := []interface{}{}
+	if pageFilter != nil {
+		where, whereArgs, dberr := t.whereSQL(pageFilter)
+		if dberr != nil {
+			return db.Page{}, dberr
+		}
+		sql += " WHERE " + where
+		args = append(args, whereArgs...)
+	}
+	sql += " ORDER BY " + t.orderSQL(sqlOrder)
+	sql += " LIMIT ?" //one more than limit to know if there are more items
+	args = append(args, options.Limit+1)
+	if options.Cursor == "" && options.Offset > 0 {
+		sql += " OFFSET ?"
+		args = append(args, options.Offset)
+	}
+
+	rows, err := t.query(ctx, sql, args...)
+	if err != nil {
+		return db.Page{}, db.Errorf(t.sdb.errorCode(err, db.ERR_QUERY_FAILED), "%s.Query(%v) failed with SQL: %s: %v", t.itemModel.Name(), pageFilter, sql, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		item, err := newRow(t.itemModel).scan(rows)
+		if err != nil {
+			return db.Page{}, db.Errorf(db.ERR_QUERY_ROW_PARSER, "%s.Query(%v) failed to parse row: %v", t.itemModel.Name(), pageFilter, err)
+		}
+		page.Items = append(page.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return db.Page{}, db.Errorf(t.sdb.errorCode(err, db.ERR_QUERY_FAILED), "%s.Query(%v) failed: %v", t.itemModel.Name(), pageFilter, err)
+	}
+
+	more := int64(len(page.Items)) > options.Limit
+	if more {
+		page.Items = page.Items[:options.Limit]
+	}
+	if dberr := t.loadValues(ctx, page.Items); dberr != nil {
+		return db.Page{}, dberr
+	}
+	if backward {
+		for i, j := 0, len(page.Items)-1; i < j; i, j = i+1, j-1 {
+			page.Items[i], page.Items[j] = page.Items[j], page.Items[i]
+		}
+	}
+	if len(page.Items) > 0 {
+		first := page.Items[0]
+		last := page.Items[len(page.Items)-1]
+		//moving back, there are always items after the page where we came from
+		if more || backward {
+			page.Next = db.EncodeCursor(t.itemModel, order, last, false)
+		}
+		if (backward && more) || (!backward && (options.Cursor != "" || options.Offset > 0)) {
+			page.Prev = db.EncodeCursor(t.itemModel, order, first, true)
+		}
+	}
+	if len(options.Include) > 0 {
+		if dberr := t.IncludeContext(ctx, page.Items, options.Include...); dberr != nil {
+			return db.Page{}, dberr
+		}
+	}
+	return page, nil
+} //sqlTable.Query()
+
+//count items matching the filter (nil for all items)
+func (t sqlTable) count(ctx context.Context, filter db.Filter) (int64, db.IError) {
+	sql := fmt.Sprintf("SELECT COUNT(*) FROM %s", t.table())
+	args := []interface{}{}
+	if filter != nil {
+		where, whereArgs, dberr := t.whereSQL(filter)
+		if dberr != nil {
+			return 0, dberr
+		}
+		sql += " WHERE " + where
+		args = append(args, whereArgs...)
+	}
+	rows, err := t.query(ctx, sql, args...)
+	if err != nil {
+		return 0, db.Errorf(t.sdb.errorCode(err, db.ERR_QUERY_FAILED), "%s.count(%v) failed with SQL: %s: %v", t.itemModel.Name(), filter, sql, err)
+	}
+	defer rows.Close()
+	var n int64
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return 0, db.Errorf(t.sdb.errorCode(err, db.ERR_QUERY_FAILED), "%s.count(%v) failed: %v", t.itemModel.Name(), filter, err)
+		}
+		return 0, db.Errorf(db.ERR_QUERY_FAILED, "%s.count(%v) returned no rows", t.itemModel.Name(), filter)
+	}
+	if err := rows.Scan(&n); err != nil {
+		return 0, db.Errorf(db.ERR_QUERY_ROW_PARSER, "%s.count(%v) failed to parse row: %v", t.itemModel.Name(), filter, err)
+	}
+	return n, nil
+}
+
+//comma separated ORDER BY columns, already validated against the model
+func (t sqlTable) orderSQL(order []db.Order) string {
+	terms := []string{}
+	for _, o := range order {
+		term := t.sdb.quote(o.Field)
+		if o.Desc {
+			term += " DESC"
+		}
+		terms = append(terms, term)
+	}
+	return strings.Join(terms, ",")
+}
+
+//update the item identified by its model.Item.ID
+//fieldNames may be specified to only update those fields, else all fields are updated
+func (t sqlTable) Upd(itemValue interface{}, fieldNames ...string) db.IError {
+	return t.UpdContext(context.Background(), itemValue, fieldNames...)
+}
+
+func (t sqlTable) UpdContext(ctx context.Context, itemValue interface{}, fieldNames ...string) db.IError {
+	if reflect.TypeOf(itemValue) != t.itemModel.StructType() {
+		return db.Errorf(db.ERR_INSERT_WRONG_TYPE, "cannot update item(%s) using %T instead of %v", t.itemModel.Name(), itemValue, t.itemModel.StructType())
+	}
+	fields, relations, dberr := db.UpdFields(t.itemModel, fieldNames)
+	if dberr != nil {
+		return dberr
+	}
+	if dberr := db.ValidateUpd(t.itemModel, itemValue, fields, relations); dberr != nil {
+		return dberr
+	}
+	itemValue = db.SetTimestamps(t.itemModel, itemValue, db.Now(), false)
+	id := t.itemModel.Fields()[0].Value(itemValue).(int64)
+	if len(relations) == 0 {
+		return t.update(ctx, id, itemValue, fields)
+	}
+	return t.inTx(ctx, "Upd", func(txTable sqlTable) db.IError {
+		if dberr := txTable.update(ctx, id, itemValue, fields); dberr != nil {
+			return dberr
+		}
+		return txTable.writeRelations(ctx, id, itemValue, relations, true)
+	})
+}
+
+//update the fields in the item row, and when the item has a version, only when it has
+//the version in itemValue, then also increment the version
+func (t sqlTable) update(ctx context.Context, id int64, itemValue interface{}, fields []model.ItemField) db.IError {
+	idFilter := db.NotDeleted(ctx, t.itemModel, db.Cond{Field: t.itemModel.Name() + "_id", Op: db.OP_EQ, Value: id})
+	version, versioned := db.ItemVersion(t.itemModel, itemValue)
+	if len(fields) == 0 && !versioned {
+		//only relations are updated
+		n, dberr := t.count(ctx, idFilter)
+		if dberr != nil {
+			return dberr
+		}
+		if n == 0 {
+			return db.Errorf(db.ERR_NOT_FOUND, "%s.Upd(%v) not found", t.itemModel.Name(), id)
+		}
+		return nil
+	}
+	set := []string{}
+	args := []interface{}{}
+	for _, f := range fields {
+		set = append(set, t.columns([]string{f.Name})+"=?")
+		v, err := dbValue(f, itemValue)
+		if err != nil {
+			return db.Errorf(db.ERR_INSERT_WRONG_TYPE, "cannot update %s(%v): %v", t.itemModel.Name(), id, err)
+		}
+		args = append(args, v)
+	}
+	versionSQL, versionArgs := t.versionSQL(version, versioned)
+	if versioned {
+		set = append(set, t.incrementVersionSQL())
+	}
+	sql := fmt.Sprintf("UPDATE %s SET %s WHERE %s=?%s%s", t.table(), strings.Join(set, ","), t.idColumn(), t.notDeletedSQL(ctx), versionSQL)
+	args = append(append(args, id), versionArgs...)
+	log.Debugf("Update table(%s) SQL: %s", t.itemModel.Name(), sql)
+
+	result, err := t.exec(ctx, sql, args...)
+	if err != nil {
+		return db.Errorf(t.sdb.errorCode(err, db.ERR_UPDATE_FAILED), "failed to update %s(%v): %v", t.itemModel.Name(), id, err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return t.notChanged(ctx, "Upd", id, idFilter, version, versioned)
+	}
+	return nil
+} //sqlTable.update()
+
+//versionSQL is added to the WHERE clause to only change the item when it has the version
+func (t sqlTable) versionSQL(version int64, versioned bool) (string, []interface{}) {
+	if !versioned {
+		return "", nil
+	}
+	return " AND " + t.sdb.quote(model.FieldVersion) + "=?", []interface{}{version}
+}
+
+//incrementVersionSQL is added to the SET clause of items with a version
+func (t sqlTable) incrementVersionSQL() string {
+	column := t.sdb.quote(model.FieldVersion)
+	return column + "=" + column + "+1"
+}
+
+//notChanged returns the error when no row was changed: ERR_CONFLICT when the version was checked
+//and an item matches the filter without the version, else ERR_NOT_FOUND
+func (t sqlTable) notChanged(ctx context.Context, what string, id int64, filter db.Filter, version int64, versioned bool) db.IError {
+	if versioned {
+		n, dberr := t.count(ctx, filter)
+		if dberr != nil {
+			return dberr
+		}
+		if n > 0 {
+			return db.ConflictError(t.itemModel, what, id, version)
+		}
+	}
+	return db.Errorf(db.ERR_NOT_FOUND, "%s.%s(%v) not found", t.itemModel.Name(), what, id)
+}
+
+func (t sqlTable) DelById(id int64) db.IError {
+	return t.DelByIdContext(context.Background(), id)
+}
+
+//DelByIdContext only sets deleted_at when the item has soft delete
+func (t sqlTable) DelByIdContext(ctx context.Context, id int64) db.IError {
+	if _, ok := model.AutoField(t.itemModel, model.FieldDeletedAt); ok {
+		return t.setDeleted(ctx, "DelById", id, db.Now())
+	}
+	return t.delete(ctx, "DelById", id)
+}
+
+func (t sqlTable) Restore(id int64) db.IError {
+	return t.RestoreContext(context.Background(), id)
+}
+
+func (t sqlTable) RestoreContext(ctx context.Context, id int64) db.IError {
+	if _, dberr := db.SoftDeleteField(t.itemModel); dberr != nil {
+		return dberr
+	}
+	return t.setDeleted(ctx, "Restore", id, nil)
+}
+
+//setDeleted sets deleted_at of an item that is not deleted, or clears it (deletedAt=nil) of a deleted item
+//and increments the version of an item with a version
+func (t sqlTable) setDeleted(ctx context.Context, what string, id int64, deletedAt interface{}) db.IError {
+	column := t.sdb.quote(model.FieldDeletedAt)
+	condition := column + " IS NULL"
+	filter := db.And{db.Cond{Field: t.itemModel.Name() + "_id", Op: db.OP_EQ, Value: id}, db.IsNull(model.FieldDeletedAt)}
+	if deletedAt == nil {
+		condition = column + " IS NOT NULL"
+		filter[1] = db.NotNull(model.FieldDeletedAt)
+	}
+	set := column + "=?"
+	if _, versioned := model.AutoField(t.itemModel, model.FieldVersion); versioned {
+		set += "," + t.incrementVersionSQL()
+	}
+	version, checkVersion := db.ExpectedVersion(ctx, t.itemModel)
+	versionSQL, versionArgs := t.versionSQL(version, checkVersion)
+	sql := fmt.Sprintf("UPDATE %s SET %s WHERE %s=? AND %s%s", t.table(), set, t.idColumn(), condition, versionSQL)
+	result, err := t.exec(ctx, sql, append([]interface{}{deletedAt, id}, versionArgs...)...)
+	if err != nil {
+		return db.Errorf(t.sdb.errorCode(err, db.ERR_UPDATE_FAILED), "failed to %s %s(%v): %v", what, t.itemModel.Name(), id, err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return t.notChanged(ctx, what, id, filter, version, checkVersion)
+	}
+	return nil
+}
+
+func (t sqlTable) Purge(id int64) db.IError {
+	return t.PurgeContext(context.Background(), id)
+}
+
+func (t sqlTable) PurgeContext(ctx context.Context, id int64) db.IError {
+	return t.delete(ctx, "Purge", id)
+}
+
+//delete the row, and the db deletes its rows in join and child tables
+func (t sqlTable) delete(ctx context.Context, what string, id int64) db.IError {
+	version, checkVersion := db.ExpectedVersion(ctx, t.itemModel)
+	versionSQL, versionArgs := t.versionSQL(version, checkVersion)
+	sql := fmt.Sprintf("DELETE FROM %s WHERE %s=?%s", t.table(), t.idColumn(), versionSQL)
+	result, err := t.exec(ctx, sql, append([]interface{}{id}, versionArgs...)...)
+	if err != nil {
+		return db.Errorf(t.sdb.errorCode(err, db.ERR_DELETE_FAILED), "failed to delete %s(%v): %v", t.itemModel.Name(), id, err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return t.notChanged(ctx, what, id, db.Cond{Field: t.itemModel.Name() + "_id", Op: db.OP_EQ, Value: id}, version, checkVersion)
+	}
+	return nil
+}
+
+//createTableSQL returns the CREATE TABLE statement followed by CREATE INDEX statements
+func (t sqlTable) createTableSQL() ([]string, error) {
+	//own ID is always first and used as primary key
+	definitions := []string{t.sdb.dialect.IdColumn(t.itemModel.Name())}
+	foreignKeyDefinitions := []string{}
+	indexStatements := []string{}
+	for i, f := range t.itemModel.Fields() {
+		if i == 0 {
+			continue //skip own id
+		}
+		//store value or reference: e.g. `merchant_reference` VARCHAR(255) NOT NULL
+		columnDefinition, err := t.sdb.columnDefinition(f)
+		if err != nil {
+			return nil, err
+		}
+		definitions = append(definitions, t.sdb.quote(f.Name)+" "+columnDefinition)
+		if f.RefItem != nil {
+			//refer to item in other table:
+			foreignKeyDefinitions = append(foreignKeyDefinitions, fmt.Sprintf("FOREIGN KEY(%s) REFERENCES %s(%s)",
+				t.sdb.quote(f.Name),
+				t.sdb.quote(f.RefItem.Name()),
+				t.sdb.quote(f.RefItem.Name()+"_id")))
+		}
+		if f.Index {
+			indexStatements = append(indexStatements, fmt.Sprintf("CREATE INDEX %s ON %s (%s)",
+				t.sdb.quote(t.itemModel.Name()+"_"+f.Name), t.table(), t.sdb.quote(f.Name)))
+		}
+	}
+	definitions = append(definitions, foreignKeyDefinitions...)
+
+	//create sets of uniq fields, named with the table as some dbs require uniq constraint names in the schema
+	uniqSetNames, uniqSets := t.uniqSets()
+	for _, uniqSetName := range uniqSetNames {
+		definitions = append(definitions, fmt.Sprintf("CONSTRAINT %s UNIQUE (%s)",
+			t.sdb.quote(t.itemModel.Name()+"_"+uniqSetName),
+			t.columns(uniqSets[uniqSetName])))
+	}
+
+	sql := "CREATE TABLE IF NOT EXISTS " + t.table() + " (" +
+		strings.Join(definitions, ",") +
+		")" + t.sdb.dialect.CreateTableOptions()
+	log.Debugf("Create table(%s) SQL: %s", t.itemModel.Name(), sql)
+	return append([]string{sql}, indexStatements...), nil
+} //sqlTable.createTableSQL()
+
+//sorted names of uniq sets and the field names in each set
+func (t sqlTable) uniqSets() ([]string, map[string][]string) {
+	uniqSets := map[string][]string{} //key is uniq set name configured in a field, value if field names
+	for _, f := range t.itemModel.Fields() {
+		for _, uniqSetName := range f.UniqSets {
+			uniqSets[uniqSetName] = append(uniqSets[uniqSetName], f.Name)
+		}
+	}
+	names := []string{}
+	for name := range uniqSets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, uniqSets
+}
+
+//return SQL with placeholders and the values for them
+func (t sqlTable) insertSQL(itemValue interface{}) (string, []interface{}, error) {
+	fieldNames, args, err := t.insertColumns(itemValue)
+	if err != nil {
+		return "", nil, err
+	}
+	sql := t.insertRowsSQL(fieldNames, 1)
+	log.Debugf("Insert into table(%s) SQL: %s", t.itemModel.Name(), sql)
+	return sql, args, nil
+}
+
+//names and values of the fields to insert
+//NULL values are not inserted when the field has a default, so the db default is used
+func (t sqlTable) insertColumns(itemValue interface{}) ([]string, []interface{}, error) {
+	fieldNames := []string{}
+	args := []interface{}{}
+	for i, f := range t.itemModel.Fields() {
+		if i == 0 {
+			continue //skip own id with insert to get auto increment value
+		}
+		v, err := dbValue(f, itemValue)
+		if err != nil {
+			return nil, nil, err
+		}
+		if f.Default != nil && isNull(v) {
+			continue
+		}
+		fieldNames = append(fieldNames, f.Name)
+		args = append(args, v)
+	}
+	return fieldNames, args, nil
+}
+
+//INSERT statement with placeholders for n rows of the fields
+func (t sqlTable) insertRowsSQL(fieldNames []string, n int) string {
+	row := "(" + strings.TrimSuffix(strings.Repeat("?,", len(fieldNames)), ",") + ")"
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES %s",
+		t.table(),
+		t.columns(fieldNames),
+		strings.TrimSuffix(strings.Repeat(row+",", n), ","))
+}
+
+// func (sdb sqlDb) Get(ctx service.IContext, key map[string]interface{}) (items []interface{}, err error) {
+// 	return nil, fmt.Errorf("NYI")
+// }
+
+// func (sdb sqlDb) GetOne(ctx service.IContext, key map[string]interface{}) (item interface{}, err error) {
+// 	return nil, fmt.Errorf("NYI")
+// }
+
+// //GetSructByID returns (&struct,nil) on success, else (nil,error)
+// func (sdb sqlDb) GetStructByID(name string, tmpl interface{}, id int) (interface{}, error) {
+// 	structType := reflect.TypeOf(tmpl)
+// 	if structType.Kind() != reflect.Struct {
+// 		return nil, fmt.Errorf("%s type %T is not a struct", name, tmpl)
+// 	}
+
+// 	fields := structTypeFields(structType)
+// 	fieldNamesCsv := ""
+// 	for _, f := range fields {
+// 		fn := db.StructFieldDbColumnName(f)
+// 		fieldNamesCsv += "," + fn
+// 	}
+// 	log.Debugf("field names CSV = \"%s\"\n", fieldNamesCsv)
+// 	sql := "SELECT " + fieldNamesCsv[1:] + " FROM " + name + " WHERE " + name + "_id=" + fmt.Sprintf("%d", id)
+
+// 	log.Debugf("sql: %s", sql)
+// 	rows, err := sdb.conn.Query(sql)
+// 	if err != nil {
+// 		return nil, fmt.Errorf("failed to query(%s): %v", sql, err)
+// 	}
+// 	defer rows.Close()
+// 	if !rows.Next() {
+// 		return nil, fmt.Errorf("not found")
+// 	}
+
+// 	newStructPtrValue := reflect.New(structType)
+// 	fieldValuePtrs := fieldValuePtrs(structType, newStructPtrValue)
+// 	err = rows.Scan(fieldValuePtrs...)
+// 	if err != nil {
+// 		return nil, fmt.Errorf("failed to parse db row: %v", err)
+// 	}
+// 	return newStructPtrValue.Interface(), nil
+// }
+
+// func (sdb sqlDb) GetStructsByKey(name string, tmpl interface{}, key map[string]interface{}, limit int) ([]interface{}, error) {
+// 	structType := reflect.TypeOf(tmpl)
+// 	if structType.Kind() != reflect.Struct {
+// 		return nil, fmt.Errorf("%s type %T is not a struct", name, tmpl)
+// 	}
+
+// 	fields := structTypeFields(structType)
+// 	fieldNamesCsv := ""
+// 	for _, f := range fields {
+// 		fn := db.StructFieldDbColumnName(f)
+// 		fieldNamesCsv += "," + fn
+// 	}
+// 	log.Debugf("field names CSV = \"%s\"\n", fieldNamesCsv)
+// 	sql := "SELECT " + fieldNamesCsv[1:] + " FROM " + name
+
+// 	if len(key) > 0 {
+// 		sql += " WHERE "
+// 		count := 0
+// 		for n, v := range key {
+// 			if count > 0 {
+// 				sql += " AND "
+// 			}
+// 			count++
+// 			sql += name + "="
+
+// 			switch v.(type) {
+// 			case string:
+// 				sql += fmt.Sprintf("\"%v\"", v)
+// 			case int, int8, uint8, int16, uint16, int32, uint32, int64, uint64:
+// 				sql += fmt.Sprintf("%v", v)
+// 			default:
+// 				return nil, fmt.Errorf("key.%s=(%T)%v should have string or integer value only", n, v, v)
+// 			}
+// 		}
+// 	} //if has key
+
+// 	//limit results
+// 	sql += fmt.Sprintf(" LIMIT %d", limit)
+
+// 	//run the query
+// 	log.Debugf("sql: %s", sql)
+// 	rows, err := sdb.conn.Query(sql)
+// 	if err != nil {
+// 		return nil, fmt.Errorf("failed to query(%s): %v", sql, err)
+// 	}
+// 	defer rows.Close()
+
+// 	//parse the result rows
+// 	itemList := []interface{}{}
+// 	for rows.Next() {
+// 		newStructPtrValue := reflect.New(structType)
+// 		fieldValuePtrs := fieldValuePtrs(structType, newStructPtrValue)
+
+// 		err = rows.Scan(fieldValuePtrs...)
+// 		if err != nil {
+// 			return nil, fmt.Errorf("failed to parse db row: %v", err)
+// 		}
+// 		itemList = append(itemList, newStructPtrValue.Elem().Interface())
+// 	}
+// 	return itemList, nil
+// }
+
+// func structTypeFields(structType reflect.Type) []reflect.StructField {
+// 	fields := []reflect.StructField{}
+// 	for i := 0; i < structType.NumField(); i++ {
+// 		f := structType.Field(i)
+// 		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+// 			//anonymous struct fields are added to the list, using the "<struct name>_" as prefix
+// 			//e.g. Item which is included in each model then becomes <struct_name>_id, e.g. "location_id"
+// 			subFields := append(fields, structTypeFields(f.Type)...)
+
+// 			//for now only support one field in embedded - because not calculating
+// 			//ptrs for other fields... can remove this later
+// 			if len(subFields) != 1 {
+// 				panic(fmt.Errorf("%v embed %v with %d != 1 fields", structType.Name, f.Type.Name, len(subFields)))
+// 			}
+
+// 			for _, f := range subFields {
+// 				f.Name = strings.ToLower(structType.Name()) + "_" + f.Name
+// 				fields = append(fields, f)
+// 			}
+// 			continue
+// 		}
+// 		fields = append(fields, f)
+// 	}
+// 	return fields
+// }
@@ -0,0 +1,171 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/go-msvc/msf/db"
+	"github.com/go-msvc/msf/model"
+)
+
+//countingDriver counts the open prepared statements
+type countingDriver struct {
+	sync.Mutex
+	open    map[string]int
+	rowsErr error //returned while reading the rows of a query, when set
+}
+
+type countingConn struct{ d *countingDriver }
+
+type countingStmt struct {
+	d     *countingDriver
+	query string
+}
+
+type emptyRows struct{}
+
+type failingRows struct{ err error }
+
+func (d *countingDriver) Open(name string) (driver.Conn, error) { return countingConn{d}, nil }
+
+func (c countingConn) Prepare(query string) (driver.Stmt, error) {
+	c.d.Lock()
+	defer c.d.Unlock()
+	c.d.open[query]++
+	return countingStmt{c.d, query}, nil
+}
+func (c countingConn) Close() error              { return nil }
+func (c countingConn) Begin() (driver.Tx, error) { return nil, fmt.Errorf("no transactions") }
+
+func (s countingStmt) Close() error {
+	s.d.Lock()
+	defer s.d.Unlock()
+	if s.d.open[s.query]--; s.d.open[s.query] == 0 {
+		delete(s.d.open, s.query)
+	}
+	return nil
+}
+func (s countingStmt) NumInput() int { return -1 }
+func (s countingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(0), nil
+}
+func (s countingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if s.d.rowsErr != nil {
+		return failingRows{s.d.rowsErr}, nil
+	}
+	return emptyRows{}, nil
+}
+
+func (emptyRows) Columns() []string              { return nil }
+func (emptyRows) Close() error                   { return nil }
+func (emptyRows) Next(dest []driver.Value) error { return io.EOF }
+
+func (failingRows) Columns() []string                { return nil }
+func (failingRows) Close() error                     { return nil }
+func (r failingRows) Next(dest []driver.Value) error { return r.err }
+
+type questionMarks struct{ Dialect }
+
+func (questionMarks) Placeholder(n int) string                 { return "?" }
+func (questionMarks) Quote(name string) string                 { return name }
+func (questionMarks) ErrorCode(err error) (db.ErrorCode, bool) { return 0, false }
+
+func (d *countingDriver) nrOpen(query string) int {
+	d.Lock()
+	defer d.Unlock()
+	if query == "" {
+		return len(d.open)
+	}
+	return d.open[query]
+}
+
+func TestStmtCache(t *testing.T) {
+	d := &countingDriver{open: map[string]int{}}
+	sql.Register("counting", d)
+	conn, err := sql.Open("counting", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetMaxOpenConns(1)
+	table := sqlTable{sdb: &sqlDb{conn: conn, dialect: questionMarks{}}, stmts: newStmtCache(4)}
+	ctx := context.Background()
+
+	//statements are reused, and the least recently used are closed
+	for i := 0; i < 10; i++ {
+		if _, err := table.exec(ctx, fmt.Sprintf("DELETE FROM x WHERE id IN (%d)", i%6)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := d.nrOpen(""); n != 4 || table.stmts.lru.Len() != 4 {
+		t.Fatalf("%d statements open, %d cached instead of 4", n, table.stmts.lru.Len())
+	}
+
+	//a statement in use is only closed when released
+	cs, err := table.prepare(ctx, "SELECT 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		rows, err := table.query(ctx, fmt.Sprintf("SELECT %d", i+2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows.Close()
+	}
+	if !cs.evicted || d.nrOpen("SELECT 1") != 1 {
+		t.Fatalf("statement in use: evicted=%v open=%d", cs.evicted, d.nrOpen("SELECT 1"))
+	}
+	table.release(cs)
+	if d.nrOpen("SELECT 1") != 0 {
+		t.Fatalf("evicted statement not closed when released")
+	}
+
+	table.close()
+	if n := d.nrOpen(""); n != 0 {
+		t.Fatalf("%d statements open after close", n)
+	}
+}
+
+type item struct {
+	model.Item
+	Name string
+}
+
+//an error while reading the rows is returned rather than not found or fewer items
+func TestRowsErr(t *testing.T) {
+	d := &countingDriver{open: map[string]int{}, rowsErr: context.Canceled}
+	sql.Register("failing-rows", d)
+	conn, err := sql.Open("failing-rows", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	table := sqlTable{sdb: &sqlDb{conn: conn, dialect: questionMarks{}}, itemModel: model.New().MustAdd(item{}), stmts: newStmtCache(4)}
+	ctx := context.Background()
+
+	_, dberr := table.GetByIdContext(ctx, 1)
+	expectCode(t, "GetById", dberr, db.ERR_CANCELED)
+	_, dberr = table.GetOneByFilterContext(ctx, nil)
+	expectCode(t, "GetOneByFilter", dberr, db.ERR_CANCELED)
+	_, dberr = table.GetByFilterContext(ctx, nil, 10)
+	expectCode(t, "GetByFilter", dberr, db.ERR_CANCELED)
+	_, dberr = table.count(ctx, nil)
+	expectCode(t, "count", dberr, db.ERR_CANCELED)
+
+	d.rowsErr = fmt.Errorf("connection lost")
+	_, dberr = table.GetByFilterContext(ctx, nil, 10)
+	expectCode(t, "GetByFilter", dberr, db.ERR_QUERY_FAILED)
+}
+
+func expectCode(t *testing.T, what string, dberr db.IError, code db.ErrorCode) {
+	t.Helper()
+	if dberr == nil || dberr.Code() != code {
+		t.Fatalf("%s failed with %v instead of %s", what, dberr, db.ErrorName[code])
+	}
+}
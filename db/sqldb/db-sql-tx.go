@@ -0,0 +1,79 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/go-msvc/msf/db"
+)
+
+//implements db.ITx
+type sqlTx struct {
+	sdb *sqlDb
+	tx  *sql.Tx
+}
+
+func (sdb *sqlDb) Begin(ctx context.Context) (db.ITx, db.IError) {
+	tx, err := sdb.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, db.Errorf(sdb.errorCode(err, db.ERR_TX_FAILED), "failed to begin transaction: %v", err)
+	}
+	return sqlTx{sdb: sdb, tx: tx}, nil
+}
+
+func (stx sqlTx) Table(name string) (db.ITable, error) {
+	stx.sdb.Lock()
+	defer stx.sdb.Unlock()
+	t, ok := stx.sdb.table[name]
+	if !ok {
+		return nil, fmt.Errorf("table(%s) was not added to the db", name)
+	}
+	txTable := *(t.(*sqlTable)) //copy shares the statement cache
+	txTable.tx = stx.tx
+	return txTable, nil
+}
+
+func (stx sqlTx) MustTable(name string) db.ITable {
+	t, err := stx.Table(name)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func (stx sqlTx) Commit() db.IError {
+	if err := stx.tx.Commit(); err != nil {
+		return db.Errorf(stx.sdb.errorCode(err, db.ERR_TX_FAILED), "failed to commit: %v", err)
+	}
+	return nil
+}
+
+func (stx sqlTx) Rollback() db.IError {
+	if err := stx.tx.Rollback(); err != nil && err != sql.ErrTxDone {
+		return db.Errorf(db.ERR_TX_FAILED, "failed to rollback: %v", err)
+	}
+	return nil
+}
+
+//inTx calls fnc with the table in a new transaction, which is committed when fnc succeeds,
+//or with this table when it already is in a transaction
+func (t sqlTable) inTx(ctx context.Context, what string, fnc func(txTable sqlTable) db.IError) db.IError {
+	if t.tx != nil {
+		return fnc(t)
+	}
+	tx, err := t.sdb.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return db.Errorf(t.sdb.errorCode(err, db.ERR_TX_FAILED), "%s.%s() failed to begin transaction: %v", t.itemModel.Name(), what, err)
+	}
+	txTable := t
+	txTable.tx = tx
+	if dberr := fnc(txTable); dberr != nil {
+		tx.Rollback()
+		return dberr
+	}
+	if err := tx.Commit(); err != nil {
+		return db.Errorf(t.sdb.errorCode(err, db.ERR_TX_FAILED), "%s.%s() failed to commit: %v", t.itemModel.Name(), what, err)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package sqldb
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/go-msvc/msf/model"
+)
+
+//column definition for a value or reference field, e.g. "VARCHAR(255) NOT NULL DEFAULT 'x'"
+func (sdb *sqlDb) columnDefinition(f model.ItemField) (string, error) {
+	def, err := sdb.dialect.ColumnType(f)
+	if err != nil {
+		return "", err
+	}
+	if f.Nullable {
+		def += " NULL"
+	} else {
+		def += " NOT NULL"
+	}
+	if f.Default != nil {
+		literal, err := sdb.defaultLiteral(f)
+		if err != nil {
+			return "", err
+		}
+		def += " DEFAULT " + literal
+	}
+	return def, nil
+} //sqlDb.columnDefinition()
+
+//SQL literal for the field default, checked against the kind as it cannot be a placeholder in DDL
+func (sdb *sqlDb) defaultLiteral(f model.ItemField) (string, error) {
+	value := *f.Default
+	var err error
+	switch f.Kind {
+	case model.KindInt:
+		_, err = strconv.ParseInt(value, 10, 64)
+	case model.KindUint:
+		_, err = strconv.ParseUint(value, 10, 64)
+	case model.KindFloat, model.KindDecimal:
+		_, err = strconv.ParseFloat(value, 64)
+	case model.KindBool:
+		var b bool
+		if b, err = strconv.ParseBool(value); err == nil {
+			value = "FALSE"
+			if b {
+				value = "TRUE"
+			}
+		}
+	case model.KindTime:
+		if strings.ToUpper(value) == "CURRENT_TIMESTAMP" {
+			return sdb.dialect.CurrentTimestamp(), nil
+		}
+		return sdb.dialect.StringLiteral(value), nil
+	case model.KindString, model.KindJSON:
+		return sdb.dialect.StringLiteral(value), nil
+	default:
+		err = fmt.Errorf("not supported for %v", f.Kind)
+	}
+	if err != nil {
+		return "", fmt.Errorf("field(%s) invalid default \"%s\": %v", f.Name, *f.Default, err)
+	}
+	return value, nil
+}
+
+//value of the item field to write to the db
+func dbValue(f model.ItemField, itemValue interface{}) (interface{}, error) {
+	return toDbValue(f, f.Value(itemValue))
+}
+
+//value to write to the db for a field or slice element value v
+func toDbValue(f model.ItemField, v interface{}) (interface{}, error) {
+	if b, ok := v.([]byte); ok && b == nil && !f.Nullable {
+		return []byte{}, nil //drivers write nil []byte as NULL
+	}
+	if f.Kind != model.KindJSON {
+		return v, nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		if rv.IsNil() && f.Nullable {
+			return nil, nil
+		}
+	}
+	jsonValue, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode %s as JSON: %v", f.Name, err)
+	}
+	return string(jsonValue), nil
+}
+
+//row scans one result row into a new item struct
+//some fields are scanned into temporary values and decoded after the scan
+type row struct {
+	item    reflect.Value  //new item struct
+	targets []interface{}  //passed to rows.Scan()
+	decode  []func() error //called after rows.Scan()
+}
+
+func newRow(itemModel model.IItem) *row {
+	r := &row{
+		item:    reflect.New(itemModel.StructType()).Elem(),
+		targets: []interface{}{},
+		decode:  []func() error{},
+	}
+	for _, f := range itemModel.Fields() {
+		target, decode := scanTarget(f, r.item.FieldByIndex(f.StructField.Index))
+		r.targets = append(r.targets, target)
+		if decode != nil {
+			r.decode = append(r.decode, decode)
+		}
+	}
+	return r
+}
+
+//scanTarget returns what to pass to rows.Scan() for a field or slice element value,
+//and a func to call after the scan to decode it into the value, or nil
+func scanTarget(f model.ItemField, fieldValue reflect.Value) (interface{}, func() error) {
+	switch {
+	case f.Kind == model.KindJSON:
+		jsonValue := []byte(nil)
+		return &jsonValue, func() error {
+			if jsonValue == nil {
+				return nil //NULL
+			}
+			if err := json.Unmarshal(jsonValue, fieldValue.Addr().Interface()); err != nil {
+				return fmt.Errorf("cannot decode %s JSON: %v", f.Name, err)
+			}
+			return nil
+		}
+	case f.Nullable && fieldValue.Kind() != reflect.Ptr && !isScanner(fieldValue):
+		//NULL cannot be scanned into a plain value, so scan into a pointer and keep zero value for NULL
+		ptrValue := reflect.New(reflect.PtrTo(fieldValue.Type()))
+		return ptrValue.Interface(), func() error {
+			if !ptrValue.Elem().IsNil() {
+				fieldValue.Set(ptrValue.Elem().Elem())
+			}
+			return nil
+		}
+	}
+	return fieldValue.Addr().Interface(), nil
+}
+
+//scan the current row and return the item struct
+func (r *row) scan(rows *sql.Rows) (interface{}, error) {
+	if err := rows.Scan(r.targets...); err != nil {
+		return nil, err
+	}
+	for _, decode := range r.decode {
+		if err := decode(); err != nil {
+			return nil, err
+		}
+	}
+	return r.item.Interface(), nil
+}
+
+//check if field is a scanner, like sql.NullString
+func isScanner(fieldValue reflect.Value) bool {
+	_, ok := fieldValue.Addr().Interface().(sql.Scanner)
+	return ok
+}
+
+//check if value will be written as NULL
+func isNull(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	if valuer, ok := v.(driver.Valuer); ok {
+		dv, err := valuer.Value()
+		return err == nil && dv == nil
+	}
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Ptr && rv.IsNil()
+}
@@ -0,0 +1,69 @@
+package sqlite
+
+import (
+	"fmt"
+
+	"github.com/go-msvc/msf/db"
+	"github.com/go-msvc/msf/db/sqldb"
+	"github.com/go-msvc/msf/logger"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var log = logger.New("msf").New("db-sqlite")
+
+func init() {
+	db.Register("sqlite", Config{})
+}
+
+//in-memory db filename
+const Memory = ":memory:"
+
+type Config struct {
+	Filename  string `json:"filename"`   //file is created if it does not exist, or ":memory:" for a db that is lost on close
+	Migrate   string `json:"migrate"`    //policy when existing tables differ from the model: "apply" (default), "refuse" or "log"
+	BatchSize int    `json:"batch_size"` //max nr of rows inserted in one statement by AddMany() (default 100)
+	sqldb.PoolConfig
+}
+
+func (c *Config) Validate() error {
+	if c.Filename == "" {
+		return fmt.Errorf("missing filename")
+	}
+	if err := sqldb.ValidateMigrate(&c.Migrate); err != nil {
+		return err
+	}
+	if err := sqldb.ValidateBatchSize(&c.BatchSize); err != nil {
+		return err
+	}
+	if c.Filename == Memory && c.MaxOpenConns > 1 {
+		return fmt.Errorf("max_open_conns=%d not supported with filename=\"%s\"", c.MaxOpenConns, Memory)
+	}
+	if err := c.PoolConfig.Validate(); err != nil {
+		return err
+	}
+	return nil
+} //Config.Validate()
+
+func (c Config) MustCreate() db.IDatabase {
+	s, err := c.Create()
+	if err != nil {
+		panic(err)
+	}
+	return s
+} //Config.MustCreate()
+
+func (c Config) Create() (db.IDatabase, error) {
+	//foreign keys are only enforced in sqlite when enabled on the connection
+	//busy timeout makes writers wait for a lock rather than fail immediately
+	pool := c.PoolConfig
+	if c.Filename == Memory {
+		//each connection has its own in-memory db
+		pool.MaxOpenConns = 1
+	}
+	conn, err := pool.Open("sqlite3", c.Filename+"?_foreign_keys=1&_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite file(%v): %v", c.Filename, err)
+	}
+	log.Debugf("opened sqlite file \"%s\"", c.Filename)
+	return sqldb.New(conn, dialect{}, c.Migrate, c.BatchSize), nil
+}
@@ -0,0 +1,153 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/go-msvc/msf/db"
+	"github.com/go-msvc/msf/db/sqldb"
+	"github.com/go-msvc/msf/model"
+	"github.com/mattn/go-sqlite3"
+)
+
+//implements sqldb.Dialect
+//types are declared so that the driver scans them into the Go types of the model, e.g. DATETIME into time.Time
+type dialect struct{}
+
+func (dialect) Quote(identifier string) string {
+	return "\"" + strings.ReplaceAll(identifier, "\"", "\"\"") + "\""
+}
+
+func (dialect) Placeholder(n int) string { return "?" }
+
+func (dialect) StringLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func (dialect) CurrentTimestamp() string { return "CURRENT_TIMESTAMP" }
+
+//new id is read with LastInsertId()
+func (dialect) Returning(idColumn string) string { return "" }
+
+//LastInsertId() of a multi-row INSERT is the rowid of the last row
+func (dialect) FirstInsertId() bool { return false }
+
+func (dialect) UpsertOnConflictColumns() bool { return true }
+
+//upsert clause requires sqlite 3.24 or later
+func (d dialect) Upsert(conflictColumns, updateColumns []string) string {
+	conflict := []string{}
+	for _, column := range conflictColumns {
+		conflict = append(conflict, d.Quote(column))
+	}
+	set := []string{}
+	for _, column := range updateColumns {
+		set = append(set, d.Quote(column)+"=excluded."+d.Quote(column))
+	}
+	return " ON CONFLICT (" + strings.Join(conflict, ",") + ") DO UPDATE SET " + strings.Join(set, ",")
+}
+
+func (d dialect) IdColumn(tableName string) string {
+	return d.Quote(tableName+"_id") + " INTEGER PRIMARY KEY AUTOINCREMENT"
+}
+
+func (dialect) ColumnType(f model.ItemField) (string, error) {
+	switch f.Kind {
+	case model.KindRef, model.KindInt, model.KindUint:
+		return "INTEGER", nil
+	case model.KindString:
+		if f.Size == 0 {
+			return "TEXT", nil
+		}
+		return fmt.Sprintf("VARCHAR(%d)", f.Size), nil
+	case model.KindFloat:
+		return "REAL", nil
+	case model.KindDecimal:
+		return fmt.Sprintf("DECIMAL(%d,%d)", f.Size, f.Scale), nil
+	case model.KindBool:
+		return "BOOLEAN", nil
+	case model.KindTime:
+		return "DATETIME", nil
+	case model.KindBytes:
+		return "BLOB", nil
+	case model.KindJSON:
+		return "TEXT", nil
+	}
+	return "", fmt.Errorf("field(%s) has unknown kind %v", f.Name, f.Kind)
+} //dialect.ColumnType()
+
+func (dialect) CreateTableOptions() string { return "" }
+
+//sqlite cannot add a NOT NULL column without a default
+func (dialect) AddColumnNeedsDefault() bool { return true }
+
+//sqlite cannot add a foreign key to an existing table
+func (dialect) AddForeignKey(table, column, refTable, refColumn string) string { return "" }
+
+func (dialect) Describe(conn *sql.DB, tableName string) (*sqldb.TableSchema, error) {
+	schema := &sqldb.TableSchema{Columns: map[string]sqldb.ColumnSchema{}}
+	rows, err := conn.Query("SELECT \"name\",\"type\",\"notnull\",\"pk\" FROM pragma_table_info(?)", tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, typ string
+		var notNull, pk int
+		if err := rows.Scan(&name, &typ, &notNull, &pk); err != nil {
+			return nil, fmt.Errorf("failed to parse column: %v", err)
+		}
+		schema.Columns[name] = sqldb.ColumnSchema{Type: sqldb.NormalizeType(typ), Nullable: notNull == 0 && pk == 0}
+	}
+	if len(schema.Columns) == 0 {
+		return nil, nil //table does not exist
+	}
+
+	indexRows, err := conn.Query("SELECT \"name\",\"unique\" FROM pragma_index_list(?) WHERE \"origin\"<>'pk' ORDER BY \"name\"", tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read indexes: %v", err)
+	}
+	defer indexRows.Close()
+	for indexRows.Next() {
+		index := sqldb.IndexSchema{Columns: []string{}}
+		if err := indexRows.Scan(&index.Name, &index.Unique); err != nil {
+			return nil, fmt.Errorf("failed to parse index: %v", err)
+		}
+		schema.Indexes = append(schema.Indexes, index)
+	}
+	for i, index := range schema.Indexes {
+		columnRows, err := conn.Query("SELECT \"name\" FROM pragma_index_info(?) ORDER BY \"seqno\"", index.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read index(%s) columns: %v", index.Name, err)
+		}
+		for columnRows.Next() {
+			var column string
+			if err := columnRows.Scan(&column); err != nil {
+				columnRows.Close()
+				return nil, fmt.Errorf("failed to parse index(%s) column: %v", index.Name, err)
+			}
+			schema.Indexes[i].Columns = append(schema.Indexes[i].Columns, column)
+		}
+		columnRows.Close()
+	}
+	return schema, nil
+} //dialect.Describe()
+
+func (dialect) ErrorCode(err error) (db.ErrorCode, bool) {
+	e, ok := err.(sqlite3.Error)
+	if !ok {
+		return 0, false
+	}
+	switch e.ExtendedCode {
+	case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+		return db.ERR_DUPLICATE_KEY, true
+	case sqlite3.ErrConstraintForeignKey:
+		return db.ERR_FOREIGN_KEY, true
+	}
+	switch e.Code {
+	case sqlite3.ErrBusy, sqlite3.ErrLocked:
+		return db.ERR_DEADLOCK, true
+	}
+	return 0, false
+}
@@ -0,0 +1,333 @@
+package sqlite_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-msvc/msf/config"
+	"github.com/go-msvc/msf/db"
+	"github.com/go-msvc/msf/db/dbtest"
+	"github.com/go-msvc/msf/db/sqldb"
+	"github.com/go-msvc/msf/db/sqlite"
+	"github.com/go-msvc/msf/model"
+)
+
+type Location struct {
+	model.Item
+	Name string `uniq:"locationName"`
+	Code string `db:"size=8,index"`
+}
+
+type Stock struct {
+	model.Item
+	Name string
+	Location
+	Qty int
+}
+
+func TestSqlite(t *testing.T) {
+	dbFilename := "./test-sqlite.db"
+	os.Remove(dbFilename)
+	defer os.Remove(dbFilename)
+
+	config.Set("db", map[string]interface{}{
+		"test": map[string]interface{}{
+			"sqlite": map[string]interface{}{
+				"filename": dbFilename,
+				"migrate":  "refuse",
+			},
+		},
+	})
+
+	dbModel := model.New()
+	locationModel := dbModel.MustAdd(Location{})
+	stockModel := dbModel.MustAdd(Stock{})
+
+	testDb := db.MustOpen("test")
+	dbLocation, err := testDb.AddTable(locationModel)
+	if err != nil {
+		t.Fatalf("failed to add location table: %v", err)
+	}
+	dbStock, err := testDb.AddTable(stockModel)
+	if err != nil {
+		t.Fatalf("failed to add stock table: %v", err)
+	}
+
+	locationId, dberr := dbLocation.Add(Location{Name: "one", Code: "1"})
+	if dberr != nil {
+		t.Fatalf("failed to add location: %v", dberr)
+	}
+	if _, dberr := dbLocation.Add(Location{Name: "one", Code: "2"}); dberr == nil || dberr.Code() != db.ERR_DUPLICATE_KEY {
+		t.Fatalf("duplicate location not refused as duplicate: %v", dberr)
+	}
+	if _, dberr := dbStock.Add(Stock{Name: "nowhere", Location: Location{Item: model.Item{ID: locationId + 1}}}); dberr == nil || dberr.Code() != db.ERR_FOREIGN_KEY {
+		t.Fatalf("stock in unknown location not refused on foreign key: %v", dberr)
+	}
+	stockId, dberr := dbStock.Add(Stock{Name: "box", Location: Location{Item: model.Item{ID: locationId}}, Qty: 3})
+	if dberr != nil {
+		t.Fatalf("failed to add stock: %v", dberr)
+	}
+	if dberr := dbLocation.DelById(locationId); dberr == nil || dberr.Code() != db.ERR_FOREIGN_KEY {
+		t.Fatalf("delete referenced location not refused on foreign key: %v", dberr)
+	}
+	stock, dberr := dbStock.GetById(stockId)
+	if dberr != nil || stock.(Stock).Qty != 3 || stock.(Stock).Location.ID != locationId {
+		t.Fatalf("get stock: %+v, %v", stock, dberr)
+	}
+	testDb.Close()
+
+	//tables created by this dialect match the model
+	testDb = db.MustOpen("test")
+	defer testDb.Close()
+	if _, err := testDb.AddTable(locationModel); err != nil {
+		t.Fatalf("existing location table does not match: %v", err)
+	}
+	if _, err := testDb.AddTable(stockModel); err != nil {
+		t.Fatalf("existing stock table does not match: %v", err)
+	}
+}
+
+//openWidget adds the widget table to a new db on the file with the migrate policy
+func openWidget(t *testing.T, filename string, migrate string, tmpl interface{}) (db.IDatabase, db.ITable, error) {
+	t.Helper()
+	c := sqlite.Config{Filename: filename, Migrate: migrate}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	d := c.MustCreate()
+	table, err := d.AddTable(model.New().MustAdd(tmpl))
+	return d, table, err
+}
+
+//schemaChanges returns the SQL recorded for the table in msf_schema_changes
+func schemaChanges(t *testing.T, filename string, tableName string) []string {
+	t.Helper()
+	conn, err := sql.Open("sqlite3", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	rows, err := conn.Query("SELECT change_sql FROM msf_schema_changes WHERE table_name=? ORDER BY rowid", tableName)
+	if err != nil {
+		if strings.Contains(err.Error(), "no such table") {
+			return nil
+		}
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	changes := []string{}
+	for rows.Next() {
+		var change string
+		if err := rows.Scan(&change); err != nil {
+			t.Fatal(err)
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+func TestMigrate(t *testing.T) {
+	dbFilename := "./test-migrate.db"
+	os.Remove(dbFilename)
+	defer os.Remove(dbFilename)
+
+	{
+		type Widget struct {
+			model.Item
+			Name string
+		}
+		d, table, err := openWidget(t, dbFilename, sqldb.MigrateRefuse, Widget{})
+		if err != nil {
+			t.Fatalf("failed to create table: %v", err)
+		}
+		mustAdd(t, table, Widget{Name: "one"})
+		d.Close()
+	}
+
+	//additive changes: columns, uniq set and index
+	type Widget struct {
+		model.Item
+		Name string `uniq:"name"`
+		Qty  int
+		Code string `db:"size=8,index"`
+	}
+	added := []string{`ADD COLUMN "qty"`, `ADD COLUMN "code"`, `CREATE UNIQUE INDEX "widget_name"`, `CREATE INDEX "widget_code"`}
+
+	//refuse lists the changes
+	d, _, err := openWidget(t, dbFilename, sqldb.MigrateRefuse, Widget{})
+	d.Close()
+	if err == nil {
+		t.Fatalf("changed table not refused")
+	}
+	for _, change := range added {
+		if !strings.Contains(err.Error(), "change: ") || !strings.Contains(err.Error(), change) {
+			t.Fatalf("refused without %s: %v", change, err)
+		}
+	}
+
+	//log only logs them
+	d, _, err = openWidget(t, dbFilename, sqldb.MigrateLog, Widget{})
+	d.Close()
+	if err != nil {
+		t.Fatalf("changed table with migrate=log: %v", err)
+	}
+	if changes := schemaChanges(t, dbFilename, "widget"); len(changes) != 1 || !strings.HasPrefix(changes[0], "CREATE TABLE") {
+		t.Fatalf("migrate=log applied %v", changes)
+	}
+	d, _, err = openWidget(t, dbFilename, sqldb.MigrateRefuse, Widget{})
+	d.Close()
+	if err == nil {
+		t.Fatalf("table changed with migrate=log")
+	}
+
+	//apply changes the table and records the changes
+	d, table, err := openWidget(t, dbFilename, sqldb.MigrateApply, Widget{})
+	if err != nil {
+		t.Fatalf("failed to apply changes: %v", err)
+	}
+	if item, err := table.GetOneByKey(db.Key{"name": "one"}); err != nil || item.(Widget).Qty != 0 || item.(Widget).Code != "" {
+		t.Fatalf("existing row after migrate: %+v, %v", item, err)
+	}
+	mustAdd(t, table, Widget{Name: "two", Qty: 2, Code: "2"})
+	if _, err := table.Add(Widget{Name: "two"}); err == nil || err.Code() != db.ERR_DUPLICATE_KEY {
+		t.Fatalf("added uniq set not enforced: %v", err)
+	}
+	d.Close()
+	changes := schemaChanges(t, dbFilename, "widget") //after CREATE TABLE
+	if len(changes) != 1+len(added) {
+		t.Fatalf("recorded changes %v", changes)
+	}
+	for i, change := range added {
+		if !strings.Contains(changes[1+i], change) {
+			t.Fatalf("recorded change[%d] %s instead of %s", i, changes[1+i], change)
+		}
+	}
+	d, _, err = openWidget(t, dbFilename, sqldb.MigrateRefuse, Widget{})
+	d.Close()
+	if err != nil {
+		t.Fatalf("migrated table does not match: %v", err)
+	}
+
+	//other differences are never applied
+	{
+		type Widget struct {
+			model.Item
+			Name string `uniq:"name"`
+			Code string `db:"size=8,index"`
+		}
+		d, _, err := openWidget(t, dbFilename, sqldb.MigrateRefuse, Widget{})
+		d.Close()
+		if err == nil || !strings.Contains(err.Error(), "difference: column qty is not in the model") {
+			t.Fatalf("removed column not refused: %v", err)
+		}
+		d, _, err = openWidget(t, dbFilename, sqldb.MigrateApply, Widget{})
+		d.Close()
+		if err != nil {
+			t.Fatalf("removed column with migrate=apply: %v", err)
+		}
+		if changes := schemaChanges(t, dbFilename, "widget"); len(changes) != 1+len(added) {
+			t.Fatalf("recorded changes %v after removed column", changes)
+		}
+	}
+} //TestMigrate()
+
+func mustAdd(t *testing.T, table db.ITable, item interface{}) int64 {
+	t.Helper()
+	id, err := table.Add(item)
+	if err != nil {
+		t.Fatalf("failed to add %T: %v", item, err)
+	}
+	return id
+}
+
+func TestConformance(t *testing.T) {
+	dbtest.RunConformance(t, func() db.IDatabase {
+		c := sqlite.Config{Filename: sqlite.Memory}
+		if err := c.Validate(); err != nil {
+			t.Fatalf("invalid config: %v", err)
+		}
+		return c.MustCreate()
+	})
+}
+
+func TestPool(t *testing.T) {
+	for _, c := range []sqlite.Config{
+		{Filename: "x.db", PoolConfig: sqldb.PoolConfig{ConnMaxLifetime: "1 hour"}},
+		{Filename: "x.db", PoolConfig: sqldb.PoolConfig{ConnectTimeout: "-1s"}},
+		{Filename: "x.db", PoolConfig: sqldb.PoolConfig{MaxOpenConns: 2, MaxIdleConns: 3}},
+		{Filename: sqlite.Memory, PoolConfig: sqldb.PoolConfig{MaxOpenConns: 2}},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Fatalf("invalid config %+v accepted", c)
+		}
+	}
+
+	c := sqlite.Config{Filename: sqlite.Memory, PoolConfig: sqldb.PoolConfig{ConnMaxLifetime: "1h", ConnectTimeout: "1s"}}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	testDb := c.MustCreate()
+	defer testDb.Close()
+	if err := testDb.Ping(context.Background()); err != nil {
+		t.Fatalf("ping failed: %v", err)
+	}
+	if stats := testDb.Stats(); stats.MaxOpenConnections != 1 || stats.OpenConnections != 1 {
+		t.Fatalf("stats %+v after create", stats)
+	}
+
+	//connect is retried until connect_timeout, then create fails
+	c = sqlite.Config{Filename: "./no-such-dir/test.db", PoolConfig: sqldb.PoolConfig{ConnectTimeout: "300ms"}}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	start := time.Now()
+	if _, err := c.Create(); err == nil {
+		t.Fatalf("created db in directory that does not exist")
+	} else if time.Since(start) < 200*time.Millisecond {
+		t.Fatalf("create failed after %v without retry: %v", time.Since(start), err)
+	}
+}
+
+//a statement prepared outside the transaction waits for its connection, which must not block the transaction
+func TestTxPrepare(t *testing.T) {
+	testDb := sqlite.Config{Filename: sqlite.Memory}.MustCreate()
+	defer testDb.Close()
+	location, err := testDb.AddTable(model.New().MustAdd(Location{}))
+	if err != nil {
+		t.Fatalf("failed to add table: %v", err)
+	}
+	tx, dberr := testDb.Begin(context.Background())
+	if dberr != nil {
+		t.Fatalf("failed to begin: %v", dberr)
+	}
+	defer tx.Rollback()
+
+	waiting := make(chan db.IError)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		_, dberr := location.GetByKeyContext(ctx, db.Key{"code": "1"}, 10)
+		waiting <- dberr
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if _, dberr := tx.MustTable("location").AddContext(ctx, Location{Name: "one", Code: "1"}); dberr != nil {
+		t.Fatalf("add in transaction failed after %v: %v", time.Since(start), dberr)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("add in transaction blocked for %v", d)
+	}
+	if dberr := tx.Commit(); dberr != nil {
+		t.Fatalf("commit failed: %v", dberr)
+	}
+	if dberr := <-waiting; dberr != nil {
+		t.Fatalf("get after commit failed: %v", dberr)
+	}
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/go-msvc/msf/model"
+)
+
+//Now returns the time set in created_at, modified_at and deleted_at,
+//in UTC and microseconds, so it reads back the same from all dbs
+func Now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+//SetTimestamps returns a copy of the item with modified_at set to now, and when added also
+//created_at to now, deleted_at to nil and version to 1, if the item embeds model.Timestamps,
+//model.SoftDelete or model.Version
+func SetTimestamps(itemModel model.IItem, item interface{}, now time.Time, added bool) interface{} {
+	names := []string{model.FieldModifiedAt}
+	if added {
+		names = append(names, model.FieldCreatedAt, model.FieldDeletedAt, model.FieldVersion)
+	}
+	var itemValue reflect.Value
+	for _, name := range names {
+		f, ok := model.AutoField(itemModel, name)
+		if !ok {
+			continue
+		}
+		if !itemValue.IsValid() {
+			itemValue = reflect.New(itemModel.StructType()).Elem()
+			itemValue.Set(reflect.ValueOf(item))
+		}
+		switch name {
+		case model.FieldDeletedAt:
+			itemValue.FieldByIndex(f.StructField.Index).Set(reflect.Zero(f.StructField.Type))
+		case model.FieldVersion:
+			itemValue.FieldByIndex(f.StructField.Index).SetInt(1)
+		default:
+			itemValue.FieldByIndex(f.StructField.Index).Set(reflect.ValueOf(now))
+		}
+	}
+	if !itemValue.IsValid() {
+		return item //no timestamps
+	}
+	return itemValue.Interface()
+}
+
+type withDeletedKey struct{}
+
+//WithDeleted returns a context in which ITable methods also find soft deleted items, e.g.:
+//	item, err := table.GetByIdContext(db.WithDeleted(ctx), id)
+//	page, err := table.QueryContext(db.WithDeleted(ctx), db.NotNull(model.FieldDeletedAt), options)
+func WithDeleted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, withDeletedKey{}, true)
+}
+
+//IsWithDeleted is true when the context was made with WithDeleted()
+func IsWithDeleted(ctx context.Context) bool {
+	withDeleted, _ := ctx.Value(withDeletedKey{}).(bool)
+	return withDeleted
+}
+
+//NotDeleted adds the condition that hides soft deleted items to the filter (nil for all items),
+//unless the item has no model.SoftDelete or the context IsWithDeleted()
+func NotDeleted(ctx context.Context, itemModel model.IItem, filter Filter) Filter {
+	if _, ok := model.AutoField(itemModel, model.FieldDeletedAt); !ok || IsWithDeleted(ctx) {
+		return filter
+	}
+	if filter == nil {
+		return IsNull(model.FieldDeletedAt)
+	}
+	return And{filter, IsNull(model.FieldDeletedAt)}
+}
+
+//SoftDeleteField returns the deleted_at field, or ERR_KEY_FIELD_UNKNOWN when the item has no model.SoftDelete
+func SoftDeleteField(itemModel model.IItem) (model.ItemField, IError) {
+	f, ok := model.AutoField(itemModel, model.FieldDeletedAt)
+	if !ok {
+		return model.ItemField{}, Errorf(ERR_KEY_FIELD_UNKNOWN, "%s does not have soft delete", itemModel.Name())
+	}
+	return f, nil
+}
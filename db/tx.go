@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+//ITx is a transaction from IDatabase.Begin()
+//all operations on its tables are committed or rolled back together
+type ITx interface {
+	Table(name string) (ITable, error) //table added to the db, with operations inside this transaction
+	MustTable(name string) ITable
+	Commit() IError   //fails with ERR_DEADLOCK when the transaction can be retried
+	Rollback() IError //does nothing after Commit() or Rollback()
+}
+
+//nr of times WithTx() runs the function before giving up on deadlocks
+const maxTxAttempts = 3
+
+//WithTx runs fnc in a transaction that is committed when fnc returns nil, else rolled back
+//when fnc or the commit fails with ERR_DEADLOCK, all is rolled back and fnc is called again in a new transaction
+//so fnc must not have side effects outside the transaction
+func WithTx(ctx context.Context, d IDatabase, fnc func(tx ITx) error) error {
+	var err error
+	for attempt := 1; attempt <= maxTxAttempts; attempt++ {
+		if err = runTx(ctx, d, fnc); err == nil {
+			return nil
+		}
+		if !isDeadlock(err) {
+			return err
+		}
+		log.Debugf("transaction attempt %d failed: %v", attempt, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt*10) * time.Millisecond):
+		}
+	}
+	return err
+}
+
+//isDeadlock is true when err is or wraps an IError with ERR_DEADLOCK
+func isDeadlock(err error) bool {
+	var dbErr IError
+	for errors.As(err, &dbErr) {
+		if dbErr.Code() == ERR_DEADLOCK {
+			return true
+		}
+		err = errors.Unwrap(dbErr)
+	}
+	return false
+}
+
+func runTx(ctx context.Context, d IDatabase, fnc func(tx ITx) error) error {
+	tx, dbErr := d.Begin(ctx)
+	if dbErr != nil {
+		return dbErr
+	}
+	defer tx.Rollback()
+	if err := fnc(tx); err != nil {
+		return err
+	}
+	if dbErr := tx.Commit(); dbErr != nil {
+		return dbErr
+	}
+	return nil
+}
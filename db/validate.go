@@ -0,0 +1,26 @@
+package db
+
+import (
+	"github.com/go-msvc/msf/model"
+)
+
+//Validate is called by ITable.Add() and Upsert() before the item is written, see model.IItem.Validate()
+//returns ERR_INVALID that wraps the model.ValidationErrors, get them with errors.As()
+func Validate(itemModel model.IItem, item interface{}, fieldNames ...string) IError {
+	if err := itemModel.Validate(item, fieldNames...); err != nil {
+		return Errorf(ERR_INVALID, "invalid %s: %w", itemModel.Name(), err)
+	}
+	return nil
+}
+
+//ValidateUpd is called by ITable.Upd() to only validate the fields and relations that are updated, see UpdFields()
+func ValidateUpd(itemModel model.IItem, item interface{}, fields []model.ItemField, relations []model.ItemRelation) IError {
+	names := []string{}
+	for _, f := range fields {
+		names = append(names, f.Name)
+	}
+	for _, r := range relations {
+		names = append(names, r.Name)
+	}
+	return Validate(itemModel, item, names...)
+}
@@ -0,0 +1,41 @@
+package db
+
+import (
+	"context"
+
+	"github.com/go-msvc/msf/model"
+)
+
+//ItemVersion returns the version in the item, with ok=false when the item does not embed model.Version
+func ItemVersion(itemModel model.IItem, item interface{}) (version int64, ok bool) {
+	f, ok := model.AutoField(itemModel, model.FieldVersion)
+	if !ok {
+		return 0, false
+	}
+	return f.Value(item).(int64), true
+}
+
+type ifVersionKey struct{}
+
+//IfVersion returns a context in which ITable.DelById(), Restore() and Purge() only change the item
+//when it has the version, else fail with ERR_CONFLICT, e.g. to delete the item as it was read:
+//	err := table.DelByIdContext(db.IfVersion(ctx, item.Version.Version), item.ID)
+//ITable.Upd() always checks the version in the item
+func IfVersion(ctx context.Context, version int64) context.Context {
+	return context.WithValue(ctx, ifVersionKey{}, version)
+}
+
+//ExpectedVersion returns the version set with IfVersion(), with ok=false when not set
+//or when the item does not embed model.Version
+func ExpectedVersion(ctx context.Context, itemModel model.IItem) (version int64, ok bool) {
+	if _, versioned := model.AutoField(itemModel, model.FieldVersion); !versioned {
+		return 0, false
+	}
+	version, ok = ctx.Value(ifVersionKey{}).(int64)
+	return version, ok
+}
+
+//ConflictError is returned when the item exists but does not have the expected version
+func ConflictError(itemModel model.IItem, what string, id int64, version int64) IError {
+	return Errorf(ERR_CONFLICT, "%s.%s(%v) version %d is not the stored version", itemModel.Name(), what, id, version)
+}
@@ -4,5 +4,6 @@ go 1.16
 
 require (
 	github.com/go-sql-driver/mysql v1.5.0
+	github.com/lib/pq v1.9.0
 	github.com/mattn/go-sqlite3 v1.14.6
 )
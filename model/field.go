@@ -0,0 +1,180 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Kind describes how a field value is stored
+type Kind int
+
+const (
+	KindRef     Kind = iota //own id or id of referenced item (int64)
+	KindString              //string, size is max length
+	KindInt                 //signed integer, size is nr of bytes
+	KindUint                //unsigned integer, size is nr of bytes
+	KindFloat               //floating point, size is nr of bytes
+	KindDecimal             //exact number with size digits of which scale after the point, in float or string fields
+	KindBool                //true/false
+	KindTime                //time.Time
+	KindBytes               //[]byte, size is max length
+	KindJSON                //struct, map or slice stored as JSON text
+)
+
+var kindName = map[Kind]string{
+	KindRef:     "ref",
+	KindString:  "string",
+	KindInt:     "int",
+	KindUint:    "uint",
+	KindFloat:   "float",
+	KindDecimal: "decimal",
+	KindBool:    "bool",
+	KindTime:    "time",
+	KindBytes:   "bytes",
+	KindJSON:    "json",
+}
+
+func (k Kind) String() string {
+	if name, ok := kindName[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("kind(%d)", int(k))
+}
+
+//sql.Null* types are nullable values of the kind
+var nullTypeKind = map[reflect.Type]Kind{
+	reflect.TypeOf(sql.NullString{}):  KindString,
+	reflect.TypeOf(sql.NullInt64{}):   KindInt,
+	reflect.TypeOf(sql.NullInt32{}):   KindInt,
+	reflect.TypeOf(sql.NullFloat64{}): KindFloat,
+	reflect.TypeOf(sql.NullBool{}):    KindBool,
+	reflect.TypeOf(sql.NullTime{}):    KindTime,
+}
+
+var nullTypeSize = map[reflect.Type]int{
+	reflect.TypeOf(sql.NullInt64{}):   8,
+	reflect.TypeOf(sql.NullInt32{}):   4,
+	reflect.TypeOf(sql.NullFloat64{}): 8,
+}
+
+//set the kind, size and options of a value field from its Go type and db tag, e.g.:
+//	Name  string    `db:"size=255"`
+//	Note  *string   `db:"size=4000"`              //pointers and sql.Null* are nullable
+//	Price float64   `db:"decimal,size=10,scale=2"`
+//	Qty   int       `db:"default=1"`
+//	Extra Details   `db:"nullable"`               //structs, maps and slices are stored as JSON
+//	Tags  []string  `db:"json"`
+//tag options are:
+//	size=<n>        max length of strings and bytes, or total nr of digits for decimal
+//	scale=<n>       nr of decimal digits after the point
+//	decimal         store float or string as exact decimal number
+//	json            store the value as JSON
+//	nullable        allow NULL in the db, also for non-pointer fields, which then read NULL as zero value
+//	index           create a db index on the field to speed up filters and ordering
+//	default=<value> db default used when a nullable field is nil on insert, must be last as value may contain commas
+func (itemField *ItemField) parseType() error {
+	t := itemField.StructField.Type
+	if t.Kind() == reflect.Ptr {
+		itemField.Nullable = true
+		t = t.Elem()
+	}
+	if kind, ok := nullTypeKind[t]; ok {
+		itemField.Nullable = true
+		itemField.Kind = kind
+		itemField.Size = nullTypeSize[t]
+	} else {
+		switch t.Kind() {
+		case reflect.String:
+			itemField.Kind = KindString
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			itemField.Kind = KindInt
+			itemField.Size = int(t.Size())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			itemField.Kind = KindUint
+			itemField.Size = int(t.Size())
+		case reflect.Float32, reflect.Float64:
+			itemField.Kind = KindFloat
+			itemField.Size = int(t.Size())
+		case reflect.Bool:
+			itemField.Kind = KindBool
+		case reflect.Struct:
+			if t == reflect.TypeOf(time.Time{}) {
+				itemField.Kind = KindTime
+			} else {
+				itemField.Kind = KindJSON
+			}
+		case reflect.Slice:
+			if t.Elem().Kind() == reflect.Uint8 {
+				itemField.Kind = KindBytes
+			} else {
+				itemField.Kind = KindJSON
+			}
+		case reflect.Map, reflect.Array:
+			itemField.Kind = KindJSON
+		default:
+			return fmt.Errorf("field %s has unsupported type %v", itemField.StructField.Name, itemField.StructField.Type)
+		}
+	}
+
+	tag, ok := itemField.StructField.Tag.Lookup("db")
+	if !ok {
+		return nil
+	}
+	sizeSet := false
+	for tag != "" {
+		var option string
+		if strings.HasPrefix(tag, "default=") {
+			option, tag = tag, "" //rest of tag is the default value
+		} else if i := strings.Index(tag, ","); i >= 0 {
+			option, tag = tag[:i], tag[i+1:]
+		} else {
+			option, tag = tag, ""
+		}
+		name, value := option, ""
+		if i := strings.Index(option, "="); i >= 0 {
+			name, value = option[:i], option[i+1:]
+		}
+		switch name {
+		case "size", "scale":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return fmt.Errorf("field %s tag db:\"%s=%s\" is not a positive number", itemField.StructField.Name, name, value)
+			}
+			if name == "size" {
+				itemField.Size = n
+				sizeSet = true
+			} else {
+				itemField.Scale = n
+			}
+		case "decimal":
+			if itemField.Kind != KindFloat && itemField.Kind != KindString {
+				return fmt.Errorf("field %s tag db:\"decimal\" requires float or string instead of %v", itemField.StructField.Name, itemField.StructField.Type)
+			}
+			itemField.Kind = KindDecimal
+			if !sizeSet {
+				itemField.Size = 0
+			}
+		case "json":
+			itemField.Kind = KindJSON
+		case "nullable":
+			itemField.Nullable = true
+		case "index":
+			itemField.Index = true
+		case "default":
+			itemField.Default = &value
+		default:
+			return fmt.Errorf("field %s has unknown tag db:\"%s\"", itemField.StructField.Name, option)
+		}
+	}
+	if itemField.Kind == KindDecimal && itemField.Size == 0 {
+		itemField.Size = 10
+	}
+	if itemField.Scale > itemField.Size && itemField.Kind == KindDecimal {
+		return fmt.Errorf("field %s has decimal scale=%d > size=%d", itemField.StructField.Name, itemField.Scale, itemField.Size)
+	}
+	return nil
+} //ItemField.parseType()
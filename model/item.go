@@ -16,6 +16,14 @@ type IItem interface {
 	Fields() []ItemField
 	FieldByName(name string) (ItemField, bool)
 
+	//slice fields stored in join or child tables, which are not in Fields()
+	Relations() []ItemRelation
+	RelationByName(name string) (ItemRelation, bool)
+
+	//Validate checks the item against the validate tags of its fields, see Validation,
+	//and returns ValidationErrors with all invalid fields or nil when valid
+	Validate(item interface{}, fieldNames ...string) error
+
 	//New allocates a new item struct and return the field names and pointers to those fields in the new struct
 	//to get the struct, use: newStructValue.Interface()
 	New() (newStructValue reflect.Value, fieldNames []string, fieldPtrs []interface{})
@@ -54,6 +62,17 @@ var modelNameRegex = regexp.MustCompile("^" + modelNamePattern + "$")
 //		Second Company
 //	}
 //	That will cause owner to have fields first_company_id and second_company_id of type int
+//
+//	Slices of other models are many-to-many relations stored in a join table, and slices of values
+//	are stored as JSON, or in a child table with tag db:"table", see ItemRelation, e.g.
+//	type Owner struct {
+//		model.Item
+//		Companies []Company
+//		Phones    []string `db:"table,size=20"`
+//	}
+//	That will cause tables owner_companies(owner_id,company_id) and owner_phones(owner_id,seq,value)
+//
+//	Embed Timestamps, SoftDelete and/or Version for the db to manage created_at, modified_at, deleted_at and version
 func newItem(model IModel, tmpl interface{}) (IItem, error) {
 	if model == nil {
 		return nil, fmt.Errorf("NewItem(model=nil)")
@@ -68,6 +87,7 @@ func newItem(model IModel, tmpl interface{}) (IItem, error) {
 		tmpl:       tmpl,
 		structType: reflect.TypeOf(tmpl),
 		fields:     []ItemField{},
+		relations:  []ItemRelation{},
 	}
 	if !isModelStructType(im.structType) {
 		return nil, fmt.Errorf("model(%T) is not valid model struct (must have first anonymous field of type model.Item)", tmpl)
@@ -78,9 +98,31 @@ func newItem(model IModel, tmpl interface{}) (IItem, error) {
 
 	for i := 0; i < im.structType.NumField(); i++ {
 		f := im.structType.Field(i)
+		if i > 0 && (f.PkgPath != "" || f.Tag.Get("db") == "-") {
+			continue //not stored: unexported or tagged db:"-"
+		}
+		if i > 0 && f.Anonymous && autoFieldTypes[f.Type] {
+			fields, err := autoFields(i, f)
+			if err != nil {
+				return nil, fmt.Errorf("item(%s): %v", im.name, err)
+			}
+			im.fields = append(im.fields, fields...)
+			continue
+		}
+		if i > 0 {
+			r, ok, err := newRelation(im, f)
+			if err != nil {
+				return nil, fmt.Errorf("item(%s): %v", im.name, err)
+			}
+			if ok {
+				im.relations = append(im.relations, r)
+				continue
+			}
+		}
 		itemField := ItemField{
 			Name:        StructFieldModelName(f),
 			StructField: f,
+			Kind:        KindRef,
 		}
 
 		if i == 0 {
@@ -88,7 +130,12 @@ func newItem(model IModel, tmpl interface{}) (IItem, error) {
 			itemField.Name = im.name + "_id"
 			itemField.StructField.Index = []int{0, 0}
 		} else {
-			if isModelStructType(f.Type) {
+			if !isModelStructType(f.Type) {
+				//value stored in this item
+				if err := itemField.parseType(); err != nil {
+					return nil, fmt.Errorf("item(%s): %v", im.name, err)
+				}
+			} else {
 				//must already be defined in model
 				refName := snake_case(f.Type.Name())
 				var ok bool
@@ -105,11 +152,25 @@ func newItem(model IModel, tmpl interface{}) (IItem, error) {
 				}
 			}
 
+			var err error
+			if itemField.Validation, err = newValidation(f, itemField.RefItem != nil); err != nil {
+				return nil, fmt.Errorf("item(%s): %v", im.name, err)
+			}
+
 			//see if field is part of uniq sets
-			itemField.UniqSets = strings.Split(f.Tag.Get("uniq"), ",")
+			for _, uniqSetName := range strings.Split(f.Tag.Get("uniq"), ",") {
+				if uniqSetName != "" {
+					itemField.UniqSets = append(itemField.UniqSets, uniqSetName)
+				}
+			}
 		}
 		im.fields = append(im.fields, itemField)
 	}
+	for _, r := range im.relations {
+		if _, ok := im.FieldByName(r.Name); ok {
+			return nil, fmt.Errorf("item(%s) has field and relation named \"%s\"", im.name, r.Name)
+		}
+	}
 	return im, nil
 }
 
@@ -129,14 +190,23 @@ type itemModel struct {
 	tmpl       interface{}
 	structType reflect.Type
 
-	fields []ItemField
+	fields    []ItemField
+	relations []ItemRelation
 }
 
 type ItemField struct {
 	Name        string //lowercase + underscores
 	StructField reflect.StructField
-	RefItem     IItem    //nil for normal values
-	UniqSets    []string //names of uniq sets that this field belong to
+	RefItem     IItem       //nil for normal values
+	UniqSets    []string    //names of uniq sets that this field belong to
+	Kind        Kind        //KindRef for own id and references, else from the Go type and db tag
+	Size        int         //see Kind, 0 when not limited
+	Scale       int         //digits after the point for KindDecimal
+	Nullable    bool        //true for pointers, sql.Null* and db:"nullable"
+	Index       bool        //db:"index"
+	Default     *string     //db:"default=...", nil when not specified
+	Validation  *Validation //validate:"...", nil when not specified
+	Auto        bool        //set by the db, from embedded Timestamps, SoftDelete or Version
 }
 
 func (im itemModel) Model() IModel {
@@ -164,6 +234,19 @@ func (im itemModel) FieldByName(name string) (ItemField, bool) {
 	return ItemField{}, false
 }
 
+func (im itemModel) Relations() []ItemRelation {
+	return im.relations
+}
+
+func (im itemModel) RelationByName(name string) (ItemRelation, bool) {
+	for _, r := range im.relations {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return ItemRelation{}, false
+}
+
 func (im itemModel) FieldNames() []string {
 	names := []string{}
 	for _, itemField := range im.fields {
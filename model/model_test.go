@@ -1,7 +1,9 @@
 package model_test
 
 import (
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-msvc/msf/model"
 )
@@ -61,11 +63,11 @@ func Test1(t *testing.T) {
 
 	//things to check
 	ts := []testspec{
-		{"stock_id", 456, nil},
+		{"stock_id", int64(456), nil},
 		{"name", "s1", nil},
-		{"location_id", 111, locationItem},
-		{"l2_location_id", 222, locationItem},
-		{"l3_location_id", 333, locationItem},
+		{"location_id", int64(111), locationItem},
+		{"l2_location_id", int64(222), locationItem},
+		{"l3_location_id", int64(333), locationItem},
 	}
 	for i, fs := range ts {
 		sif := stockItem.Fields()[i]
@@ -79,3 +81,255 @@ func Test1(t *testing.T) {
 		}
 	}
 }
+
+type Product struct {
+	model.Item
+	Name    string            `db:"size=100"`
+	Price   float64           `db:"decimal,size=8,scale=2"`
+	Qty     *int32            `db:"default=1"`
+	Details map[string]string `db:"nullable"`
+	Ignored string            `db:"-"`
+	notes   string
+}
+
+func TestFieldTypes(t *testing.T) {
+	m := model.New()
+	productItem := m.MustAdd(Product{})
+	if names := productItem.FieldNames(); len(names) != 5 {
+		t.Fatalf("fields %v", names)
+	}
+	ts := []struct {
+		name     string
+		kind     model.Kind
+		size     int
+		scale    int
+		nullable bool
+		def      string
+	}{
+		{"product_id", model.KindRef, 0, 0, false, ""},
+		{"name", model.KindString, 100, 0, false, ""},
+		{"price", model.KindDecimal, 8, 2, false, ""},
+		{"qty", model.KindInt, 4, 0, true, "1"},
+		{"details", model.KindJSON, 0, 0, true, ""},
+	}
+	for _, fs := range ts {
+		f, ok := productItem.FieldByName(fs.name)
+		if !ok {
+			t.Fatalf("field %s not found", fs.name)
+		}
+		def := ""
+		if f.Default != nil {
+			def = *f.Default
+		}
+		if f.Kind != fs.kind || f.Size != fs.size || f.Scale != fs.scale || f.Nullable != fs.nullable || def != fs.def {
+			t.Errorf("field %s: %v,%d,%d,%v,\"%s\" != %v,%d,%d,%v,\"%s\"", fs.name, f.Kind, f.Size, f.Scale, f.Nullable, def, fs.kind, fs.size, fs.scale, fs.nullable, fs.def)
+		}
+	}
+
+	type Bad struct {
+		model.Item
+		Qty int `db:"decimal"`
+	}
+	if _, err := m.Add(Bad{}); err == nil {
+		t.Errorf("added decimal int field")
+	}
+}
+
+type Tag struct {
+	model.Item
+	Name string
+}
+
+type Article struct {
+	model.Item
+	Title string
+	Tags  []Tag    //join table
+	Words []string `db:"table,size=20"` //child table
+	Notes []string //JSON column
+}
+
+func TestRelations(t *testing.T) {
+	m := model.New()
+	m.MustAdd(Tag{})
+	articleItem := m.MustAdd(Article{})
+	if names := articleItem.FieldNames(); len(names) != 3 || names[2] != "notes" {
+		t.Fatalf("fields %v", names)
+	}
+	if len(articleItem.Relations()) != 2 {
+		t.Fatalf("relations %+v", articleItem.Relations())
+	}
+	tags, ok := articleItem.RelationByName("tags")
+	if !ok || tags.Table != "article_tags" || tags.IdName != "article_id" || tags.RefItem == nil || tags.RefItem.Name() != "tag" || tags.Elem.Name != "tag_id" {
+		t.Fatalf("relation tags: %+v", tags)
+	}
+	words, ok := articleItem.RelationByName("words")
+	if !ok || words.Table != "article_words" || words.RefItem != nil || words.Elem.Name != "value" || words.Elem.Kind != model.KindString || words.Elem.Size != 20 {
+		t.Fatalf("relation words: %+v", words)
+	}
+	a := Article{Tags: []Tag{{Item: model.Item{ID: 2}}, {}, {Item: model.Item{ID: 1}}, {Item: model.Item{ID: 2}}}}
+	if ids := tags.RefIds(a); len(ids) != 2 || ids[0] != 2 || ids[1] != 1 {
+		t.Errorf("ref ids %v", ids)
+	}
+
+	type Unknown struct {
+		model.Item
+		Tags []Tag
+	}
+	type Uniq struct {
+		model.Item
+		Words []string `db:"table" uniq:"words"`
+	}
+	type Default struct {
+		model.Item
+		Words []string `db:"table,default=x"`
+	}
+	type BadTag struct {
+		model.Item
+		Tags []Tag `db:"nullable"`
+	}
+	type Clash struct {
+		model.Item
+		Words     []string `db:"table"`
+		WordsList string   `json:"words"`
+	}
+	for _, item := range []interface{}{Uniq{}, Default{}, BadTag{}, Clash{}} {
+		if _, err := m.Add(item); err == nil {
+			t.Errorf("added %T", item)
+		}
+	}
+	if _, err := model.New().Add(Unknown{}); err == nil {
+		t.Errorf("added relation to unknown item")
+	}
+}
+
+type Order struct {
+	model.Item
+	Code     string  `validate:"required,regex=^[A-Z]{2}[0-9]{1,3}$"`
+	Qty      int     `validate:"min=1,max=100"`
+	State    string  `validate:"oneof=new|busy|done"`
+	Note     *string `validate:"max=5"`
+	Location `validate:"required"`
+	Tags     []Tag    `validate:"max=2"`
+	Lines    []string `db:"table" validate:"required"`
+}
+
+func TestValidate(t *testing.T) {
+	m := model.New()
+	m.MustAdd(Location{})
+	m.MustAdd(Tag{})
+	orderItem := m.MustAdd(Order{})
+
+	note := "too long"
+	ts := []struct {
+		order  Order
+		errors string
+	}{
+		{Order{Code: "AB1", Qty: 1, State: "new", Location: Location{Item: model.Item{ID: 1}}, Lines: []string{"x"}}, ""},
+		{Order{}, "code:required,qty:min,state:oneof,location_id:required,lines:required"},
+		{Order{Code: "AB1234", Qty: 101, State: "old", Note: &note, Location: Location{Item: model.Item{ID: 1}}, Tags: make([]Tag, 3), Lines: []string{}},
+			"code:regex,qty:max,state:oneof,note:max,tags:max,lines:required"},
+	}
+	for i, test := range ts {
+		errs := []string{}
+		if err := orderItem.Validate(test.order); err != nil {
+			fieldErrs, ok := err.(model.ValidationErrors)
+			if !ok {
+				t.Fatalf("[%d] error is %T: %v", i, err, err)
+			}
+			for _, e := range fieldErrs {
+				errs = append(errs, e.Field+":"+e.Rule)
+			}
+		}
+		if s := strings.Join(errs, ","); s != test.errors {
+			t.Errorf("[%d] errors %s != %s", i, s, test.errors)
+		}
+	}
+
+	//only named fields
+	if err := orderItem.Validate(Order{Qty: 1}, "qty", "tags"); err != nil {
+		t.Errorf("named fields: %v", err)
+	}
+	if err := orderItem.Validate(Order{}, "qty"); err == nil || err.Error() != "qty must be >= 1" {
+		t.Errorf("named field: %v", err)
+	}
+	if err := orderItem.Validate(Location{}); err == nil {
+		t.Errorf("validated wrong type")
+	}
+
+	type BadRule struct {
+		model.Item
+		Name string `validate:"unknown"`
+	}
+	type BadMin struct {
+		model.Item
+		Name string `validate:"min=x"`
+	}
+	type BadRegex struct {
+		model.Item
+		Qty int `validate:"regex=[0-9]+"`
+	}
+	type BadRef struct {
+		model.Item
+		Location `validate:"max=1"`
+	}
+	type BadRange struct {
+		model.Item
+		Qty int `validate:"min=2,max=1"`
+	}
+	for _, item := range []interface{}{BadRule{}, BadMin{}, BadRegex{}, BadRef{}, BadRange{}} {
+		if _, err := m.Add(item); err == nil {
+			t.Errorf("added %T", item)
+		}
+	}
+}
+
+type Event struct {
+	model.Item
+	model.Timestamps
+	model.SoftDelete
+	Name string
+}
+
+func TestTimestamps(t *testing.T) {
+	eventItem := model.New().MustAdd(Event{})
+	if names := strings.Join(eventItem.FieldNames(), ","); names != "event_id,created_at,modified_at,deleted_at,name" {
+		t.Fatalf("fields %s", names)
+	}
+	for _, name := range []string{model.FieldCreatedAt, model.FieldModifiedAt, model.FieldDeletedAt} {
+		f, ok := model.AutoField(eventItem, name)
+		if !ok || f.Kind != model.KindTime || f.Nullable != (name == model.FieldDeletedAt) {
+			t.Errorf("field %s: %+v", name, f)
+		}
+	}
+	if _, ok := model.AutoField(eventItem, "name"); ok {
+		t.Errorf("name is auto field")
+	}
+	now := time.Now()
+	e := Event{Timestamps: model.Timestamps{CreatedAt: now}, SoftDelete: model.SoftDelete{DeletedAt: &now}}
+	if f, _ := eventItem.FieldByName(model.FieldCreatedAt); f.Value(e) != now {
+		t.Errorf("created_at value %v", f.Value(e))
+	}
+	if f, _ := eventItem.FieldByName(model.FieldDeletedAt); f.Value(e) != &now {
+		t.Errorf("deleted_at value %v", f.Value(e))
+	}
+}
+
+type Account struct {
+	model.Item
+	model.Version
+	Balance int64
+}
+
+func TestVersion(t *testing.T) {
+	accountItem := model.New().MustAdd(Account{})
+	if names := strings.Join(accountItem.FieldNames(), ","); names != "account_id,version,balance" {
+		t.Fatalf("fields %s", names)
+	}
+	f, ok := model.AutoField(accountItem, model.FieldVersion)
+	if !ok || f.Kind != model.KindInt || f.Nullable {
+		t.Fatalf("field version: %+v", f)
+	}
+	if v := f.Value(Account{Version: model.Version{Version: 3}}); v != int64(3) {
+		t.Errorf("version value %v", v)
+	}
+}
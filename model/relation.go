@@ -0,0 +1,135 @@
+package model
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+//ItemRelation is a slice field that is stored in another table with a row per element, rather than in a column:
+//	type Stock struct {
+//		model.Item
+//		Categories []Category              //many-to-many: join table stock_categories(stock_id,category_id)
+//		Tags       []string   `db:"table"` //child table stock_tags(stock_id,seq,value)
+//		Notes      []string                //not a relation: stored as JSON in column notes
+//	}
+//links in a join table are written on add and changed with ITable.Link(), but only read with ITable.Include()
+//values in a child table are written and read with the item like other fields
+type ItemRelation struct {
+	Name        string //lowercase + underscores, e.g. "categories"
+	Table       string //name of the join or child table, e.g. "stock_categories"
+	IdName      string //column with the id of the item that has the slice, e.g. "stock_id"
+	StructField reflect.StructField
+	RefItem     IItem       //linked item in a join table, nil for values in a child table
+	Elem        ItemField   //column for the slice elements: the linked item id, e.g. "category_id", or the value named "value"
+	Validation  *Validation //validate:"...", e.g. required or min/max nr of elements, nil when not specified
+}
+
+//newRelation returns ok=false when the field is not a relation
+func newRelation(im itemModel, f reflect.StructField) (ItemRelation, bool, error) {
+	if f.Type.Kind() != reflect.Slice || f.Type.Elem().Kind() == reflect.Uint8 {
+		return ItemRelation{}, false, nil //not a slice, or []byte
+	}
+	tag, inTable := removeTagOption(f.Tag.Get("db"), "table")
+	if _, isJSON := removeTagOption(tag, "json"); isJSON {
+		return ItemRelation{}, false, nil
+	}
+	r := ItemRelation{
+		Name:        StructFieldModelName(f),
+		IdName:      im.name + "_id",
+		StructField: f,
+	}
+	r.Table = im.name + "_" + r.Name
+	var err error
+	if r.Validation, err = newValidation(f, false); err != nil {
+		return ItemRelation{}, false, err
+	}
+	if !isModelStructType(f.Type.Elem()) && !inTable {
+		return ItemRelation{}, false, nil //slice of values stored as JSON
+	}
+	if f.Tag.Get("uniq") != "" {
+		return ItemRelation{}, false, fmt.Errorf("field %s slice cannot be in a uniq set", f.Name)
+	}
+
+	if isModelStructType(f.Type.Elem()) {
+		if tag != "" {
+			return ItemRelation{}, false, fmt.Errorf("field %s slice of items has unknown tag db:\"%s\"", f.Name, tag)
+		}
+		//must already be defined in model
+		refName := snake_case(f.Type.Elem().Name())
+		var ok bool
+		if r.RefItem, ok = im.model.Item(refName); !ok {
+			return ItemRelation{}, false, fmt.Errorf("item(%s) refers to unknown item(%s)", im.name, refName)
+		}
+		r.Elem = ItemField{
+			Name:        refName + "_id",
+			StructField: reflect.StructField{Name: f.Name, Type: reflect.TypeOf(int64(0))},
+			RefItem:     r.RefItem,
+			Kind:        KindRef,
+		}
+		return r, true, nil
+	}
+
+	//other db tag options describe the values
+	r.Elem = ItemField{
+		Name: "value",
+		StructField: reflect.StructField{
+			Name: f.Name,
+			Type: f.Type.Elem(),
+			Tag:  reflect.StructTag(`db:` + strconv.Quote(tag)),
+		},
+	}
+	if err := r.Elem.parseType(); err != nil {
+		return ItemRelation{}, false, err
+	}
+	if r.Elem.Default != nil {
+		return ItemRelation{}, false, fmt.Errorf("field %s slice values cannot have a default", f.Name)
+	}
+	return r, true, nil
+} //newRelation()
+
+//removeTagOption returns the db tag without the option and true if it was present
+func removeTagOption(tag string, option string) (string, bool) {
+	options := []string{}
+	found := false
+	for tag != "" {
+		var o string
+		if strings.HasPrefix(tag, "default=") {
+			o, tag = tag, "" //rest of tag is the default value
+		} else if i := strings.Index(tag, ","); i >= 0 {
+			o, tag = tag[:i], tag[i+1:]
+		} else {
+			o, tag = tag, ""
+		}
+		if o == option {
+			found = true
+			continue
+		}
+		options = append(options, o)
+	}
+	return strings.Join(options, ","), found
+}
+
+//Slice returns the slice field in the item struct
+func (r ItemRelation) Slice(item interface{}) reflect.Value {
+	if item == nil {
+		panic(fmt.Errorf("ItemRelation.Slice(nil)"))
+	}
+	return reflect.ValueOf(item).FieldByIndex(r.StructField.Index)
+}
+
+//RefIds returns the ids of the linked items in the slice, without zero and duplicate ids
+func (r ItemRelation) RefIds(item interface{}) []int64 {
+	slice := r.Slice(item)
+	ids := []int64{}
+	seen := map[int64]bool{}
+	for i := 0; i < slice.Len(); i++ {
+		id := slice.Index(i).Field(0).Interface().(Item).ID
+		if id != 0 && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
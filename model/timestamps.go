@@ -0,0 +1,75 @@
+package model
+
+import (
+	"reflect"
+	"time"
+)
+
+//Timestamps can be embedded in an item for the db to set field created_at when the item is added,
+//and field modified_at when it is added or updated, e.g.:
+//	type Stock struct {
+//		model.Item
+//		model.Timestamps
+//		Name string
+//	}
+//the values in the item are ignored when it is added or updated
+type Timestamps struct {
+	CreatedAt  time.Time
+	ModifiedAt time.Time
+}
+
+//SoftDelete can be embedded in an item for ITable.DelById() to set field deleted_at rather than
+//removing the item, which then is hidden unless asked for, see db.WithDeleted()
+//deleted items keep their uniq values and links, and can be restored or purged
+type SoftDelete struct {
+	DeletedAt *time.Time
+}
+
+//Version can be embedded in an item for optimistic concurrency control: the db sets field version
+//to 1 when the item is added and increments it with each change, and ITable.Upd() fails with
+//ERR_CONFLICT when the version in the item is not the stored version, e.g.:
+//	item, _ := table.GetById(id) //version 3
+//	item.Qty++
+//	err := table.Upd(item)       //stored version is now 4, or ERR_CONFLICT when changed by another client
+type Version struct {
+	Version int64
+}
+
+//names of the fields in Timestamps, SoftDelete and Version
+const (
+	FieldCreatedAt  = "created_at"
+	FieldModifiedAt = "modified_at"
+	FieldDeletedAt  = "deleted_at"
+	FieldVersion    = "version"
+)
+
+var autoFieldTypes = map[reflect.Type]bool{
+	reflect.TypeOf(Timestamps{}): true,
+	reflect.TypeOf(SoftDelete{}): true,
+	reflect.TypeOf(Version{}):    true,
+}
+
+//autoFields returns the fields of embedded Timestamps, SoftDelete or Version in the item struct field i
+func autoFields(i int, f reflect.StructField) ([]ItemField, error) {
+	fields := []ItemField{}
+	for j := 0; j < f.Type.NumField(); j++ {
+		itemField := ItemField{
+			Name:        StructFieldModelName(f.Type.Field(j)),
+			StructField: f.Type.Field(j),
+			Auto:        true,
+		}
+		itemField.StructField.Index = []int{i, j}
+		if err := itemField.parseType(); err != nil {
+			return nil, err
+		}
+		fields = append(fields, itemField)
+	}
+	return fields, nil
+}
+
+//AutoField returns the field of embedded Timestamps, SoftDelete or Version by name, e.g. FieldDeletedAt,
+//with ok=false when the item does not have it
+func AutoField(item IItem, name string) (ItemField, bool) {
+	f, ok := item.FieldByName(name)
+	return f, ok && f.Auto
+}
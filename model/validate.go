@@ -0,0 +1,235 @@
+package model
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+//Validation is parsed from the validate tag of a field or relation, e.g.:
+//	Name  string   `validate:"required,max=64"`
+//	Code  string   `validate:"regex=^[A-Z]{3}$"`
+//	Qty   int      `validate:"min=1,max=100"`
+//	State string   `validate:"oneof=new|busy|done"`
+//	Note  *string  `validate:"max=1000"`          //nil is valid unless required
+//	Tags  []string `validate:"required,max=10"`  //nr of elements in slices and maps
+//tag options are:
+//	required        value must not be zero, empty or nil, or for references the id must not be 0
+//	min=<n>         min value of numbers, or min length of strings, slices and maps
+//	max=<n>         max value of numbers, or max length of strings, slices and maps
+//	oneof=<a>|<b>   value of a string or integer must be one of the listed values
+//	regex=<expr>    string must match the regular expression, must be last as expr may contain commas
+//the rules are checked on the value in the item, before db defaults are applied
+type Validation struct {
+	Required bool
+	Min      *float64
+	Max      *float64
+	OneOf    []string
+	Regex    *regexp.Regexp
+}
+
+//FieldError describes why the value of a field or relation is invalid
+type FieldError struct {
+	Field   string `json:"field"`   //name of the field or relation, e.g. "location_id"
+	Rule    string `json:"rule"`    //validate tag option that failed, e.g. "required"
+	Message string `json:"message"` //e.g. "is required"
+}
+
+func (e FieldError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+//ValidationErrors is returned by IItem.Validate() with an error for each invalid field
+type ValidationErrors []FieldError
+
+func (errs ValidationErrors) Error() string {
+	s := []string{}
+	for _, e := range errs {
+		s = append(s, e.Error())
+	}
+	return strings.Join(s, "; ")
+}
+
+//newValidation returns nil when the field has no validate tag
+//references can only be required
+func newValidation(f reflect.StructField, isRef bool) (*Validation, error) {
+	tag, ok := f.Tag.Lookup("validate")
+	if !ok || tag == "" {
+		return nil, nil
+	}
+	t := f.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if _, ok := nullTypeKind[t]; ok {
+		t = t.Field(0).Type
+	}
+	v := Validation{}
+	for tag != "" {
+		var option string
+		if strings.HasPrefix(tag, "regex=") {
+			option, tag = tag, "" //rest of tag is the expression
+		} else if i := strings.Index(tag, ","); i >= 0 {
+			option, tag = tag[:i], tag[i+1:]
+		} else {
+			option, tag = tag, ""
+		}
+		name, value := option, ""
+		if i := strings.Index(option, "="); i >= 0 {
+			name, value = option[:i], option[i+1:]
+		}
+		if isRef && name != "required" {
+			return nil, fmt.Errorf("field %s reference can only be validate:\"required\"", f.Name)
+		}
+		switch name {
+		case "required":
+			v.Required = true
+		case "min", "max":
+			switch t.Kind() {
+			case reflect.String, reflect.Slice, reflect.Map, reflect.Array,
+				reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+				reflect.Float32, reflect.Float64:
+			default:
+				return nil, fmt.Errorf("field %s tag validate:\"%s\" not supported on %v", f.Name, option, f.Type)
+			}
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("field %s tag validate:\"%s\" is not a number", f.Name, option)
+			}
+			if name == "min" {
+				v.Min = &n
+			} else {
+				v.Max = &n
+			}
+		case "oneof":
+			switch t.Kind() {
+			case reflect.String,
+				reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			default:
+				return nil, fmt.Errorf("field %s tag validate:\"%s\" not supported on %v", f.Name, option, f.Type)
+			}
+			v.OneOf = strings.Split(value, "|")
+		case "regex":
+			if t.Kind() != reflect.String {
+				return nil, fmt.Errorf("field %s tag validate:\"regex\" requires a string instead of %v", f.Name, f.Type)
+			}
+			var err error
+			if v.Regex, err = regexp.Compile(value); err != nil {
+				return nil, fmt.Errorf("field %s tag validate:\"%s\" is not a valid expression: %v", f.Name, option, err)
+			}
+		default:
+			return nil, fmt.Errorf("field %s has unknown tag validate:\"%s\"", f.Name, option)
+		}
+	}
+	if v.Min != nil && v.Max != nil && *v.Min > *v.Max {
+		return nil, fmt.Errorf("field %s has validate min=%v > max=%v", f.Name, *v.Min, *v.Max)
+	}
+	return &v, nil
+} //newValidation()
+
+//check returns the failed rule and the error message, or "" when the value is valid
+func (v Validation) check(value reflect.Value) (rule string, msg string) {
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			if v.Required {
+				return "required", "is required"
+			}
+			return "", "" //other rules only apply to values
+		}
+		value = value.Elem()
+	}
+	if _, ok := nullTypeKind[value.Type()]; ok {
+		if !value.FieldByName("Valid").Bool() {
+			if v.Required {
+				return "required", "is required"
+			}
+			return "", ""
+		}
+		value = value.Field(0)
+	}
+
+	var n float64
+	unit := "" //when checking length
+	switch value.Kind() {
+	case reflect.String:
+		n, unit = float64(utf8.RuneCountInString(value.String())), "characters"
+	case reflect.Slice, reflect.Map, reflect.Array:
+		n, unit = float64(value.Len()), "elements"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = value.Float()
+	}
+	if v.Required && ((unit != "" && n == 0) || value.IsZero()) {
+		return "required", "is required"
+	}
+	if v.Min != nil && n < *v.Min {
+		if unit != "" {
+			return "min", fmt.Sprintf("must have at least %v %s", *v.Min, unit)
+		}
+		return "min", fmt.Sprintf("must be >= %v", *v.Min)
+	}
+	if v.Max != nil && n > *v.Max {
+		if unit != "" {
+			return "max", fmt.Sprintf("must have at most %v %s", *v.Max, unit)
+		}
+		return "max", fmt.Sprintf("must be <= %v", *v.Max)
+	}
+	if len(v.OneOf) > 0 {
+		s := fmt.Sprint(value.Interface())
+		found := false
+		for _, o := range v.OneOf {
+			if o == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "oneof", "must be one of " + strings.Join(v.OneOf, "|")
+		}
+	}
+	if v.Regex != nil && !v.Regex.MatchString(value.String()) {
+		return "regex", "must match " + v.Regex.String()
+	}
+	return "", ""
+} //Validation.check()
+
+//Validate checks the fields and relations that have a validate tag, or only the named ones when fieldNames
+//are specified, e.g. to validate a partial update, and returns ValidationErrors or nil when the item is valid
+func (im itemModel) Validate(item interface{}, fieldNames ...string) error {
+	if reflect.TypeOf(item) != im.structType {
+		return fmt.Errorf("cannot validate %T as item(%s) of type %v", item, im.name, im.structType)
+	}
+	named := map[string]bool{}
+	for _, name := range fieldNames {
+		named[name] = true
+	}
+	errs := ValidationErrors{}
+	for _, f := range im.fields {
+		if f.Validation == nil || (len(fieldNames) > 0 && !named[f.Name]) {
+			continue
+		}
+		if rule, msg := f.Validation.check(reflect.ValueOf(item).FieldByIndex(f.StructField.Index)); rule != "" {
+			errs = append(errs, FieldError{Field: f.Name, Rule: rule, Message: msg})
+		}
+	}
+	for _, r := range im.relations {
+		if r.Validation == nil || (len(fieldNames) > 0 && !named[r.Name]) {
+			continue
+		}
+		if rule, msg := r.Validation.check(r.Slice(item)); rule != "" {
+			errs = append(errs, FieldError{Field: r.Name, Rule: rule, Message: msg})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+} //itemModel.Validate()
@@ -2,8 +2,9 @@ package mux
 
 import (
 	"fmt"
-	"path"
+	"net/http"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/go-msvc/msf/logger"
@@ -17,16 +18,23 @@ func New(value interface{}) IMux {
 		name:       "",
 		isVariable: false,
 		value:      value,
+		methods:    map[string]interface{}{},
 		subs:       map[string]*mux{},
+		vars:       []*mux{},
 	}
 }
 
 type IMux interface {
 	Name() string
-	Path(sep string) string //with sep=="/" it returns "/" for top, "/sub1" or "/sub1/sub2" for subs, "/sub1/{sub2}" when sub2 is a variable
-	Value() interface{}
-	Add(relpath string, value interface{}) IMux //always use "/" sep in relpath, you can use other sep when you call Path(sep)
-	Route(names []string) (selectedMux IMux, data map[string]interface{})
+	Path(sep string) string                                    //with sep=="/" it returns "/" for top, "/sub1" or "/sub1/sub2" for subs, "/sub1/{sub2}" when sub2 is a variable, or "/sub1/{sub2:int}" when typed
+	Value() interface{}                                        //value used for any method that does not have its own value
+	MethodValue(method string) (value interface{}, found bool) //value for the method, else HEAD uses GET value, else Value()
+	Methods() []string                                         //sorted list of methods with values, including implied HEAD and OPTIONS
+	Add(relpath string, value interface{}) (IMux, error)       //always use "/" sep in relpath, you can use other sep when you call Path(sep)
+	MustAdd(relpath string, value interface{}) IMux
+	AddMethod(method string, relpath string, value interface{}) (IMux, error)
+	MustAddMethod(method string, relpath string, value interface{}) IMux
+	Route(names []string) (selectedMux IMux, data map[string]interface{}) //nil when no route has a value for the names
 }
 
 const namePattern = `[a-zA-Z]([a-zA-Z0-9_-]*[a-zA-Z0-9])*`
@@ -35,10 +43,16 @@ var nameRegex = regexp.MustCompile("^" + namePattern + "$")
 
 type mux struct {
 	parent     *mux
-	name       string          //  "" for top level mux, subs has simple names e.g. "a", "joe", ... used in a path
-	isVariable bool            //true if name was specified {name}, then name is the name of the variable in Route output
-	value      interface{}     //value is nil or defined only when mux represents a seletable resource and it can be any value or even handler function
-	subs       map[string]*mux //sub are like sub folders and files
+	name       string                 //  "" for top level mux, subs has simple names e.g. "a", "joe", ... used in a path
+	isVariable bool                   //true if name was specified {name}, then name is the name of the variable in Route output
+	isCatchAll bool                   //true if name was specified {name...}, then the rest of the path is stored as the variable value
+	varType    string                 //"" for untyped variables, else type name e.g. "int" or regex e.g. "/[a-z]+/"
+	convert    Converter              //converts variable text to value in Route output
+	value      interface{}            //value is nil or defined only when mux represents a seletable resource and it can be any value or even handler function
+	methods    map[string]interface{} //values for specific HTTP methods, e.g. "GET", used before value
+	subs       map[string]*mux        //sub are like sub folders and files
+	vars       []*mux                 //variable subs in the order they were added, tried when no sub matched
+	catchAll   *mux                   //sub that consumes the rest of the path, tried when no sub or variable matched
 }
 
 func (m mux) Name() string {
@@ -47,8 +61,14 @@ func (m mux) Name() string {
 
 func (m mux) Path(sep string) string {
 	ownName := m.name
-	if m.isVariable {
-		ownName = "{" + m.name + "}"
+	if m.isCatchAll {
+		ownName = "{" + m.name + "...}"
+	} else if m.isVariable {
+		if m.varType != "" {
+			ownName = "{" + m.name + ":" + m.varType + "}"
+		} else {
+			ownName = "{" + m.name + "}"
+		}
 	}
 	if m.parent != nil {
 		return m.parent.Path(sep) + sep + ownName
@@ -60,127 +80,312 @@ func (m mux) Value() interface{} {
 	return m.value
 }
 
+func (m mux) MethodValue(method string) (interface{}, bool) {
+	if v, ok := m.methods[method]; ok {
+		return v, true
+	}
+	if method == http.MethodHead {
+		if v, ok := m.methods[http.MethodGet]; ok {
+			return v, true
+		}
+	}
+	if m.value != nil {
+		return m.value, true
+	}
+	return nil, false
+}
+
+func (m mux) Methods() []string {
+	if len(m.methods) == 0 {
+		return nil
+	}
+	methods := []string{}
+	for method := range m.methods {
+		methods = append(methods, method)
+	}
+	if _, ok := m.methods[http.MethodGet]; ok {
+		if _, ok := m.methods[http.MethodHead]; !ok {
+			methods = append(methods, http.MethodHead)
+		}
+	}
+	if _, ok := m.methods[http.MethodOptions]; !ok {
+		methods = append(methods, http.MethodOptions)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
 //param: p can be any path e.g. "a", "/a", "/a/b/c", or "a/b/c", all taken as relative to this mux
 //variable parts of path must be specified in braces, e.g. "/location/{id}/set/{field}/{value}"
+//variables may specify a type to only match valid values and store the typed value in Route data, e.g.:
+//	{id:int}          int64
+//	{price:float}     float64
+//	{active:bool}     bool
+//	{ref:uuid}        string in lowercase
+//	{slug:/[a-z-]+/}  string matching the regex
+//	{name:string}     string, same as {name}
+//	other types can be added with RegisterType()
+//the last part of the path may be a catch-all, e.g. "/files/{path...}" stores the rest of the path, e.g. "a/b/c"
+//
+//names and variables may be siblings, e.g. "/stock/search" and "/stock/{id:int}" and "/stock/{name}"
+//Route() first tries names, then variables in the order they were added, then the catch-all
+//
 //you can add one by one into deeper levels, or specify the full path like that
 //value may be nil to create empty "folder", then this mux will not be selectable, only subs added with values will be selectable
-
-//todo: allow param type spec, e.g. {id:int} or default is {id:string}
-func (m mux) Add(relpath string, value interface{}) IMux {
+func (m *mux) Add(relpath string, value interface{}) (IMux, error) {
 	log.Debugf("mux(%s).Add(\"%s\",%v)\n", m.Path("/"), relpath, value)
-	relpath = path.Clean(relpath)
-	if strings.HasPrefix(relpath, "/") {
-		relpath = relpath[1:]
+	added, err := m.add(splitPath(relpath), "", value)
+	if err != nil {
+		return nil, fmt.Errorf("mux(%s).Add(%s): %v", m.Path("/"), relpath, err)
+	}
+	return added, nil
+}
+
+func (m *mux) MustAdd(relpath string, value interface{}) IMux {
+	added, err := m.Add(relpath, value)
+	if err != nil {
+		panic(err)
+	}
+	return added
+}
+
+//same as Add() but the value is only selected for the specified HTTP method, e.g. "GET"
+//a path may have values for several methods, and also a value for any other method using Add()
+func (m *mux) AddMethod(method string, relpath string, value interface{}) (IMux, error) {
+	log.Debugf("mux(%s).AddMethod(%s,\"%s\",%v)\n", m.Path("/"), method, relpath, value)
+	if method == "" || strings.ToUpper(method) != method {
+		return nil, fmt.Errorf("mux(%s).AddMethod(%s,%s): invalid method (expecting uppercase, e.g. GET)", m.Path("/"), method, relpath)
+	}
+	if value == nil {
+		return nil, fmt.Errorf("mux(%s).AddMethod(%s,%s): nil value", m.Path("/"), method, relpath)
+	}
+	added, err := m.add(splitPath(relpath), method, value)
+	if err != nil {
+		return nil, fmt.Errorf("mux(%s).AddMethod(%s,%s): %v", m.Path("/"), method, relpath, err)
+	}
+	return added, nil
+}
+
+func (m *mux) MustAddMethod(method string, relpath string, value interface{}) IMux {
+	added, err := m.AddMethod(method, relpath, value)
+	if err != nil {
+		panic(err)
 	}
-	names := strings.Split(relpath, "/")
-	return m.add(names, value)
+	return added
 }
 
-func (m *mux) add(names []string, value interface{}) *mux {
-	if m == nil {
-		panic(fmt.Sprintf("nil.add(%v,%v)", names, value))
+//split on "/" except inside braces, so that variable regex may contain "/"
+func splitPath(relpath string) []string {
+	names := []string{}
+	depth := 0
+	start := 0
+	for i, c := range relpath {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			if depth > 0 {
+				depth--
+			}
+		case '/':
+			if depth == 0 {
+				names = append(names, relpath[start:i])
+				start = i + 1
+			}
+		}
 	}
+	return append(names, relpath[start:])
+}
+
+//method is "" to set value for any method
+func (m *mux) add(names []string, method string, value interface{}) (*mux, error) {
 	log.Debugf("  mux(%s).add(%v,%v)\n", m.Path("/"), names, value)
 	for len(names) > 0 && (names[0] == "" || names[0] == ".") {
 		log.Debugf("skip empty name=\"%s\"\n", names[0])
 		names = names[1:]
 	}
 
-	log.Debugf("  (2) mux(%s).add(%v,%v)\n", m.Path("/"), names, value)
 	if len(names) == 0 {
-		if value != nil && m.value != nil {
-			panic(fmt.Errorf("duplicate: mux(%s)=%v cannot change to %v", m.Path("/"), m.value, value))
+		return m, m.set(method, value)
+	}
+
+	subName := names[0]
+	if !strings.HasPrefix(subName, "{") || !strings.HasSuffix(subName, "}") {
+		//named sub
+		if !nameRegex.MatchString(subName) {
+			return nil, fmt.Errorf("invalid name \"%s\"", subName)
+		}
+		sub, found := m.subs[subName]
+		if !found {
+			log.Debugf("  mux(%s): adding sub(%s)\n", m.Path("/"), subName)
+			sub = m.newSub(subName)
+			m.subs[subName] = sub
 		}
-		log.Debugf("  defined mux(%s).value=(%T)%v\n", m.Path("/"), value, value)
+		return sub.add(names[1:], method, value)
+	}
 
-		if subMux, valueIsMux := value.(*mux); valueIsMux {
-			//adding a mux: copy all entries
-			if len(m.subs) > 0 || m.value != nil {
-				panic(fmt.Errorf("mux(%s) cannot add sub mux along with other value/subs", m.Path("/")))
-			}
-			m.value = subMux.value
-			m.isVariable = subMux.isVariable
-			for n, sub := range subMux.subs {
-				m.subs[n] = sub
+	spec := subName[1 : len(subName)-1]
+	if strings.HasSuffix(spec, "...") {
+		//catch-all must be last and there can only be one
+		subName = spec[:len(spec)-3]
+		if !nameRegex.MatchString(subName) {
+			return nil, fmt.Errorf("invalid variable name \"%s\"", subName)
+		}
+		for _, name := range names[1:] {
+			if name != "" && name != "." {
+				return nil, fmt.Errorf("%s must be the last part of the path", names[0])
 			}
-		} else {
-			//adding value
-			m.value = value
 		}
-		return m
+		if m.catchAll != nil && m.catchAll.name != subName {
+			return nil, fmt.Errorf("%s conflicts with existing %s", names[0], m.catchAll.Path("/"))
+		}
+		if m.catchAll == nil {
+			log.Debugf("  mux(%s): adding catch-all(%s)\n", m.Path("/"), subName)
+			m.catchAll = m.newSub(subName)
+			m.catchAll.isVariable = true
+			m.catchAll.isCatchAll = true
+		}
+		return m.catchAll.add(nil, method, value)
 	}
 
-	subName := names[0]
-	subIsVariable := strings.HasPrefix(subName, "{") && strings.HasSuffix(subName, "}")
-	if subIsVariable {
-		subName = subName[1 : len(subName)-1]
+	subName, subType, subConvert, err := parseVariable(spec)
+	if err != nil {
+		return nil, err
 	}
-	if !nameRegex.MatchString(subName) {
-		panic(fmt.Errorf("invalid mux name \"%s\"", subName))
+	for _, existing := range m.vars {
+		if existing.varType != subType {
+			continue
+		}
+		if existing.name != subName {
+			//same type at same position will always match the first, so the second is not reachable
+			return nil, fmt.Errorf("%s conflicts with existing %s", names[0], existing.Path("/"))
+		}
+		return existing.add(names[1:], method, value)
 	}
+	log.Debugf("  mux(%s): adding variable(%s:%s)\n", m.Path("/"), subName, subType)
+	sub := m.newSub(subName)
+	sub.isVariable = true
+	sub.varType = subType
+	sub.convert = subConvert
+	m.vars = append(m.vars, sub)
+	return sub.add(names[1:], method, value)
+}
 
-	//variable sub means no other subs allowed
-	if subIsVariable && len(m.subs) > 0 {
-		panic(fmt.Errorf("mux(%s) cannot add variable(%s) because it already has subs", m.Path("/"), names[0]))
+func (m *mux) newSub(name string) *mux {
+	return &mux{
+		parent:  m,
+		name:    name,
+		value:   nil,
+		methods: map[string]interface{}{},
+		subs:    map[string]*mux{},
+		vars:    []*mux{},
 	}
-	//if parent already has a variable sub, then not other subs allowed
-	if len(m.subs) == 1 {
-		for _, existingSub := range m.subs {
-			if existingSub.isVariable {
-				panic(fmt.Errorf("mux(%s).add(%s) not allowed because expecting a variable {%s}", m.Path("/"), names[0], existingSub.name))
-			}
+}
+
+//set value of this mux for the method ("" for any method)
+func (m *mux) set(method string, value interface{}) error {
+	if method != "" {
+		if existing, ok := m.methods[method]; ok {
+			return fmt.Errorf("duplicate: mux(%s).%s=%v cannot change to %v", m.Path("/"), method, existing, value)
+		}
+		if _, valueIsMux := value.(*mux); valueIsMux {
+			return fmt.Errorf("mux(%s).%s cannot be a sub mux", m.Path("/"), method)
 		}
+		log.Debugf("  defined mux(%s).%s=(%T)%v\n", m.Path("/"), method, value, value)
+		m.methods[method] = value
+		return nil
 	}
+	if value != nil && m.value != nil {
+		return fmt.Errorf("duplicate: mux(%s)=%v cannot change to %v", m.Path("/"), m.value, value)
+	}
+	log.Debugf("  defined mux(%s).value=(%T)%v\n", m.Path("/"), value, value)
 
-	sub, found := m.subs[subName]
-	if !found {
-		log.Debugf("  mux(%s): adding sub(%s) (var=%v)\n", m.Path("/"), subName, subIsVariable)
-		sub = &mux{
-			parent:     m,
-			name:       subName,
-			isVariable: subIsVariable,
-			value:      nil,
-			subs:       map[string]*mux{},
-		}
-		m.subs[subName] = sub
+	subMux, valueIsMux := value.(*mux)
+	if !valueIsMux {
+		//adding value
+		m.value = value
+		return nil
 	}
-	return sub.add(names[1:], value)
-}
 
-func (m mux) Route(names []string) (selectedMux IMux, data map[string]interface{}) {
-	return m.route(names, map[string]interface{}{})
+	//adding a mux: copy all entries
+	if len(m.subs) > 0 || len(m.vars) > 0 || m.catchAll != nil || m.value != nil || len(m.methods) > 0 {
+		return fmt.Errorf("mux(%s) cannot add sub mux along with other value/subs", m.Path("/"))
+	}
+	if m.isCatchAll && (len(subMux.subs) > 0 || len(subMux.vars) > 0 || subMux.catchAll != nil) {
+		return fmt.Errorf("mux(%s) cannot add sub mux with subs after catch-all", m.Path("/"))
+	}
+	m.value = subMux.value
+	for method, methodValue := range subMux.methods {
+		m.methods[method] = methodValue
+	}
+	for n, sub := range subMux.subs {
+		sub.parent = m
+		m.subs[n] = sub
+	}
+	for _, sub := range subMux.vars {
+		sub.parent = m
+		m.vars = append(m.vars, sub)
+	}
+	if subMux.catchAll != nil {
+		subMux.catchAll.parent = m
+		m.catchAll = subMux.catchAll
+	}
+	return nil
+} //mux.set()
+
+func (m *mux) Route(names []string) (selectedMux IMux, data map[string]interface{}) {
+	data = map[string]interface{}{}
+	if selected := m.route(names, data); selected != nil {
+		return selected, data
+	}
+	return nil, nil
 }
 
-func (m mux) route(names []string, initData map[string]interface{}) (selectedMux IMux, data map[string]interface{}) {
+//returns nil if no mux with a value matched the names
+//data is updated with variables on the selected route only
+func (m *mux) route(names []string, data map[string]interface{}) *mux {
 	log.Debugf("mux(%s).route(%+v)\n", m.name, names)
 	for len(names) > 0 && (names[0] == "" || names[0] == ".") {
 		names = names[1:]
 	}
 	if len(names) == 0 {
-		return m, initData
+		if m.value == nil && len(m.methods) == 0 {
+			return nil
+		}
+		return m
 	}
 
-	//if mux expect variable next, no lookup, just store and proceed
-	if len(m.subs) == 1 {
-		for _, sub := range m.subs {
-			if sub.isVariable {
-				//store value
-				initData[sub.name] = names[0]
-				//route on remaining names after the variable
-				return sub.route(names[1:], initData)
-			}
+	//prefer named sub
+	if sub, found := m.subs[names[0]]; found {
+		if selected := sub.route(names[1:], data); selected != nil {
+			return selected
 		}
 	}
 
-	//not variable - normal routing
-	sub, found := m.subs[names[0]]
-	if !found {
-		return nil, nil
+	//else first variable that accepts the value and matches the remaining names
+	for _, sub := range m.vars {
+		value, err := sub.convert(names[0])
+		if err != nil {
+			log.Debugf("mux(%s) does not match \"%s\": %v", sub.Path("/"), names[0], err)
+			continue
+		}
+		data[sub.name] = value
+		if selected := sub.route(names[1:], data); selected != nil {
+			return selected
+		}
+		delete(data, sub.name)
 	}
 
-	remainingNames := []string{}
-	if len(names) > 1 {
-		remainingNames = names[1:]
+	//else catch-all for the rest of the path
+	if m.catchAll != nil && (m.catchAll.value != nil || len(m.catchAll.methods) > 0) {
+		rest := []string{}
+		for _, name := range names {
+			if name != "" && name != "." {
+				rest = append(rest, name)
+			}
+		}
+		data[m.catchAll.name] = strings.Join(rest, "/")
+		return m.catchAll
 	}
-	return sub.route(remainingNames, initData)
-}
+	return nil
+} //mux.route()
@@ -1,6 +1,7 @@
 package mux_test
 
 import (
+	"fmt"
 	"path"
 	"strings"
 	"testing"
@@ -16,19 +17,19 @@ type testSpec struct {
 
 func TestMux(t *testing.T) {
 	m := mux.New(1)
-	a := m.Add("a", 2)
-	a_b := a.Add("b", 3)
-	a_b.Add("c", 4)
-	b := m.Add("b", 5)
-	b.Add("{id}", 6)
-	m.Add("//c////d", 2)
+	a := m.MustAdd("a", 2)
+	a_b := a.MustAdd("b", 3)
+	a_b.MustAdd("c", 4)
+	b := m.MustAdd("b", 5)
+	b.MustAdd("{id}", 6)
+	m.MustAdd("//c////d", 2)
 
 	mm := mux.New(10)
-	mm.Add("z", 11)
-	mm.Add("x", 12)
-	m.Add("g", mm)
+	mm.MustAdd("z", 11)
+	mm.MustAdd("x", 12)
+	m.MustAdd("g", mm)
 
-	m.Add("z/{idz}/y/{idy}/x/{idx}", 13)
+	m.MustAdd("z/{idz}/y/{idy}/x/{idx}", 13)
 
 	testSpecs := []testSpec{
 		{"", 1, nil},
@@ -78,3 +79,189 @@ func TestMux(t *testing.T) {
 		t.Logf("Route(%s) -> %v OK", ts.p, ts.v)
 	}
 }
+
+func TestMuxMethods(t *testing.T) {
+	m := mux.New(nil)
+	m.MustAddMethod("GET", "stock", "list")
+	m.MustAddMethod("POST", "stock", "create")
+	m.MustAddMethod("GET", "stock/{id}", "get")
+	m.MustAddMethod("DELETE", "stock/{id}", "del")
+	m.MustAdd("any", "any")
+	m.MustAddMethod("PUT", "any", "put")
+
+	testSpecs := []struct {
+		method   string
+		p        string
+		v        interface{}
+		found    bool
+		expAllow string
+	}{
+		{"GET", "/stock", "list", true, "GET,HEAD,OPTIONS,POST"},
+		{"HEAD", "/stock", "list", true, "GET,HEAD,OPTIONS,POST"},
+		{"POST", "/stock", "create", true, "GET,HEAD,OPTIONS,POST"},
+		{"PUT", "/stock", nil, false, "GET,HEAD,OPTIONS,POST"},
+		{"OPTIONS", "/stock", nil, false, "GET,HEAD,OPTIONS,POST"},
+		{"GET", "/stock/1", "get", true, "DELETE,GET,HEAD,OPTIONS"},
+		{"DELETE", "/stock/1", "del", true, "DELETE,GET,HEAD,OPTIONS"},
+		{"PATCH", "/stock/1", nil, false, "DELETE,GET,HEAD,OPTIONS"},
+		{"GET", "/any", "any", true, "OPTIONS,PUT"},
+		{"PUT", "/any", "put", true, "OPTIONS,PUT"},
+	}
+	for _, ts := range testSpecs {
+		route, _ := m.Route(strings.Split(path.Clean(ts.p), "/"))
+		if route == nil {
+			t.Fatalf("%s \"%s\" -> nil", ts.method, ts.p)
+		}
+		v, found := route.MethodValue(ts.method)
+		if found != ts.found || v != ts.v {
+			t.Fatalf("%s \"%s\" -> %v,%v instead of %v,%v", ts.method, ts.p, v, found, ts.v, ts.found)
+		}
+		if allow := strings.Join(route.Methods(), ","); allow != ts.expAllow {
+			t.Fatalf("%s \"%s\" -> allow %s instead of %s", ts.method, ts.p, allow, ts.expAllow)
+		}
+		t.Logf("%s %s -> %v OK", ts.method, ts.p, ts.v)
+	}
+}
+
+func TestMuxTypes(t *testing.T) {
+	mux.RegisterType("upper", func(text string) (interface{}, error) {
+		if strings.ToUpper(text) != text {
+			return nil, fmt.Errorf("not uppercase")
+		}
+		return text, nil
+	})
+	m := mux.New(nil)
+	m.MustAdd("i/{id:int}", 1)
+	m.MustAdd("f/{price:float}", 2)
+	m.MustAdd("b/{active:bool}", 3)
+	m.MustAdd("u/{ref:uuid}", 4)
+	m.MustAdd("r/{slug:/[a-z]{2,8}/}", 5)
+	m.MustAdd("s/{name:string}/x", 6)
+	m.MustAdd("c/{code:upper}", 7)
+
+	testSpecs := []testSpec{
+		{"/i/123", 1, map[string]interface{}{"id": int64(123)}},
+		{"/i/abc", nil, nil},
+		{"/f/1.5", 2, map[string]interface{}{"price": float64(1.5)}},
+		{"/f/x", nil, nil},
+		{"/b/true", 3, map[string]interface{}{"active": true}},
+		{"/b/yes", nil, nil},
+		{"/u/0A5F7E4C-1D2B-4C3D-9E8F-001122334455", 4, map[string]interface{}{"ref": "0a5f7e4c-1d2b-4c3d-9e8f-001122334455"}},
+		{"/u/1234", nil, nil},
+		{"/r/abc", 5, map[string]interface{}{"slug": "abc"}},
+		{"/r/abc1", nil, nil},
+		{"/s/joe/x", 6, map[string]interface{}{"name": "joe"}},
+		{"/c/ABC", 7, map[string]interface{}{"code": "ABC"}},
+		{"/c/abc", nil, nil},
+	}
+	for _, ts := range testSpecs {
+		route, data := m.Route(strings.Split(path.Clean(ts.p), "/"))
+		if ts.v == nil {
+			if route != nil {
+				t.Fatalf("\"%s\" -> %v instead of nil", ts.p, route.Value())
+			}
+			continue
+		}
+		if route == nil {
+			t.Fatalf("\"%s\" -> nil", ts.p)
+		}
+		if route.Value() != ts.v {
+			t.Fatalf("\"%s\" -> %v instead of %v", ts.p, route.Value(), ts.v)
+		}
+		for expName, expValue := range ts.expValues {
+			if dataValue := data[expName]; dataValue != expValue {
+				t.Fatalf("\"%s\" -> got %s:(%T)%v instead of (%T)%v", ts.p, expName, dataValue, dataValue, expValue, expValue)
+			}
+		}
+		t.Logf("Route(%s) -> %v OK", ts.p, ts.v)
+	}
+
+	if p := m.MustAdd("i/{id:int}/detail", 8).Path("/"); p != "/i/{id:int}/detail" {
+		t.Fatalf("path=%s", p)
+	}
+}
+
+func TestMuxSiblings(t *testing.T) {
+	m := mux.New(nil)
+	m.MustAdd("stock/search", 1)
+	m.MustAdd("stock/{id:int}", 2)
+	m.MustAdd("stock/{name}", 3)
+	m.MustAdd("stock/{id:int}/history", 4)
+	m.MustAdd("stock/{name}/detail", 5)
+	m.MustAdd("files/{path...}", 6)
+	m.MustAdd("files/readme", 7)
+
+	testSpecs := []testSpec{
+		{"/stock/search", 1, nil},
+		{"/stock/123", 2, map[string]interface{}{"id": int64(123)}},
+		{"/stock/abc", 3, map[string]interface{}{"name": "abc"}},
+		{"/stock/123/history", 4, map[string]interface{}{"id": int64(123)}},
+		{"/stock/123/detail", 5, map[string]interface{}{"name": "123"}}, //int var does not have detail, so falls back to name
+		{"/stock/abc/history", nil, nil},
+		{"/files/readme", 7, nil},
+		{"/files/a", 6, map[string]interface{}{"path": "a"}},
+		{"/files/a/b/c", 6, map[string]interface{}{"path": "a/b/c"}},
+		{"/files/readme/more", 6, map[string]interface{}{"path": "readme/more"}},
+		{"/files", nil, nil},
+	}
+	for _, ts := range testSpecs {
+		route, data := m.Route(strings.Split(path.Clean(ts.p), "/"))
+		if ts.v == nil {
+			if route != nil {
+				t.Fatalf("\"%s\" -> %v instead of nil", ts.p, route.Value())
+			}
+			continue
+		}
+		if route == nil {
+			t.Fatalf("\"%s\" -> nil", ts.p)
+		}
+		if route.Value() != ts.v {
+			t.Fatalf("\"%s\" -> %v instead of %v", ts.p, route.Value(), ts.v)
+		}
+		if len(data) != len(ts.expValues) {
+			t.Fatalf("\"%s\" -> data %+v instead of %+v", ts.p, data, ts.expValues)
+		}
+		for expName, expValue := range ts.expValues {
+			if dataValue := data[expName]; dataValue != expValue {
+				t.Fatalf("\"%s\" -> got %s:(%T)%v instead of (%T)%v", ts.p, expName, dataValue, dataValue, expValue, expValue)
+			}
+		}
+		t.Logf("Route(%s) -> %v OK", ts.p, ts.v)
+	}
+
+	//conflicts are reported as errors
+	for _, p := range []string{
+		"stock/search",         //duplicate value
+		"stock/{other}",        //same type as {name}
+		"stock/{other:string}", //same type as {name}
+		"stock/{other:int}",    //same type as {id:int}
+		"files/{other...}",     //second catch-all
+		"files/{path...}/more", //catch-all not last
+		"stock/{id:unknown}",   //unknown type
+		"stock/{bad name}",     //invalid name
+	} {
+		if _, err := m.Add(p, 99); err == nil {
+			t.Fatalf("Add(%s) did not fail", p)
+		} else {
+			t.Logf("Add(%s) failed as expected: %v", p, err)
+		}
+	}
+}
+
+//types may be registered while routes are added, run with -race
+func TestMuxTypesConcurrent(t *testing.T) {
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100; i++ {
+			mux.RegisterType(fmt.Sprintf("concurrent%d", i), func(text string) (interface{}, error) { return text, nil })
+		}
+		close(done)
+	}()
+	for i := 0; i < 100; i++ {
+		m := mux.New(nil)
+		m.MustAdd("a/{name}", 1)
+		m.MustAdd("b/{name:string}", 2)
+		m.MustAdd("c/{id:int}", 3)
+	}
+	<-done
+}
@@ -0,0 +1,94 @@
+package mux
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//Converter parses the text of a path variable into the value stored in route data
+//it returns an error when the text is not valid for the type, then the route does not match
+type Converter func(text string) (value interface{}, err error)
+
+//RegisterType makes a type available for variables in a path, e.g. after RegisterType("date", ...)
+//the path "/report/{day:date}" will only match when the converter accepts the text
+func RegisterType(name string, converter Converter) {
+	if !typeNameRegex.MatchString(name) {
+		panic(fmt.Errorf("invalid mux type name \"%s\"", name))
+	}
+	if converter == nil {
+		panic(fmt.Errorf("mux type(%s) converter=nil", name))
+	}
+	convertersMutex.Lock()
+	defer convertersMutex.Unlock()
+	converters[name] = converter
+}
+
+var (
+	convertersMutex sync.RWMutex
+	converters      = map[string]Converter{
+		"string": func(text string) (interface{}, error) { return text, nil },
+		"int":    func(text string) (interface{}, error) { return strconv.ParseInt(text, 10, 64) },
+		"float":  func(text string) (interface{}, error) { return strconv.ParseFloat(text, 64) },
+		"bool":   func(text string) (interface{}, error) { return strconv.ParseBool(text) },
+		"uuid": func(text string) (interface{}, error) {
+			if !uuidRegex.MatchString(text) {
+				return nil, fmt.Errorf("\"%s\" is not a uuid", text)
+			}
+			return strings.ToLower(text), nil
+		},
+	}
+)
+
+const typeNamePattern = `[a-zA-Z][a-zA-Z0-9_]*`
+
+var (
+	typeNameRegex = regexp.MustCompile("^" + typeNamePattern + "$")
+	uuidRegex     = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+//parse variable spec inside braces, e.g. "id", "id:int" or "slug:/[a-z0-9-]+/"
+//the type is "" when not specified, and also for "string" which is the same
+func parseVariable(spec string) (name string, typeName string, converter Converter, err error) {
+	name = spec
+	if i := strings.Index(spec, ":"); i >= 0 {
+		name = spec[:i]
+		typeName = spec[i+1:]
+	}
+	if !nameRegex.MatchString(name) {
+		return "", "", nil, fmt.Errorf("invalid variable name \"%s\"", name)
+	}
+
+	switch {
+	case typeName == "" || typeName == "string":
+		convertersMutex.RLock()
+		defer convertersMutex.RUnlock()
+		return name, "", converters["string"], nil
+
+	case strings.HasPrefix(typeName, "/"):
+		if len(typeName) < 3 || !strings.HasSuffix(typeName, "/") {
+			return "", "", nil, fmt.Errorf("invalid variable {%s} (regex must be written as /.../)", spec)
+		}
+		regex, err := regexp.Compile("^(?:" + typeName[1:len(typeName)-1] + ")$")
+		if err != nil {
+			return "", "", nil, fmt.Errorf("invalid variable {%s} regex: %v", spec, err)
+		}
+		return name, typeName, func(text string) (interface{}, error) {
+			if !regex.MatchString(text) {
+				return nil, fmt.Errorf("\"%s\" does not match %s", text, typeName)
+			}
+			return text, nil
+		}, nil
+
+	default:
+		convertersMutex.RLock()
+		defer convertersMutex.RUnlock()
+		converter, ok := converters[typeName]
+		if !ok {
+			return "", "", nil, fmt.Errorf("invalid variable {%s} of unknown type \"%s\"", spec, typeName)
+		}
+		return name, typeName, converter, nil
+	}
+} //parseVariable()
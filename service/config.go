@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/go-msvc/msf/config"
+)
+
+//server types that can be configured in "service.<name>", e.g.:
+//	{"service":{"stock":{"http":{"address":"0.0.0.0","port":8080,"grace_period":"30s"}}}}
+var serverConfigs = map[string]interface{}{
+	"http": HttpConfig{},
+}
+
+type iServer interface {
+	serve(name string, handler http.Handler) error
+}
+
+//load the service config, or default to http on localhost:3000 when not configured
+func (s *service) config() (iServer, error) {
+	cv := config.Get("service").Get(s.name)
+	if cv.Value() == nil {
+		cfg := HttpConfig{}
+		if err := cfg.Validate(); err != nil {
+			return nil, err
+		}
+		return cfg, nil
+	}
+	cfg, err := cv.GetStruct(serverConfigs)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.(iServer), nil
+}
+
+//durations are specified as strings, e.g. "500ms", "5s" or "1m"
+//timeouts that are not specified or "0" means no timeout
+type HttpConfig struct {
+	Address        string `json:"address"`
+	Port           int    `json:"port"`
+	ReadTimeout    string `json:"read_timeout"`
+	WriteTimeout   string `json:"write_timeout"`
+	IdleTimeout    string `json:"idle_timeout"`
+	MaxHeaderBytes int    `json:"max_header_bytes"` //0 uses http.DefaultMaxHeaderBytes
+	GracePeriod    string `json:"grace_period"`     //time to drain in-flight requests on shutdown (default 10s)
+
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	idleTimeout  time.Duration
+	gracePeriod  time.Duration
+}
+
+func (c *HttpConfig) Validate() error {
+	if c.Address == "" {
+		c.Address = "localhost"
+	}
+	if c.Port == 0 {
+		c.Port = 3000
+	}
+	if c.Port < 0 || c.Port > 65535 {
+		return fmt.Errorf("invalid port=%d", c.Port)
+	}
+	if c.MaxHeaderBytes < 0 {
+		return fmt.Errorf("invalid max_header_bytes=%d", c.MaxHeaderBytes)
+	}
+	if c.GracePeriod == "" {
+		c.GracePeriod = "10s"
+	}
+	return config.ParseDurations(
+		config.Duration{Name: "read_timeout", Value: c.ReadTimeout, Parsed: &c.readTimeout},
+		config.Duration{Name: "write_timeout", Value: c.WriteTimeout, Parsed: &c.writeTimeout},
+		config.Duration{Name: "idle_timeout", Value: c.IdleTimeout, Parsed: &c.idleTimeout},
+		config.Duration{Name: "grace_period", Value: c.GracePeriod, Parsed: &c.gracePeriod},
+	)
+} //HttpConfig.Validate()
+
+func (c HttpConfig) serve(name string, handler http.Handler) error {
+	server := &http.Server{
+		Addr:           fmt.Sprintf("%s:%d", c.Address, c.Port),
+		Handler:        handler,
+		ReadTimeout:    c.readTimeout,
+		WriteTimeout:   c.writeTimeout,
+		IdleTimeout:    c.idleTimeout,
+		MaxHeaderBytes: c.MaxHeaderBytes,
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	serverDone := make(chan error, 1)
+	go func() {
+		serverDone <- server.ListenAndServe()
+	}()
+	log.Infof("service(%s) listening on http://%s", name, server.Addr)
+
+	select {
+	case err := <-serverDone:
+		return fmt.Errorf("HTTP server failed: %v", err)
+	case sig := <-stop:
+		log.Infof("service(%s) received %v, shutting down (grace period %v)", name, sig, c.gracePeriod)
+	}
+
+	//Shutdown closes the listener and waits for active requests to complete
+	ctx, cancel := context.WithTimeout(context.Background(), c.gracePeriod)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		server.Close()
+		<-serverDone
+		return fmt.Errorf("HTTP server did not stop within grace period %v: %v", c.gracePeriod, err)
+	}
+	if err := <-serverDone; err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("HTTP server failed: %v", err)
+	}
+	log.Infof("service(%s) stopped", name)
+	return nil
+} //HttpConfig.serve()
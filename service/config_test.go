@@ -0,0 +1,131 @@
+package service
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-msvc/msf/config"
+	"github.com/go-msvc/msf/mux"
+)
+
+func TestHttpConfig(t *testing.T) {
+	for _, tc := range []struct {
+		config   HttpConfig
+		expected HttpConfig //after Validate(), when valid
+		err      string
+	}{
+		{config: HttpConfig{}, expected: HttpConfig{Address: "localhost", Port: 3000, GracePeriod: "10s", gracePeriod: 10 * time.Second}},
+		{config: HttpConfig{Address: "0.0.0.0", Port: 8080, ReadTimeout: "5s", WriteTimeout: "1m", IdleTimeout: "0", MaxHeaderBytes: 4096, GracePeriod: "500ms"},
+			expected: HttpConfig{Address: "0.0.0.0", Port: 8080, ReadTimeout: "5s", WriteTimeout: "1m", IdleTimeout: "0", MaxHeaderBytes: 4096, GracePeriod: "500ms",
+				readTimeout: 5 * time.Second, writeTimeout: time.Minute, gracePeriod: 500 * time.Millisecond}},
+		{config: HttpConfig{Port: -1}, err: "invalid port=-1"},
+		{config: HttpConfig{Port: 65536}, err: "invalid port=65536"},
+		{config: HttpConfig{MaxHeaderBytes: -1}, err: "invalid max_header_bytes=-1"},
+		{config: HttpConfig{ReadTimeout: "5"}, err: "invalid read_timeout=\"5\""},
+		{config: HttpConfig{WriteTimeout: "-1s"}, err: "invalid write_timeout=\"-1s\" may not be negative"},
+		{config: HttpConfig{IdleTimeout: "x"}, err: "invalid idle_timeout=\"x\""},
+		{config: HttpConfig{GracePeriod: "-1m"}, err: "invalid grace_period=\"-1m\" may not be negative"},
+	} {
+		c := tc.config
+		err := c.Validate()
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("%+v: error %v instead of %s", tc.config, err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%+v: %v", tc.config, err)
+		}
+		if c != tc.expected {
+			t.Fatalf("%+v validated as %+v instead of %+v", tc.config, c, tc.expected)
+		}
+	}
+}
+
+//the service listens as configured in "service.<name>.http", and on SIGTERM completes
+//in-flight requests within the grace period before Run() returns
+func TestRunShutdown(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	config.Set("service", map[string]interface{}{
+		"drain": map[string]interface{}{"http": map[string]interface{}{"address": "127.0.0.1", "port": port, "grace_period": "5s"}},
+		"bad":   map[string]interface{}{"http": map[string]interface{}{"port": -1}},
+	})
+
+	if err := NewService("bad").Run(); err == nil || !strings.Contains(err.Error(), "invalid port=-1") {
+		t.Fatalf("run with invalid config: %v", err)
+	}
+
+	started := make(chan bool, 1)
+	m := mux.New(nil)
+	m.MustAdd("slow", http.HandlerFunc(func(httpRes http.ResponseWriter, httpReq *http.Request) {
+		started <- true
+		time.Sleep(300 * time.Millisecond)
+		httpRes.Write([]byte("done"))
+	}))
+	m.MustAdd("fast", http.HandlerFunc(func(httpRes http.ResponseWriter, httpReq *http.Request) {
+		httpRes.Write([]byte("ok"))
+	}))
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- NewService("drain").HandleMux("api", m).Run()
+	}()
+
+	//without keep-alive, so the client leaves no unused connections, which delay Shutdown()
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	url := "http://" + listener.Addr().String() + "/api/"
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if httpRes, err := client.Get(url + "fast"); err == nil {
+			httpRes.Body.Close()
+			break
+		} else if time.Since(start) > 2*time.Second {
+			t.Fatalf("service not listening on %s: %v", url, err)
+		}
+	}
+
+	type result struct {
+		body string
+		err  error
+	}
+	inFlight := make(chan result, 1)
+	go func() {
+		httpRes, err := client.Get(url + "slow")
+		if err != nil {
+			inFlight <- result{err: err}
+			return
+		}
+		defer httpRes.Body.Close()
+		body, err := ioutil.ReadAll(httpRes.Body)
+		inFlight <- result{body: string(body), err: err}
+	}()
+	<-started
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+
+	if res := <-inFlight; res.err != nil || res.body != "done" {
+		t.Fatalf("in-flight request got \"%s\", %v", res.body, res.err)
+	}
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Fatalf("run stopped with error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("run did not return after shutdown")
+	}
+	if httpRes, err := client.Get(url + "fast"); err == nil {
+		httpRes.Body.Close()
+		t.Fatalf("service still listening after shutdown")
+	}
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+)
+
+//IError can be returned by handlers to set the HTTP status and the error code in the response header
+type IError interface {
+	error
+	Status() int  //HTTP status, e.g. http.StatusNotFound
+	Code() string //code in response header, e.g. "NOT_FOUND"
+}
+
+func NewError(status int, code string, err error) IError {
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	return serviceError{
+		error:  err,
+		status: status,
+		code:   code,
+	}
+}
+
+func Errorf(status int, code string, format string, args ...interface{}) IError {
+	return NewError(status, code, fmt.Errorf(format, args...))
+}
+
+//IErrorDetails can be implemented by handler errors to add details to the response header,
+//e.g. the errors of each invalid field
+type IErrorDetails interface {
+	Details() interface{}
+}
+
+//ErrorWithDetails returns an error that implements IError and IErrorDetails
+func ErrorWithDetails(status int, code string, err error, details interface{}) IError {
+	e := NewError(status, code, err).(serviceError)
+	e.details = details
+	return e
+}
+
+type serviceError struct {
+	error
+	status  int
+	code    string
+	details interface{}
+}
+
+func (e serviceError) Status() int { return e.status }
+
+func (e serviceError) Code() string { return e.code }
+
+func (e serviceError) Details() interface{} { return e.details }
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -9,6 +10,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/go-msvc/msf/db"
 	"github.com/go-msvc/msf/logger"
 	"github.com/go-msvc/msf/mux"
 )
@@ -17,7 +19,9 @@ var log = logger.New("msf").New("service")
 
 type IService interface {
 	Handle(name string, handler interface{} /*checked at runtime: HandlerFunc*/) IService
+	HandleMethod(method string, name string, handler interface{} /*checked at runtime: HandlerFunc*/) IService
 	HandleMux(name string, mux mux.IMux) IService
+	WithDb(database db.IDatabase) IService //database for transactions from IContext.Tx()
 	Run() error
 	MustRun()
 }
@@ -30,8 +34,10 @@ func NewService(name string) IService {
 }
 
 type service struct {
-	name string
-	mux  mux.IMux
+	name     string
+	mux      mux.IMux
+	database db.IDatabase
+	errs     []error //route registration errors reported by Run()
 }
 
 type handler struct {
@@ -44,6 +50,22 @@ type handler struct {
 }
 
 func (s *service) Handle(name string, fnc interface{} /*HandlerFunc*/) IService {
+	if _, err := s.mux.Add(name, s.newHandler(name, fnc)); err != nil {
+		s.addError(err)
+	}
+	return s
+}
+
+//same as Handle() but only for the specified HTTP method, e.g. "GET"
+//other methods on the same name will get 405 Method Not Allowed, unless they also have handlers
+func (s *service) HandleMethod(method string, name string, fnc interface{} /*HandlerFunc*/) IService {
+	if _, err := s.mux.AddMethod(method, name, s.newHandler(name, fnc)); err != nil {
+		s.addError(err)
+	}
+	return s
+}
+
+func (s *service) newHandler(name string, fnc interface{}) handler {
 	if fnc == nil {
 		panic(fmt.Errorf("service(%s).handler(%s)=nil", s.name, name))
 	}
@@ -53,25 +75,40 @@ func (s *service) Handle(name string, fnc interface{} /*HandlerFunc*/) IService
 		panic(fmt.Errorf("service(%s).handler(%s)=%T is not a func", s.name, name, fnc))
 	}
 
-	s.mux.Add(name, handler{
+	return handler{
 		fncValue: reflect.ValueOf(fnc),
 		reqType:  reflect.TypeOf(fnc).In(1),
-	})
-	return s
+	}
 }
 
 func (s *service) HandleMux(name string, mux mux.IMux) IService {
-	s.mux.Add(name, mux)
+	if _, err := s.mux.Add(name, mux); err != nil {
+		s.addError(err)
+	}
+	return s
+}
+
+func (s *service) WithDb(database db.IDatabase) IService {
+	s.database = database
 	return s
 }
 
+func (s *service) addError(err error) {
+	log.Errorf("service(%s): %v", s.name, err)
+	s.errs = append(s.errs, err)
+}
+
+//Run serves until SIGINT or SIGTERM is received, then stops accepting new requests
+//and returns after in-flight requests completed or the configured grace period expired
 func (s *service) Run() error {
-	//todo: load config to start correct type of interface
-	//for now, just create http default api
-	if err := http.ListenAndServe("localhost:3000", s); err != nil {
-		return fmt.Errorf("HTTP server failed: %v", err)
+	if len(s.errs) > 0 {
+		return fmt.Errorf("service(%s) has %d invalid routes, e.g.: %v", s.name, len(s.errs), s.errs[0])
 	}
-	return nil
+	cfg, err := s.config()
+	if err != nil {
+		return fmt.Errorf("service(%s) config error: %v", s.name, err)
+	}
+	return cfg.serve(s.name, s)
 }
 
 func (s *service) MustRun() {
@@ -86,6 +123,7 @@ func (s *service) ServeHTTP(httpRes http.ResponseWriter, httpReq *http.Request)
 		Data:   nil,
 	}
 	respondWithHeader := true
+	httpStatus := http.StatusOK
 	defer func() {
 		if respondWithHeader {
 			jsonRes, err := json.Marshal(res)
@@ -100,6 +138,7 @@ func (s *service) ServeHTTP(httpRes http.ResponseWriter, httpReq *http.Request)
 				jsonRes, _ = json.Marshal(res)
 			}
 			httpRes.Header().Set("Content-Type", "application/json")
+			httpRes.WriteHeader(httpStatus)
 			httpRes.Write(jsonRes)
 		}
 	}()
@@ -109,43 +148,79 @@ func (s *service) ServeHTTP(httpRes http.ResponseWriter, httpReq *http.Request)
 	//routing...
 	routeMux, data := s.mux.Route(strings.Split(path.Clean(httpReq.URL.Path), "/"))
 	log.Debugf("  %s -> hdlr(%+v),data(%+v)", httpReq.URL.Path, routeMux, data)
-	if routeMux == nil || routeMux.Value() == nil {
+	if routeMux == nil {
+		httpStatus = http.StatusNotFound
 		res.Header.Error = fmt.Sprintf("unknown route %s", httpReq.URL.Path)
 		return
 	}
 
+	//select value for the method (HEAD uses GET, and the response body is discarded by http.Server)
+	routeValue, ok := routeMux.MethodValue(httpReq.Method)
+	if !ok {
+		allowedMethods := routeMux.Methods()
+		if len(allowedMethods) == 0 {
+			httpStatus = http.StatusNotFound
+			res.Header.Error = fmt.Sprintf("unknown route %s", httpReq.URL.Path)
+			return
+		}
+		httpRes.Header().Set("Allow", strings.Join(allowedMethods, ", "))
+		if httpReq.Method == http.MethodOptions {
+			respondWithHeader = false
+			httpRes.WriteHeader(http.StatusNoContent)
+			return
+		}
+		httpStatus = http.StatusMethodNotAllowed
+		res.Header.Error = fmt.Sprintf("method %s not allowed on %s", httpReq.Method, httpReq.URL.Path)
+		return
+	}
+
 	//if route value is an http handler, then call it and it has full control over response
-	if httpHandlerFunc, ok := routeMux.Value().(http.HandlerFunc); ok {
+	if httpHandlerFunc, ok := routeValue.(http.HandlerFunc); ok {
 		//full http handler function for any method
-		//but give handler only the remaining path to care about
-
-		httpReq.URL.Path = path.Clean(httpReq.URL.Path)[len(routeMux.Path("/")):]
+		//but give handler only the remaining path to care about,
+		//which is the value of a catch-all variable, else the route consumed the whole path
+		httpReq.URL.Path = "/"
+		if strings.HasSuffix(routeMux.Path("/"), "...}") {
+			httpReq.URL.Path += data[routeMux.Name()].(string)
+		}
 		respondWithHeader = false
 		httpHandlerFunc(httpRes, httpReq)
 		return
 	}
 
 	//if route value is func(ctx IContext, muxData map[string]interface{}) (res interface{}, err error)
-	if muxHandlerFunc, ok := routeMux.Value().(func(ctx IContext, muxData map[string]interface{}) (res interface{}, err error)); ok {
+	if muxHandlerFunc, ok := routeValue.(func(ctx IContext, muxData map[string]interface{}) (res interface{}, err error)); ok {
 		//respondWithHeader = false
 		var err error
-		ctx := NewContext()
-		res.Data, err = muxHandlerFunc(ctx, data)
+		ctx := s.newContext(httpRes, httpReq, &httpStatus)
+		defer ctx.rollbackOnPanic()
+		var result interface{}
+		result, err = muxHandlerFunc(ctx, data)
+		err = ctx.endTx(err)
 		if err != nil {
 			res.Header.Success = false
 			res.Header.Error = fmt.Sprintf("handler failed: %v", err)
+			httpStatus = http.StatusOK
+			if serviceError, ok := err.(IError); ok {
+				httpStatus = serviceError.Status()
+				res.Header.Code = serviceError.Code()
+			}
+			if detailsError, ok := err.(IErrorDetails); ok {
+				res.Header.Details = detailsError.Details()
+			}
 			return
 		}
 		res.Header.Success = true
 		res.Header.Error = ""
+		res.setData(result)
 		return
 	}
 
 	//if route value is a handler, then we implement generic request parsing and response encoding
 	//but if not, we do not know what to do here...
-	handler, ok := routeMux.Value().(handler)
+	handler, ok := routeValue.(handler)
 	if !ok {
-		res.Header.Error = fmt.Sprintf("unknown route value type %T", routeMux.Value())
+		res.Header.Error = fmt.Sprintf("unknown route value type %T", routeValue)
 		return
 	}
 
@@ -198,19 +273,31 @@ func (s *service) ServeHTTP(httpRes http.ResponseWriter, httpReq *http.Request)
 
 	log.Debugf("Request: %T: %+v", reqPtrValue.Elem().Interface(), reqPtrValue.Elem().Interface())
 
-	ctx := NewContext()
+	ctx := s.newContext(httpRes, httpReq, &httpStatus)
+	defer ctx.rollbackOnPanic()
 	args := []reflect.Value{reflect.ValueOf(ctx), reqPtrValue.Elem()}
 	log.Debugf("args=%+v", args)
 	results := handler.fncValue.Call(args)
+	var err error
 	if !results[1].IsNil() {
-		err := results[1].Interface().(error)
+		err = results[1].Interface().(error)
+	}
+	if err = ctx.endTx(err); err != nil {
 		res.Header.Error = fmt.Sprintf("handler failed: %v", err)
+		httpStatus = http.StatusOK
+		if serviceError, ok := err.(IError); ok {
+			httpStatus = serviceError.Status()
+			res.Header.Code = serviceError.Code()
+		}
+		if detailsError, ok := err.(IErrorDetails); ok {
+			res.Header.Details = detailsError.Details()
+		}
 		return
 	}
 
 	res.Header.Success = true
 	res.Header.Error = ""
-	res.Data = results[0].Interface()
+	res.setData(results[0].Interface())
 	return
 }
 
@@ -218,24 +305,140 @@ type HandlerFunc func(IContext, req interface{}) (res interface{}, err error)
 
 type IContext interface {
 	Debugf(format string, args ...interface{})
+	Request() *http.Request   //nil when not serving HTTP
+	Context() context.Context //request context that is canceled when the client disconnects, pass it to db operations
+	Header() http.Header      //HTTP response headers
+	SetStatus(status int)     //HTTP response status when the handler succeeds, default http.StatusOK
+
+	//Tx begins a transaction on the service db on first use, and returns the same transaction for the rest of the request
+	//it is committed when the handler succeeds, else rolled back
+	Tx() (db.ITx, error)
 }
 
 func NewContext() IContext {
-	return context{}
+	status := http.StatusOK
+	return serviceContext{
+		httpReq:    nil,
+		httpHeader: http.Header{},
+		httpStatus: &status,
+		tx:         &contextTx{},
+	}
 }
 
-type context struct{}
+func (s *service) newContext(httpRes http.ResponseWriter, httpReq *http.Request, httpStatus *int) serviceContext {
+	return serviceContext{
+		httpReq:    httpReq,
+		httpHeader: httpRes.Header(),
+		httpStatus: httpStatus,
+		tx:         &contextTx{database: s.database},
+	}
+}
+
+type serviceContext struct {
+	httpReq    *http.Request
+	httpHeader http.Header
+	httpStatus *int
+	tx         *contextTx
+}
+
+//transaction started by the handler
+type contextTx struct {
+	database db.IDatabase
+	tx       db.ITx
+}
+
+func (ctx serviceContext) Debugf(format string, args ...interface{}) {}
+
+func (ctx serviceContext) Request() *http.Request { return ctx.httpReq }
+
+func (ctx serviceContext) Context() context.Context {
+	if ctx.httpReq != nil {
+		return ctx.httpReq.Context()
+	}
+	return context.Background()
+}
+
+func (ctx serviceContext) Header() http.Header { return ctx.httpHeader }
+
+func (ctx serviceContext) SetStatus(status int) { *ctx.httpStatus = status }
+
+func (ctx serviceContext) Tx() (db.ITx, error) {
+	if ctx.tx.tx != nil {
+		return ctx.tx.tx, nil
+	}
+	if ctx.tx.database == nil {
+		return nil, fmt.Errorf("service has no db for transactions")
+	}
+	tx, err := ctx.tx.database.Begin(ctx.Context())
+	if err != nil {
+		return nil, err
+	}
+	ctx.tx.tx = tx
+	return tx, nil
+}
 
-func (ctx context) Debugf(format string, args ...interface{}) {}
+//end the transaction if the handler started one: commit if handler succeeded, else rollback
+//returns the handler error, or the commit error
+func (ctx serviceContext) endTx(err error) error {
+	if ctx.tx.tx == nil {
+		return err
+	}
+	tx := ctx.tx.tx
+	ctx.tx.tx = nil
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			log.Errorf("failed to rollback after handler error: %v", rollbackErr)
+		}
+		return err
+	}
+	if commitErr := tx.Commit(); commitErr != nil {
+		return commitErr
+	}
+	return nil
+}
+
+//rollbackOnPanic is deferred before calling a handler, so a transaction that the handler started
+//is not left open, holding a connection and its locks, when the handler panics
+func (ctx serviceContext) rollbackOnPanic() {
+	if r := recover(); r != nil {
+		ctx.endTx(fmt.Errorf("handler panic: %v", r))
+		panic(r)
+	}
+}
 
 type Response struct {
 	Header ResponseHeader `json:"header"`
+	Page   *ResponsePage  `json:"page,omitempty"` //only when the handler returned a Page
 	Data   interface{}    `json:"data,omitempty"`
 }
 
+//Page can be returned by a handler for a list of items with pagination
+//then Items is the response data and the cursors are in the response page
+type Page struct {
+	Items interface{}
+	ResponsePage
+}
+
+type ResponsePage struct {
+	Next  string `json:"next,omitempty"`  //cursor to get the next page, omitted on the last page
+	Prev  string `json:"prev,omitempty"`  //cursor to get the previous page, omitted on the first page
+	Total *int64 `json:"total,omitempty"` //nr of items in all pages, only when requested
+}
+
+func (res *Response) setData(data interface{}) {
+	if page, ok := data.(Page); ok {
+		res.Page = &page.ResponsePage
+		res.Data = page.Items
+		return
+	}
+	res.Data = data
+}
+
 type ResponseHeader struct {
-	Success bool   `json:"success"`
-	Error   string `json:"error,omitempty"`
+	Success bool        `json:"success"`
+	Error   string      `json:"error,omitempty"`
+	Code    string      `json:"code,omitempty"`    //from handler errors that implement IError
+	Details interface{} `json:"details,omitempty"` //from handler errors that implement IErrorDetails
 }
 
 type IValidator interface {
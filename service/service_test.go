@@ -0,0 +1,111 @@
+package service_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-msvc/msf/db"
+	"github.com/go-msvc/msf/db/dbtest"
+	"github.com/go-msvc/msf/db/sqlite"
+	"github.com/go-msvc/msf/model"
+	"github.com/go-msvc/msf/mux"
+	"github.com/go-msvc/msf/service"
+)
+
+//http.HandlerFunc route values get the path after the route
+func TestHttpHandlerFunc(t *testing.T) {
+	echoPath := http.HandlerFunc(func(httpRes http.ResponseWriter, httpReq *http.Request) {
+		httpRes.Write([]byte(httpReq.URL.Path))
+	})
+	m := mux.New(nil)
+	m.MustAdd("files/{path...}", echoPath)
+	m.MustAdd("items/{id:int}", echoPath)
+	svc := service.NewService("test").HandleMux("api", m).(http.Handler)
+
+	for _, tc := range []struct {
+		path    string
+		status  int
+		handled string
+	}{
+		{"/api/files/a", http.StatusOK, "/a"},
+		{"/api/files/a/b/c/d/e/f/g/h", http.StatusOK, "/a/b/c/d/e/f/g/h"},
+		{"/api/files//a/./b/", http.StatusOK, "/a/b"},
+		{"/api/items/1", http.StatusOK, "/"},
+		{"/api/items/12345678", http.StatusOK, "/"},
+		{"/api/items/x", http.StatusNotFound, ""},
+	} {
+		httpRes := httptest.NewRecorder()
+		svc.ServeHTTP(httpRes, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if httpRes.Code != tc.status {
+			t.Fatalf("GET %s -> %d instead of %d", tc.path, httpRes.Code, tc.status)
+		}
+		if body, _ := ioutil.ReadAll(httpRes.Body); tc.handled != "" && string(body) != tc.handled {
+			t.Fatalf("GET %s -> handler got path \"%s\" instead of \"%s\"", tc.path, body, tc.handled)
+		}
+	}
+}
+
+//the transaction from IContext.Tx() is committed when the handler succeeds, else rolled back,
+//also when the handler panics
+func TestContextTx(t *testing.T) {
+	//in-memory sqlite has one connection, so a transaction left open blocks the next request
+	d := sqlite.Config{Filename: sqlite.Memory}.MustCreate()
+	defer d.Close()
+	locations, err := d.AddTable(model.New().MustAdd(dbtest.Location{}))
+	if err != nil {
+		t.Fatalf("failed to add table: %v", err)
+	}
+	m := mux.New(nil)
+	m.MustAddMethod(http.MethodPost, "{name}", func(ctx service.IContext, muxData map[string]interface{}) (interface{}, error) {
+		tx, err := ctx.Tx()
+		if err != nil {
+			return nil, err
+		}
+		name := muxData["name"].(string)
+		if _, err := tx.MustTable("location").AddContext(ctx.Context(), dbtest.Location{Name: name}); err != nil {
+			return nil, err
+		}
+		switch name {
+		case "fail":
+			return nil, fmt.Errorf("failed")
+		case "panic":
+			panic("handler panic")
+		}
+		return nil, nil
+	})
+	svc := service.NewService("test").WithDb(d).HandleMux("location", m).(http.Handler)
+	post := func(name string) (httpRes *httptest.ResponseRecorder, panicked interface{}) {
+		defer func() { panicked = recover() }()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		httpRes = httptest.NewRecorder()
+		svc.ServeHTTP(httpRes, httptest.NewRequest(http.MethodPost, "/location/"+name, nil).WithContext(ctx))
+		return httpRes, nil
+	}
+
+	for _, name := range []string{"fail", "panic", "ok"} {
+		httpRes, panicked := post(name)
+		if (panicked != nil) != (name == "panic") {
+			t.Fatalf("POST %s panic: %v", name, panicked)
+		}
+		if name == "ok" && httpRes.Code != http.StatusOK {
+			t.Fatalf("POST %s -> %d: %s", name, httpRes.Code, httpRes.Body.String())
+		}
+		_, dberr := locations.GetOneByKey(db.Key{"name": name})
+		if committed := dberr == nil; committed != (name == "ok") {
+			t.Fatalf("POST %s committed=%v: %v", name, committed, dberr)
+		}
+	}
+
+	//without a db
+	svc = service.NewService("test").HandleMux("location", m).(http.Handler)
+	if httpRes, _ := post("ok"); !strings.Contains(httpRes.Body.String(), `"success":false`) {
+		t.Fatalf("POST without db -> %d: %s", httpRes.Code, httpRes.Body.String())
+	}
+}